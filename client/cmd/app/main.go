@@ -19,7 +19,7 @@ func main() {
 	storage := server.New(log, cfg.Host, cfg.Port)
 	userService := usersservice.New(log, storage)
 
-	application := app.New(log, userService, cfg.Port, cfg.ExpirationTime)
+	application := app.New(log, userService, cfg.Port, cfg.ExpirationTime, cfg.PageSize)
 
 	application.Start()
 
@@ -4,10 +4,14 @@ import (
 	"bufio"
 	interfaces "client/internal/domain/interfaces/userservice"
 	"client/internal/domain/models"
+	"client/internal/storage"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -18,14 +22,16 @@ type App struct {
 	userservice     interfaces.UserService
 	port            int
 	expiration_time time.Duration
+	page_size       int
 }
 
-func New(log *slog.Logger, userservice interfaces.UserService, port int, expiration_time time.Duration) *App {
+func New(log *slog.Logger, userservice interfaces.UserService, port int, expiration_time time.Duration, page_size int) *App {
 	return &App{
 		log:             log,
 		userservice:     userservice,
 		port:            port,
 		expiration_time: expiration_time,
+		page_size:       page_size,
 	}
 }
 
@@ -34,6 +40,8 @@ func (a *App) Start() {
 	var choise string
 	scanner := bufio.NewScanner(os.Stdin)
 
+	a.login()
+
 	for {
 		fmt.Println("1. Get users")
 		fmt.Println("2. Get user by id")
@@ -41,7 +49,11 @@ func (a *App) Start() {
 		fmt.Println("4. Insert")
 		fmt.Println("5. Update")
 		fmt.Println("6. Delete")
-		fmt.Println("7. Exit")
+		fmt.Println("7. Change password")
+		fmt.Println("8. Export users to file")
+		fmt.Println("9. Restore user")
+		fmt.Println("10. Audit log")
+		fmt.Println("11. Exit")
 
 		scanner.Scan()
 		choise = scanner.Text()
@@ -49,22 +61,7 @@ func (a *App) Start() {
 		switch choise {
 		case "1":
 			fmt.Println("Get users")
-			context, cancel := context.WithDeadline(context.Background(), time.Now().Add(a.expiration_time))
-			defer cancel()
-			users, err := a.userservice.GetUsers(context)
-			if err != nil {
-				a.log.Error(fmt.Sprintf("%s: error fetching users: %v", op, err))
-				fmt.Println("Error fetching users")
-				break
-			}
-
-			fmt.Println("Users:")
-			for _, user := range users {
-				fmt.Println(user)
-			}
-
-			fmt.Println("Press Enter to exit...")
-			bufio.NewReader(os.Stdin).ReadString('\n')
+			a.browseUsers(scanner)
 
 		case "2":
 			fmt.Println("Get user by id")
@@ -113,13 +110,20 @@ func (a *App) Start() {
 		case "4":
 			fmt.Println("Insert")
 			user_for_insert := models.NewUser()
+			password := models.ReadPassword("Enter password")
 
 			context, cancel := context.WithDeadline(context.Background(), time.Now().Add(a.expiration_time))
 			defer cancel()
 
-			err := a.userservice.Insert(context, *user_for_insert)
+			err := a.userservice.Insert(context, *user_for_insert, password)
 			if err != nil {
 				a.log.Error(fmt.Sprintf("%s: error inserting user: %v", op, err))
+				printViolations(err, map[string]string{
+					"email":    user_for_insert.Email,
+					"password": strings.Repeat("*", len(password)),
+					"role":     user_for_insert.Role,
+					"nick":     user_for_insert.Nick,
+				})
 				break
 			}
 
@@ -129,23 +133,38 @@ func (a *App) Start() {
 
 		case "5":
 			fmt.Println("Update")
-			user_for_update := models.NewUser()
+			a.updateUser(scanner)
+
+			fmt.Println("Press Enter to exit...")
+			bufio.NewReader(os.Stdin).ReadString('\n')
+
+		case "6":
+			fmt.Println("Delete")
+			var uuid_id string
+			fmt.Scanf("%s", &uuid_id)
+			id, err := uuid.Parse(uuid_id)
+			if err != nil {
+				a.log.Error(fmt.Sprintf("%s: invalid UUID format: %v", op, err))
+				break
+			}
 
 			context, cancel := context.WithDeadline(context.Background(), time.Now().Add(a.expiration_time))
 			defer cancel()
 
-			err := a.userservice.Update(context, user_for_update.Id, *user_for_update)
+			user, err := a.userservice.Delete(context, id)
 			if err != nil {
-				a.log.Error(fmt.Sprintf("%s: error updating user: %v", op, err))
+				a.log.Error(fmt.Sprintf("%s: error deleting user: %v", op, err))
 				break
 			}
 
-			fmt.Println("User updated successfully")
+			fmt.Println("User deleted successfully")
+			fmt.Println(user)
+
 			fmt.Println("Press Enter to exit...")
 			bufio.NewReader(os.Stdin).ReadString('\n')
 
-		case "6":
-			fmt.Println("Delete")
+		case "7":
+			fmt.Println("Change password")
 			var uuid_id string
 			fmt.Scanf("%s", &uuid_id)
 			id, err := uuid.Parse(uuid_id)
@@ -154,22 +173,65 @@ func (a *App) Start() {
 				break
 			}
 
+			oldPassword := models.ReadPassword("Enter old password")
+			newPassword := models.ReadPassword("Enter new password")
+
 			context, cancel := context.WithDeadline(context.Background(), time.Now().Add(a.expiration_time))
 			defer cancel()
 
-			user, err := a.userservice.Delete(context, id)
+			err = a.userservice.ChangePassword(context, id, oldPassword, newPassword)
 			if err != nil {
-				a.log.Error(fmt.Sprintf("%s: error deleting user: %v", op, err))
+				a.log.Error(fmt.Sprintf("%s: error changing password: %v", op, err))
+				printViolations(err, map[string]string{
+					"password": strings.Repeat("*", len(newPassword)),
+				})
 				break
 			}
 
-			fmt.Println("User deleted successfully")
+			fmt.Println("Password changed successfully")
+			fmt.Println("Press Enter to exit...")
+			bufio.NewReader(os.Stdin).ReadString('\n')
+
+		case "8":
+			fmt.Println("Export users to file")
+			a.exportUsers(scanner)
+
+			fmt.Println("Press Enter to exit...")
+			bufio.NewReader(os.Stdin).ReadString('\n')
+
+		case "9":
+			fmt.Println("Restore user")
+			scanner.Scan()
+			id, err := uuid.Parse(strings.TrimSpace(scanner.Text()))
+			if err != nil {
+				a.log.Error(fmt.Sprintf("%s: invalid UUID format: %v", op, err))
+				break
+			}
+
+			context, cancel := context.WithDeadline(context.Background(), time.Now().Add(a.expiration_time))
+			defer cancel()
+
+			user, err := a.userservice.RestoreUser(context, id)
+			if errors.Is(err, storage.ErrUserExists) {
+				fmt.Println("The email of the user is taken by another user")
+				break
+			}
+			if err != nil {
+				a.log.Error(fmt.Sprintf("%s: error restoring user: %v", op, err))
+				break
+			}
+
+			fmt.Println("User restored successfully")
 			fmt.Println(user)
 
 			fmt.Println("Press Enter to exit...")
 			bufio.NewReader(os.Stdin).ReadString('\n')
 
-		case "7":
+		case "10":
+			fmt.Println("Audit log")
+			a.browseAuditLog(scanner)
+
+		case "11":
 			fmt.Println("Exit...")
 			bufio.NewReader(os.Stdin).ReadString('\n')
 			return
@@ -180,3 +242,347 @@ func (a *App) Start() {
 		}
 	}
 }
+
+// updateUser loads the user, asks for the new values and sends them together
+// with the loaded version. When someone else changed the user in the meantime
+// the server rejects the update and the user may be reloaded and edited again.
+func (a *App) updateUser(scanner *bufio.Scanner) {
+	const op = "app.updateUser"
+
+	fmt.Println("Enter id")
+	scanner.Scan()
+	id, err := uuid.Parse(strings.TrimSpace(scanner.Text()))
+	if err != nil {
+		a.log.Error(fmt.Sprintf("%s: invalid UUID format: %v", op, err))
+		return
+	}
+
+	for {
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(a.expiration_time))
+		current, err := a.userservice.GetUserById(ctx, id)
+		cancel()
+		if err != nil {
+			a.log.Error(fmt.Sprintf("%s: error fetching user by id: %v", op, err))
+			fmt.Println("Error fetching user")
+			return
+		}
+
+		fmt.Println("Current user:")
+		fmt.Println(current)
+
+		user_for_update := current
+		ask := func(prompt string, value *string) {
+			fmt.Printf("Enter %s (empty keeps %q)\n", prompt, *value)
+			scanner.Scan()
+			if text := strings.TrimSpace(scanner.Text()); text != "" {
+				*value = text
+			}
+		}
+		ask("email", &user_for_update.Email)
+		ask("role", &user_for_update.Role)
+		ask("nick", &user_for_update.Nick)
+
+		ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(a.expiration_time))
+		err = a.userservice.Update(ctx, id, user_for_update)
+		cancel()
+		if errors.Is(err, storage.ErrConflict) {
+			a.log.Warn(fmt.Sprintf("%s: user changed since it was loaded: %v", op, err))
+			fmt.Println("Record changed by someone else, reload? y/n")
+			scanner.Scan()
+			if strings.EqualFold(strings.TrimSpace(scanner.Text()), "y") {
+				continue
+			}
+			return
+		}
+		if err != nil {
+			a.log.Error(fmt.Sprintf("%s: error updating user: %v", op, err))
+			printViolations(err, map[string]string{
+				"email": user_for_update.Email,
+				"role":  user_for_update.Role,
+				"nick":  user_for_update.Nick,
+			})
+			return
+		}
+
+		fmt.Println("User updated successfully")
+		return
+	}
+}
+
+// login asks for credentials until the server accepts them.
+func (a *App) login() {
+	const op = "app.login"
+
+	for {
+		fmt.Println("Login")
+		var email string
+		fmt.Println("Enter email")
+		fmt.Scanf("%s", &email)
+		password := models.ReadPassword("Enter password")
+
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(a.expiration_time))
+		err := a.userservice.Login(ctx, email, password)
+		cancel()
+		if err != nil {
+			a.log.Error(fmt.Sprintf("%s: error logging in: %v", op, err))
+			fmt.Println("Invalid email or password")
+			continue
+		}
+
+		fmt.Println("Logged in as " + email)
+		return
+	}
+}
+
+// printViolations shows the server validation errors next to the values the user typed.
+func printViolations(err error, typed map[string]string) {
+	var validationErr *storage.ValidationError
+	if !errors.As(err, &validationErr) {
+		return
+	}
+
+	fmt.Println("Invalid input:")
+	for _, v := range validationErr.Violations {
+		fmt.Printf("  %s: %q <- %s\n", v.Field, typed[v.Field], v.Description)
+	}
+}
+
+// browseUsers shows users page by page. The tokens of visited pages are kept
+// so that the previous page can be requested again.
+func (a *App) browseUsers(scanner *bufio.Scanner) {
+	const op = "app.browseUsers"
+	tokens := []string{""}
+
+	query, ok := readUsersQuery(scanner)
+	if !ok {
+		return
+	}
+
+	for {
+		context, cancel := context.WithDeadline(context.Background(), time.Now().Add(a.expiration_time))
+		page, err := a.userservice.GetUsers(context, query, a.page_size, tokens[len(tokens)-1])
+		cancel()
+		if err != nil {
+			a.log.Error(fmt.Sprintf("%s: error fetching users: %v", op, err))
+			fmt.Println("Error fetching users")
+			printViolations(err, map[string]string{
+				"role":           query.Role,
+				"email_domain":   query.EmailDomain,
+				"nick_prefix":    query.NickPrefix,
+				"nick_contains":  query.NickContains,
+				"created_after":  formatDate(query.CreatedAfter),
+				"created_before": formatDate(query.CreatedBefore),
+			})
+			return
+		}
+
+		fmt.Printf("Users (page %d):\n", len(tokens))
+		for _, user := range page.Users {
+			fmt.Println(user)
+		}
+
+		if page.NextPageToken != "" {
+			fmt.Println("n. Next page")
+		}
+		if len(tokens) > 1 {
+			fmt.Println("p. Previous page")
+		}
+		fmt.Println("q. Back to menu")
+
+		scanner.Scan()
+		switch scanner.Text() {
+		case "n":
+			if page.NextPageToken != "" {
+				tokens = append(tokens, page.NextPageToken)
+			}
+		case "p":
+			if len(tokens) > 1 {
+				tokens = tokens[:len(tokens)-1]
+			}
+		case "q":
+			return
+		}
+	}
+}
+
+// browseAuditLog shows the audit log, newest first, optionally narrowed to a
+// target or an actor. Paging works as in browseUsers.
+func (a *App) browseAuditLog(scanner *bufio.Scanner) {
+	const op = "app.browseAuditLog"
+	tokens := []string{""}
+
+	var query models.AuditQuery
+	askId := func(prompt string) (uuid.UUID, bool) {
+		fmt.Println(prompt + " (empty to skip)")
+		scanner.Scan()
+		value := strings.TrimSpace(scanner.Text())
+		if value == "" {
+			return uuid.Nil, true
+		}
+
+		id, err := uuid.Parse(value)
+		if err != nil {
+			fmt.Println("Invalid id: " + value)
+			return uuid.Nil, false
+		}
+		return id, true
+	}
+
+	var ok bool
+	if query.TargetId, ok = askId("Target user id"); !ok {
+		return
+	}
+	if query.ActorId, ok = askId("Actor user id"); !ok {
+		return
+	}
+
+	for {
+		context, cancel := context.WithDeadline(context.Background(), time.Now().Add(a.expiration_time))
+		page, err := a.userservice.ListAuditEvents(context, query, a.page_size, tokens[len(tokens)-1])
+		cancel()
+		if err != nil {
+			a.log.Error(fmt.Sprintf("%s: error fetching audit events: %v", op, err))
+			fmt.Println("Error fetching audit events")
+			return
+		}
+
+		fmt.Printf("Audit events (page %d):\n", len(tokens))
+		for _, event := range page.Events {
+			actor := "system"
+			if event.ActorId != uuid.Nil {
+				actor = event.ActorId.String()
+			}
+			fmt.Printf("%s %s %s by %s, request %s\n", event.OccurredAt.Local().Format(time.DateTime), event.Operation, event.TargetId, actor, event.RequestId)
+			for _, change := range event.Changes {
+				fmt.Printf("    %s: %q -> %q\n", change.Field, change.Before, change.After)
+			}
+		}
+
+		if page.NextPageToken != "" {
+			fmt.Println("n. Next page")
+		}
+		if len(tokens) > 1 {
+			fmt.Println("p. Previous page")
+		}
+		fmt.Println("q. Back to menu")
+
+		scanner.Scan()
+		switch scanner.Text() {
+		case "n":
+			if page.NextPageToken != "" {
+				tokens = append(tokens, page.NextPageToken)
+			}
+		case "p":
+			if len(tokens) > 1 {
+				tokens = tokens[:len(tokens)-1]
+			}
+		case "q":
+			return
+		}
+	}
+}
+
+// exportUsers streams the users matching the query into a JSON Lines file.
+// Every user is written as soon as it arrives, so the export does not hold the
+// list in memory. The call has no deadline since large exports take a while.
+func (a *App) exportUsers(scanner *bufio.Scanner) {
+	const op = "app.exportUsers"
+
+	query, ok := readUsersQuery(scanner)
+	if !ok {
+		return
+	}
+
+	fmt.Println("Enter file path")
+	scanner.Scan()
+	path := strings.TrimSpace(scanner.Text())
+	if path == "" {
+		fmt.Println("File path is required")
+		return
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		a.log.Error(fmt.Sprintf("%s: error creating file: %v", op, err))
+		fmt.Println("Error creating file")
+		return
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+
+	count := 0
+	err = a.userservice.StreamUsers(context.Background(), query, func(user models.User) error {
+		count++
+		return encoder.Encode(user)
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		a.log.Error(fmt.Sprintf("%s: error exporting users: %v", op, err))
+		fmt.Printf("Export failed after %d users\n", count)
+		return
+	}
+
+	fmt.Printf("Exported %d users to %s\n", count, path)
+}
+
+const dateLayout = "2006-01-02"
+
+// readUsersQuery asks for the filter and sort of the user list, empty answers are skipped.
+func readUsersQuery(scanner *bufio.Scanner) (models.UsersQuery, bool) {
+	var query models.UsersQuery
+	ask := func(prompt string) string {
+		fmt.Println(prompt + " (empty to skip)")
+		scanner.Scan()
+		return strings.TrimSpace(scanner.Text())
+	}
+	askDate := func(prompt string) (time.Time, bool) {
+		value := ask(prompt + ", " + dateLayout)
+		if value == "" {
+			return time.Time{}, true
+		}
+
+		date, err := time.Parse(dateLayout, value)
+		if err != nil {
+			fmt.Println("Invalid date: " + value)
+			return time.Time{}, false
+		}
+		return date, true
+	}
+
+	query.Role = ask("Role")
+	query.EmailDomain = ask("Email domain")
+	query.NickPrefix = ask("Nick starts with")
+	query.NickContains = ask("Nick contains")
+
+	var ok bool
+	if query.CreatedAfter, ok = askDate("Created on or after"); !ok {
+		return models.UsersQuery{}, false
+	}
+	if query.CreatedBefore, ok = askDate("Created before"); !ok {
+		return models.UsersQuery{}, false
+	}
+
+	switch sortBy := ask("Sort by: created_at, email, role or nick"); sortBy {
+	case "", models.SortByCreatedAt, models.SortByEmail, models.SortByRole, models.SortByNick:
+		query.SortBy = sortBy
+	default:
+		fmt.Println("Unknown sort field: " + sortBy)
+		return models.UsersQuery{}, false
+	}
+	query.Descending = strings.EqualFold(ask("Descending? y/n"), "y")
+	query.IncludeDeleted = strings.EqualFold(ask("Include deleted users? y/n"), "y")
+
+	return query, true
+}
+
+func formatDate(date time.Time) string {
+	if date.IsZero() {
+		return ""
+	}
+
+	return date.Format(dateLayout)
+}
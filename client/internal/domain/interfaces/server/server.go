@@ -8,10 +8,19 @@ import (
 )
 
 type ServerUserFetcher interface {
-	GetUsers(context.Context) ([]models.User, error)
+	Authenticate(context.Context, string, string) error
+	GetUsers(context.Context, models.UsersQuery, int, string) (models.UsersPage, error)
+	StreamUsers(context.Context, models.UsersQuery, func(models.User) error) error
 	GetUserById(context.Context, uuid.UUID) (models.User, error)
+	BatchGetUsers(context.Context, []uuid.UUID) ([]models.User, []uuid.UUID, error)
 	GetUserByEmail(context.Context, string) (models.User, error)
-	Insert(context.Context, models.User) error
+	Insert(context.Context, models.User, string) error
 	Update(context.Context, uuid.UUID, models.User) error
 	Delete(context.Context, uuid.UUID) (models.User, error)
+	RestoreUser(context.Context, uuid.UUID) (models.User, error)
+	BatchInsertUsers(context.Context, []models.BatchInsertItem, models.BatchMode) ([]models.BatchResult, error)
+	BatchUpdateUsers(context.Context, []models.User, models.BatchMode) ([]models.BatchResult, error)
+	BatchDeleteUsers(context.Context, []uuid.UUID, models.BatchMode) ([]models.BatchResult, error)
+	ListAuditEvents(context.Context, models.AuditQuery, int, string) (models.AuditPage, error)
+	ChangePassword(context.Context, uuid.UUID, string, string) error
 }
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FieldChange is a changed field of the target user, passwords are redacted by the server.
+type FieldChange struct {
+	Field  string
+	Before string
+	After  string
+}
+
+// AuditEvent records one change of a user. ActorId is uuid.Nil when the
+// change was not made by an authenticated caller.
+type AuditEvent struct {
+	Id         uuid.UUID
+	OccurredAt time.Time
+	RequestId  string
+	ActorId    uuid.UUID
+	Operation  string
+	TargetId   uuid.UUID
+	Changes    []FieldChange
+}
+
+// AuditQuery narrows the audit log to a target and/or an actor, uuid.Nil matches any.
+type AuditQuery struct {
+	TargetId uuid.UUID
+	ActorId  uuid.UUID
+}
+
+type AuditPage struct {
+	Events        []AuditEvent
+	NextPageToken string
+}
@@ -0,0 +1,21 @@
+package models
+
+// BatchMode tells the server whether a batch is applied all or nothing.
+type BatchMode int
+
+const (
+	BatchAtomic BatchMode = iota
+	BatchBestEffort
+)
+
+// BatchInsertItem is a user to insert in a batch with its password.
+type BatchInsertItem struct {
+	User     User
+	Password string
+}
+
+// BatchResult is the outcome of one item of a batch, User is set when it was applied.
+type BatchResult struct {
+	User User
+	Err  error
+}
@@ -2,27 +2,85 @@ package models
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type User struct {
-	Id       uuid.UUID
-	Email    string
-	Password string
-	Role     string
-	Nick     string
+	Id    uuid.UUID `json:"id"`
+	Email string    `json:"email"`
+	Role  string    `json:"role"`
+	Nick  string    `json:"nick"`
+	// Version is the server version of the user, Update sends it back to
+	// detect changes made in the meantime.
+	Version int64 `json:"version"`
+	// DeletedAt is set for soft-deleted users, they are listed only on request.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// CreatedAt, UpdatedAt and UpdatedBy are set by the server, values sent
+	// with Insert or Update are ignored. UpdatedBy is uuid.Nil when the server
+	// made the change itself.
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UpdatedBy uuid.UUID `json:"updated_by"`
+}
+
+// String formats the user for the menu output.
+func (u User) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s role=%s nick=%s version=%d", u.Id, u.Email, u.Role, u.Nick, u.Version)
+	fmt.Fprintf(&b, " created=%s updated=%s", formatTime(u.CreatedAt), formatTime(u.UpdatedAt))
+	if u.UpdatedBy != uuid.Nil {
+		fmt.Fprintf(&b, " by %s", u.UpdatedBy)
+	}
+	if u.DeletedAt != nil {
+		fmt.Fprintf(&b, " deleted=%s", formatTime(*u.DeletedAt))
+	}
+
+	return b.String()
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return t.Local().Format(time.DateTime)
+}
+
+// Sort fields accepted by UsersQuery.SortBy.
+const (
+	SortByCreatedAt = "created_at"
+	SortByEmail     = "email"
+	SortByRole      = "role"
+	SortByNick      = "nick"
+)
+
+// UsersQuery filters and orders the user list, empty fields are ignored.
+type UsersQuery struct {
+	Role           string
+	EmailDomain    string
+	NickPrefix     string
+	NickContains   string
+	CreatedAfter   time.Time
+	CreatedBefore  time.Time
+	SortBy         string
+	Descending     bool
+	IncludeDeleted bool
+}
+
+type UsersPage struct {
+	Users         []User
+	NextPageToken string
 }
 
 func NewUser() *User {
 	id := uuid.New()
-	var email, password, role, nick string
+	var email, role, nick string
 	fmt.Println("Enter email")
 	fmt.Scanf("%s", &email)
 
-	fmt.Println("Enter password")
-	fmt.Scanf("%s", &password)
-
 	fmt.Println("Enter role")
 	fmt.Scanf("%s", &role)
 
@@ -30,10 +88,17 @@ func NewUser() *User {
 	fmt.Scanf("%s", &nick)
 
 	return &User{
-		Id:       id,
-		Email:    email,
-		Password: password,
-		Role:     role,
-		Nick:     nick,
+		Id:    id,
+		Email: email,
+		Role:  role,
+		Nick:  nick,
 	}
 }
+
+func ReadPassword(prompt string) string {
+	var password string
+	fmt.Println(prompt)
+	fmt.Scanf("%s", &password)
+
+	return password
+}
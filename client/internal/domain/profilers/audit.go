@@ -0,0 +1,63 @@
+package profilers
+
+import (
+	"client/internal/domain/models"
+
+	umv1 "github.com/chas3air/protos/gen/go/usersManager"
+	"github.com/google/uuid"
+)
+
+// AuditQueryToProto builds the audit log request, uuid.Nil filters are left empty.
+func AuditQueryToProto(query models.AuditQuery, pageSize int, pageToken string) *umv1.ListAuditEventsRequest {
+	req := &umv1.ListAuditEventsRequest{
+		PageSize:  int32(pageSize),
+		PageToken: pageToken,
+	}
+	if query.TargetId != uuid.Nil {
+		req.TargetId = query.TargetId.String()
+	}
+	if query.ActorId != uuid.Nil {
+		req.ActorId = query.ActorId.String()
+	}
+
+	return req
+}
+
+// ProtoAuditEventToAuditEvent converts the event, an empty actor_id becomes uuid.Nil.
+func ProtoAuditEventToAuditEvent(proto_event *umv1.AuditEvent) (models.AuditEvent, error) {
+	id, err := uuid.Parse(proto_event.GetId())
+	if err != nil {
+		return models.AuditEvent{}, err
+	}
+
+	targetId, err := uuid.Parse(proto_event.GetTargetId())
+	if err != nil {
+		return models.AuditEvent{}, err
+	}
+
+	var actorId uuid.UUID
+	if proto_event.GetActorId() != "" {
+		if actorId, err = uuid.Parse(proto_event.GetActorId()); err != nil {
+			return models.AuditEvent{}, err
+		}
+	}
+
+	event := models.AuditEvent{
+		Id:         id,
+		OccurredAt: proto_event.GetOccurredAt().AsTime(),
+		RequestId:  proto_event.GetRequestId(),
+		ActorId:    actorId,
+		Operation:  proto_event.GetOperation(),
+		TargetId:   targetId,
+		Changes:    make([]models.FieldChange, 0, len(proto_event.GetChanges())),
+	}
+	for _, change := range proto_event.GetChanges() {
+		event.Changes = append(event.Changes, models.FieldChange{
+			Field:  change.GetField(),
+			Before: change.GetBefore(),
+			After:  change.GetAfter(),
+		})
+	}
+
+	return event, nil
+}
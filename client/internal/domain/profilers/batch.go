@@ -0,0 +1,15 @@
+package profilers
+
+import (
+	"client/internal/domain/models"
+
+	umv1 "github.com/chas3air/protos/gen/go/usersManager"
+)
+
+func BatchModeToProto(mode models.BatchMode) umv1.BatchMode {
+	if mode == models.BatchBestEffort {
+		return umv1.BatchMode_BATCH_MODE_BEST_EFFORT
+	}
+
+	return umv1.BatchMode_BATCH_MODE_ATOMIC
+}
@@ -2,32 +2,109 @@ package profilers
 
 import (
 	"client/internal/domain/models"
+	"fmt"
 
 	umv1 "github.com/chas3air/protos/gen/go/usersManager"
 	"github.com/google/uuid"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-func UsrToProroUsr(user models.User) *umv1.User {
+// UsrToProroUsr builds the write model, password is sent only on insert and left empty otherwise.
+func UsrToProroUsr(user models.User, password string) *umv1.User {
 	return &umv1.User{
 		Id:       user.Id.String(),
 		Email:    user.Email,
-		Password: user.Password,
+		Password: password,
 		Role:     user.Role,
 		Nick:     user.Nick,
+		Version:  user.Version,
 	}
 }
 
-func ProtoUsrToUsr(proto_usr *umv1.User) (models.User, error) {
+var sortFields = map[string]umv1.UserSortField{
+	"":                     umv1.UserSortField_USER_SORT_FIELD_UNSPECIFIED,
+	models.SortByCreatedAt: umv1.UserSortField_USER_SORT_FIELD_CREATED_AT,
+	models.SortByEmail:     umv1.UserSortField_USER_SORT_FIELD_EMAIL,
+	models.SortByRole:      umv1.UserSortField_USER_SORT_FIELD_ROLE,
+	models.SortByNick:      umv1.UserSortField_USER_SORT_FIELD_NICK,
+}
+
+// UsersQueryToProto builds the list request, it fails on an unknown sort field.
+func UsersQueryToProto(query models.UsersQuery, pageSize int, pageToken string) (*umv1.GetUsersRequest, error) {
+	sortBy, ok := sortFields[query.SortBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort field %q", query.SortBy)
+	}
+
+	req := &umv1.GetUsersRequest{
+		PageSize:       int32(pageSize),
+		PageToken:      pageToken,
+		Role:           query.Role,
+		EmailDomain:    query.EmailDomain,
+		NickPrefix:     query.NickPrefix,
+		NickContains:   query.NickContains,
+		SortBy:         sortBy,
+		Descending:     query.Descending,
+		IncludeDeleted: query.IncludeDeleted,
+	}
+	if !query.CreatedAfter.IsZero() {
+		req.CreatedAfter = timestamppb.New(query.CreatedAfter)
+	}
+	if !query.CreatedBefore.IsZero() {
+		req.CreatedBefore = timestamppb.New(query.CreatedBefore)
+	}
+
+	return req, nil
+}
+
+// UsersQueryToStreamProto builds the export request, it fails on an unknown sort field.
+func UsersQueryToStreamProto(query models.UsersQuery) (*umv1.StreamUsersRequest, error) {
+	req, err := UsersQueryToProto(query, 0, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &umv1.StreamUsersRequest{
+		Role:           req.GetRole(),
+		EmailDomain:    req.GetEmailDomain(),
+		NickPrefix:     req.GetNickPrefix(),
+		NickContains:   req.GetNickContains(),
+		CreatedAfter:   req.GetCreatedAfter(),
+		CreatedBefore:  req.GetCreatedBefore(),
+		SortBy:         req.GetSortBy(),
+		Descending:     req.GetDescending(),
+		IncludeDeleted: req.GetIncludeDeleted(),
+	}, nil
+}
+
+func ProtoUsrToUsr(proto_usr *umv1.PublicUser) (models.User, error) {
 	parsedUUID, err := uuid.Parse(proto_usr.GetId())
 	if err != nil {
 		return models.User{}, err
 	}
 
-	return models.User{
-		Id:       parsedUUID,
-		Email:    proto_usr.GetEmail(),
-		Password: proto_usr.GetPassword(),
-		Role:     proto_usr.GetRole(),
-		Nick:     proto_usr.GetNick(),
-	}, nil
+	user := models.User{
+		Id:      parsedUUID,
+		Email:   proto_usr.GetEmail(),
+		Role:    proto_usr.GetRole(),
+		Nick:    proto_usr.GetNick(),
+		Version: proto_usr.GetVersion(),
+	}
+	if proto_usr.GetDeletedAt() != nil {
+		deletedAt := proto_usr.GetDeletedAt().AsTime()
+		user.DeletedAt = &deletedAt
+	}
+	if proto_usr.GetCreatedAt() != nil {
+		user.CreatedAt = proto_usr.GetCreatedAt().AsTime()
+	}
+	if proto_usr.GetUpdatedAt() != nil {
+		user.UpdatedAt = proto_usr.GetUpdatedAt().AsTime()
+	}
+	if proto_usr.GetUpdatedBy() != "" {
+		if user.UpdatedBy, err = uuid.Parse(proto_usr.GetUpdatedBy()); err != nil {
+			return models.User{}, err
+		}
+	}
+
+	return user, nil
 }
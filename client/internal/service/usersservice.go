@@ -27,20 +27,60 @@ func New(log *slog.Logger, storage storage.ServerUserFetcher) *UserService {
 	}
 }
 
-func (u *UserService) GetUsers(ctx context.Context) ([]models.User, error) {
+func (u *UserService) Login(ctx context.Context, email string, password string) error {
+	const op = "services.userManager.Login"
+	log := u.log.With(slog.String("operation", op))
+
+	if err := u.storage.Authenticate(ctx, email, password); err != nil {
+		if errors.Is(err, storage_errors.ErrUnauthenticated) {
+			log.Warn("Invalid credentials", sl.Err(err), slog.String("email", email))
+
+			return fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+		}
+
+		log.Error("Failed to log in", sl.Err(err), slog.String("email", email))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("Logged in successfully", slog.String("email", email))
+	return nil
+}
+
+func (u *UserService) GetUsers(ctx context.Context, query models.UsersQuery, pageSize int, pageToken string) (models.UsersPage, error) {
 	const op = "service.getUsers"
 	log := u.log.With(
 		slog.String("op", op),
 	)
 
-	users, err := u.storage.GetUsers(ctx)
+	page, err := u.storage.GetUsers(ctx, query, pageSize, pageToken)
 	if err != nil {
 		log.Warn("failed to fetch users", sl.Err(err))
 
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return models.UsersPage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return page, nil
+}
+
+func (u *UserService) StreamUsers(ctx context.Context, query models.UsersQuery, fn func(models.User) error) error {
+	const op = "service.streamUsers"
+	log := u.log.With(
+		slog.String("op", op),
+	)
+
+	count := 0
+	err := u.storage.StreamUsers(ctx, query, func(user models.User) error {
+		count++
+		return fn(user)
+	})
+	if err != nil {
+		log.Warn("failed to stream users", slog.Int("received", count), sl.Err(err))
+
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	return users, nil
+	log.Info("users streamed", slog.Int("count", count))
+	return nil
 }
 
 func (u *UserService) GetUserById(ctx context.Context, uid uuid.UUID) (models.User, error) {
@@ -83,11 +123,11 @@ func (u *UserService) GetUserByEmail(ctx context.Context, email string) (models.
 	return user, nil
 }
 
-func (u *UserService) Insert(ctx context.Context, user models.User) error {
+func (u *UserService) Insert(ctx context.Context, user models.User, password string) error {
 	const op = "services.userManager.Insert"
 	log := u.log.With(slog.String("operation", op))
 
-	err := u.storage.Insert(ctx, user)
+	err := u.storage.Insert(ctx, user, password)
 	if err != nil {
 		if errors.Is(err, storage_errors.ErrUserExists) {
 			log.Warn("User already exists", sl.Err(err), slog.Any("additional info", user), slog.String("error", err.Error()))
@@ -149,3 +189,123 @@ func (u *UserService) Delete(ctx context.Context, uid uuid.UUID) (models.User, e
 	}), slog.String("error", "nil"))
 	return user, nil
 }
+
+func (u *UserService) RestoreUser(ctx context.Context, uid uuid.UUID) (models.User, error) {
+	const op = "services.userManager.RestoreUser"
+	log := u.log.With(slog.String("operation", op))
+
+	user, err := u.storage.RestoreUser(ctx, uid)
+	if err != nil {
+		log.Warn("Failed to restore user", sl.Err(err), slog.String("userId", uid.String()))
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("User restored successfully", slog.String("userId", uid.String()))
+	return user, nil
+}
+
+// BatchGetUsers returns the users found by the ids in one call and the ids that were not found.
+func (u *UserService) BatchGetUsers(ctx context.Context, uids []uuid.UUID) ([]models.User, []uuid.UUID, error) {
+	const op = "services.userManager.BatchGetUsers"
+	log := u.log.With(slog.String("operation", op))
+
+	users, missing, err := u.storage.BatchGetUsers(ctx, uids)
+	if err != nil {
+		log.Error("Failed to retrieve users by ids", sl.Err(err), slog.Int("count", len(uids)))
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("Successfully retrieved users", slog.Int("count", len(users)), slog.Int("missing", len(missing)))
+	return users, missing, nil
+}
+
+// BatchInsertUsers inserts the users in one call, the results are in the order of the items.
+func (u *UserService) BatchInsertUsers(ctx context.Context, items []models.BatchInsertItem, mode models.BatchMode) ([]models.BatchResult, error) {
+	const op = "services.userManager.BatchInsertUsers"
+	log := u.log.With(slog.String("operation", op))
+
+	results, err := u.storage.BatchInsertUsers(ctx, items, mode)
+	if err != nil {
+		log.Error("Failed to insert users", sl.Err(err), slog.Int("count", len(items)))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("Users batch inserted", slog.Int("count", len(items)), slog.Int("failed", countFailed(results)))
+	return results, nil
+}
+
+// BatchUpdateUsers updates the users by their ids in one call, passwords are not changed.
+func (u *UserService) BatchUpdateUsers(ctx context.Context, users []models.User, mode models.BatchMode) ([]models.BatchResult, error) {
+	const op = "services.userManager.BatchUpdateUsers"
+	log := u.log.With(slog.String("operation", op))
+
+	results, err := u.storage.BatchUpdateUsers(ctx, users, mode)
+	if err != nil {
+		log.Error("Failed to update users", sl.Err(err), slog.Int("count", len(users)))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("Users batch updated", slog.Int("count", len(users)), slog.Int("failed", countFailed(results)))
+	return results, nil
+}
+
+// BatchDeleteUsers deletes the users in one call.
+func (u *UserService) BatchDeleteUsers(ctx context.Context, uids []uuid.UUID, mode models.BatchMode) ([]models.BatchResult, error) {
+	const op = "services.userManager.BatchDeleteUsers"
+	log := u.log.With(slog.String("operation", op))
+
+	results, err := u.storage.BatchDeleteUsers(ctx, uids, mode)
+	if err != nil {
+		log.Error("Failed to delete users", sl.Err(err), slog.Int("count", len(uids)))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("Users batch deleted", slog.Int("count", len(uids)), slog.Int("failed", countFailed(results)))
+	return results, nil
+}
+
+func countFailed(results []models.BatchResult) int {
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+
+	return failed
+}
+
+// ListAuditEvents returns one page of the audit log, newest first.
+func (u *UserService) ListAuditEvents(ctx context.Context, query models.AuditQuery, pageSize int, pageToken string) (models.AuditPage, error) {
+	const op = "services.userManager.ListAuditEvents"
+	log := u.log.With(slog.String("operation", op))
+
+	page, err := u.storage.ListAuditEvents(ctx, query, pageSize, pageToken)
+	if err != nil {
+		log.Warn("Failed to retrieve audit events", sl.Err(err))
+		return models.AuditPage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("Audit events retrieved successfully", slog.Int("count", len(page.Events)))
+	return page, nil
+}
+
+func (u *UserService) ChangePassword(ctx context.Context, uid uuid.UUID, oldPassword string, newPassword string) error {
+	const op = "services.userManager.ChangePassword"
+	log := u.log.With(slog.String("operation", op))
+
+	err := u.storage.ChangePassword(ctx, uid, oldPassword, newPassword)
+	if err != nil {
+		if errors.Is(err, storage_errors.ErrUserNotFound) {
+			log.Warn("User not found", sl.Err(err), slog.String("userId", uid.String()))
+
+			return fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+		}
+
+		log.Error("Failed to change password", sl.Err(err), slog.String("userId", uid.String()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("Password changed successfully", slog.String("userId", uid.String()))
+	return nil
+}
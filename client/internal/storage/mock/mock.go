@@ -6,27 +6,110 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type MockStorage struct {
-	users []models.User
-	log   *slog.Logger
+	users     []models.User
+	passwords map[uuid.UUID]string
+	log       *slog.Logger
 }
 
 func New(log *slog.Logger) *MockStorage {
 	return &MockStorage{
-		users: make([]models.User, 0),
-		log:   log,
+		users:     make([]models.User, 0),
+		passwords: make(map[uuid.UUID]string),
+		log:       log,
 	}
 }
 
-func (m *MockStorage) GetUsers(ctx context.Context) ([]models.User, error) {
+// GetUsers pages over the users matching the query, the page token is the offset of the page.
+// The default order is the insertion order, which is also the creation order.
+func (m *MockStorage) GetUsers(ctx context.Context, query models.UsersQuery, pageSize int, pageToken string) (models.UsersPage, error) {
 	const op = "storage.mock.GetUsers"
 	m.log.Info("Fetching users", slog.String("operation", op), slog.String("error", "nil"))
 
-	return m.users, nil
+	users := make([]models.User, 0, len(m.users))
+	for _, v := range m.users {
+		if matchesQuery(v, query) {
+			users = append(users, v)
+		}
+	}
+
+	var key func(models.User) string
+	switch query.SortBy {
+	case "", models.SortByCreatedAt:
+	case models.SortByEmail:
+		key = func(u models.User) string { return u.Email }
+	case models.SortByRole:
+		key = func(u models.User) string { return u.Role }
+	case models.SortByNick:
+		key = func(u models.User) string { return u.Nick }
+	default:
+		return models.UsersPage{}, fmt.Errorf("%s: %w", op, storage.ErrInvalidArgument)
+	}
+	if key != nil {
+		sort.SliceStable(users, func(i, j int) bool { return key(users[i]) < key(users[j]) })
+	}
+	if query.Descending {
+		slices.Reverse(users)
+	}
+
+	offset := 0
+	if pageToken != "" {
+		var err error
+		offset, err = strconv.Atoi(pageToken)
+		if err != nil || offset < 0 || offset > len(users) {
+			return models.UsersPage{}, fmt.Errorf("%s: %w", op, storage.ErrInvalidArgument)
+		}
+	}
+
+	end := len(users)
+	if pageSize > 0 && offset+pageSize < end {
+		end = offset + pageSize
+	}
+
+	page := models.UsersPage{Users: users[offset:end]}
+	if end < len(users) {
+		page.NextPageToken = strconv.Itoa(end)
+	}
+
+	return page, nil
+}
+
+func (m *MockStorage) StreamUsers(ctx context.Context, query models.UsersQuery, fn func(models.User) error) error {
+	const op = "storage.mock.StreamUsers"
+
+	page, err := m.GetUsers(ctx, query, 0, "")
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, v := range page.Users {
+		if err := fn(v); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+func matchesQuery(user models.User, query models.UsersQuery) bool {
+	_, domain, _ := strings.Cut(user.Email, "@")
+
+	return (query.IncludeDeleted || user.DeletedAt == nil) &&
+		(query.Role == "" || user.Role == query.Role) &&
+		(query.EmailDomain == "" || strings.EqualFold(domain, query.EmailDomain)) &&
+		strings.HasPrefix(user.Nick, query.NickPrefix) &&
+		strings.Contains(user.Nick, query.NickContains) &&
+		(query.CreatedAfter.IsZero() || !user.CreatedAt.Before(query.CreatedAfter)) &&
+		(query.CreatedBefore.IsZero() || user.CreatedAt.Before(query.CreatedBefore))
 }
 
 func (m *MockStorage) GetUserById(ctx context.Context, id uuid.UUID) (models.User, error) {
@@ -35,7 +118,7 @@ func (m *MockStorage) GetUserById(ctx context.Context, id uuid.UUID) (models.Use
 	m.log.Info("Fetching user by ID", slog.String("operation", op), slog.String("userId", id.String()), slog.String("error", "nil"))
 
 	for _, v := range m.users {
-		if v.Id == id {
+		if v.Id == id && v.DeletedAt == nil {
 			m.log.Info("User found", slog.String("operation", op), slog.String("userId", id.String()), slog.String("error", "nil"), slog.Any("additional info", []map[string]interface{}{
 				{"user": v},
 			}))
@@ -49,12 +132,36 @@ func (m *MockStorage) GetUserById(ctx context.Context, id uuid.UUID) (models.Use
 	return models.User{}, err
 }
 
+func (m *MockStorage) BatchGetUsers(ctx context.Context, ids []uuid.UUID) ([]models.User, []uuid.UUID, error) {
+	const op = "storage.mock.BatchGetUsers"
+	m.log.Info("Fetching users by IDs", slog.String("operation", op), slog.Int("count", len(ids)), slog.String("error", "nil"))
+
+	var users []models.User
+	var missing []uuid.UUID
+	seen := make(map[uuid.UUID]struct{}, len(ids))
+	for _, id := range ids {
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+
+		index := slices.IndexFunc(m.users, func(v models.User) bool { return v.Id == id && v.DeletedAt == nil })
+		if index < 0 {
+			missing = append(missing, id)
+			continue
+		}
+		users = append(users, m.users[index])
+	}
+
+	return users, missing, nil
+}
+
 func (m *MockStorage) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
 	const op = "storage.mock.GetUserByEmail"
 	m.log.Info("Fetching user by email", slog.String("operation", op), slog.String("email", email), slog.String("error", "nil"))
 
 	for _, v := range m.users {
-		if v.Email == email {
+		if v.Email == email && v.DeletedAt == nil {
 			m.log.Info("User found", slog.String("operation", op), slog.String("email", email), slog.String("error", "nil"), slog.Any("additional info", []map[string]interface{}{
 				{"user": v},
 			}))
@@ -68,13 +175,17 @@ func (m *MockStorage) GetUserByEmail(ctx context.Context, email string) (models.
 	return models.User{}, err
 }
 
-func (m *MockStorage) Insert(ctx context.Context, user models.User) error {
+func (m *MockStorage) Insert(ctx context.Context, user models.User, password string) error {
 	const op = "storage.mock.Insert"
 	m.log.Info("Inserting user", slog.String("operation", op), slog.Any("additional info", []map[string]interface{}{
 		{"user": user},
 	}), slog.String("error", "nil"))
 
+	user.Version = 1
+	user.CreatedAt = time.Now()
+	user.UpdatedAt, user.UpdatedBy = user.CreatedAt, uuid.Nil
 	m.users = append(m.users, user)
+	m.passwords[user.Id] = password
 	m.log.Info("User inserted successfully", slog.String("operation", op), slog.Any("additional info", []map[string]interface{}{
 		{"user": user},
 	}), slog.String("error", "nil"))
@@ -89,7 +200,16 @@ func (m *MockStorage) Update(ctx context.Context, id uuid.UUID, user models.User
 	}), slog.String("error", "nil"))
 
 	for i, v := range m.users {
-		if v.Id == id {
+		if v.Id == id && v.DeletedAt == nil {
+			if v.Version != user.Version {
+				err := fmt.Errorf("%s: %w", op, storage.ErrConflict)
+				m.log.Warn("User version has changed", slog.String("operation", op), slog.String("userId", id.String()), slog.String("error", err.Error()))
+				return err
+			}
+
+			user.Version++
+			user.CreatedAt = v.CreatedAt
+			user.UpdatedAt, user.UpdatedBy = time.Now(), uuid.Nil
 			m.users[i] = user
 			m.log.Info("User updated successfully", slog.String("operation", op), slog.String("userId", id.String()), slog.Any("additional info", []map[string]interface{}{
 				{"user": user},
@@ -108,8 +228,11 @@ func (m *MockStorage) Delete(ctx context.Context, id uuid.UUID) (models.User, er
 	m.log.Info("Deleting user", slog.String("operation", op), slog.String("userId", id.String()), slog.String("error", "nil"))
 
 	for i, v := range m.users {
-		if v.Id == id {
-			m.users = append(m.users[:i], m.users[i+1:]...)
+		if v.Id == id && v.DeletedAt == nil {
+			deletedAt := time.Now()
+			v.DeletedAt = &deletedAt
+			v.Version++
+			m.users[i] = v
 			m.log.Info("User deleted successfully", slog.String("operation", op), slog.String("userId", id.String()), slog.Any("additional info", []map[string]interface{}{
 				{"user": v},
 			}), slog.String("error", "nil"))
@@ -121,3 +244,126 @@ func (m *MockStorage) Delete(ctx context.Context, id uuid.UUID) (models.User, er
 	m.log.Warn("User not found for deletion", slog.String("operation", op), slog.String("userId", id.String()), slog.String("error", err.Error()))
 	return models.User{}, err
 }
+
+func (m *MockStorage) RestoreUser(ctx context.Context, id uuid.UUID) (models.User, error) {
+	const op = "storage.mock.RestoreUser"
+	m.log.Info("Restoring user", slog.String("operation", op), slog.String("userId", id.String()), slog.String("error", "nil"))
+
+	for i, v := range m.users {
+		if v.Id == id && v.DeletedAt != nil {
+			v.DeletedAt = nil
+			v.Version++
+			m.users[i] = v
+			return v, nil
+		}
+	}
+
+	err := fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	m.log.Warn("No deleted user to restore", slog.String("operation", op), slog.String("userId", id.String()), slog.String("error", err.Error()))
+	return models.User{}, err
+}
+
+// ListAuditEvents returns an empty page, the mock keeps no audit log.
+func (m *MockStorage) ListAuditEvents(ctx context.Context, query models.AuditQuery, pageSize int, pageToken string) (models.AuditPage, error) {
+	const op = "storage.mock.ListAuditEvents"
+	m.log.Info("Fetching audit events", slog.String("operation", op), slog.String("error", "nil"))
+
+	return models.AuditPage{}, nil
+}
+
+func (m *MockStorage) ChangePassword(ctx context.Context, id uuid.UUID, oldPassword string, newPassword string) error {
+	const op = "storage.mock.ChangePassword"
+	m.log.Info("Changing password", slog.String("operation", op), slog.String("userId", id.String()), slog.String("error", "nil"))
+
+	password, ok := m.passwords[id]
+	if !ok || password != oldPassword {
+		err := fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+		m.log.Warn("User not found for password change", slog.String("operation", op), slog.String("userId", id.String()), slog.String("error", err.Error()))
+		return err
+	}
+
+	m.passwords[id] = newPassword
+	m.log.Info("Password changed successfully", slog.String("operation", op), slog.String("userId", id.String()), slog.String("error", "nil"))
+	return nil
+}
+
+func (m *MockStorage) Authenticate(ctx context.Context, email string, password string) error {
+	const op = "storage.mock.Authenticate"
+	m.log.Info("Authenticating", slog.String("operation", op), slog.String("email", email), slog.String("error", "nil"))
+
+	for _, v := range m.users {
+		if v.Email == email && v.DeletedAt == nil && m.passwords[v.Id] == password {
+			return nil
+		}
+	}
+
+	err := fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	m.log.Warn("Invalid credentials", slog.String("operation", op), slog.String("email", email), slog.String("error", err.Error()))
+	return err
+}
+
+// batch applies the items one by one. An atomic batch that failed is undone and its applied
+// items fail with storage.ErrBatchAborted.
+func (m *MockStorage) batch(op string, n int, mode models.BatchMode, apply func(i int) (models.User, error)) []models.BatchResult {
+	users := slices.Clone(m.users)
+	passwords := make(map[uuid.UUID]string, len(m.passwords))
+	for id, password := range m.passwords {
+		passwords[id] = password
+	}
+
+	results := make([]models.BatchResult, n)
+	failed := false
+	for i := range n {
+		user, err := apply(i)
+		results[i] = models.BatchResult{User: user, Err: err}
+		failed = failed || err != nil
+	}
+
+	if failed && mode == models.BatchAtomic {
+		m.users, m.passwords = users, passwords
+		for i, result := range results {
+			if result.Err == nil {
+				results[i] = models.BatchResult{Err: fmt.Errorf("%s: %w", op, storage.ErrBatchAborted)}
+			}
+		}
+		m.log.Warn("Batch aborted", slog.String("operation", op), slog.Int("count", n))
+	}
+
+	return results
+}
+
+func (m *MockStorage) BatchInsertUsers(ctx context.Context, items []models.BatchInsertItem, mode models.BatchMode) ([]models.BatchResult, error) {
+	const op = "storage.mock.BatchInsertUsers"
+
+	return m.batch(op, len(items), mode, func(i int) (models.User, error) {
+		for _, v := range m.users {
+			if v.Id == items[i].User.Id || v.Email == items[i].User.Email && v.DeletedAt == nil {
+				return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+			}
+		}
+
+		if err := m.Insert(ctx, items[i].User, items[i].Password); err != nil {
+			return models.User{}, err
+		}
+		return m.users[len(m.users)-1], nil
+	}), nil
+}
+
+func (m *MockStorage) BatchUpdateUsers(ctx context.Context, users []models.User, mode models.BatchMode) ([]models.BatchResult, error) {
+	const op = "storage.mock.BatchUpdateUsers"
+
+	return m.batch(op, len(users), mode, func(i int) (models.User, error) {
+		if err := m.Update(ctx, users[i].Id, users[i]); err != nil {
+			return models.User{}, err
+		}
+		return m.GetUserById(ctx, users[i].Id)
+	}), nil
+}
+
+func (m *MockStorage) BatchDeleteUsers(ctx context.Context, uids []uuid.UUID, mode models.BatchMode) ([]models.BatchResult, error) {
+	const op = "storage.mock.BatchDeleteUsers"
+
+	return m.batch(op, len(uids), mode, func(i int) (models.User, error) {
+		return m.Delete(ctx, uids[i])
+	}), nil
+}
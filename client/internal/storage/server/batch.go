@@ -0,0 +1,177 @@
+package server
+
+import (
+	"client/internal/domain/models"
+	"client/internal/domain/profilers"
+	"context"
+	"fmt"
+
+	umv1 "github.com/chas3air/protos/gen/go/usersManager"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// BatchGetUsers implements interfaces.ServerUserFetcher.
+func (s *ServerUsersStorage) BatchGetUsers(ctx context.Context, uids []uuid.UUID) ([]models.User, []uuid.UUID, error) {
+	const op = "storage.server.batchGetUsers"
+	conn, err := grpc.NewClient(
+		fmt.Sprintf("%s:%d", s.ServerHost, s.ServerPort),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		s.log.Error(fmt.Sprintf("%s: %v", op, err))
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer conn.Close()
+
+	ids := make([]string, 0, len(uids))
+	for _, uid := range uids {
+		ids = append(ids, uid.String())
+	}
+
+	c := umv1.NewUsersManagerClient(conn)
+	res, err := c.BatchGetUsers(s.withToken(ctx), &umv1.BatchGetUsersRequest{
+		Ids: ids,
+	})
+	if err != nil {
+		s.log.Error(fmt.Sprintf("%s: %v", op, err))
+		return nil, nil, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	users := make([]models.User, 0, len(res.GetUsers()))
+	for _, proto_user := range res.GetUsers() {
+		user, err := profilers.ProtoUsrToUsr(proto_user)
+		if err != nil {
+			s.log.Error(fmt.Sprintf("%s: failed to convert proto user to model user: %v", op, err))
+			return nil, nil, fmt.Errorf("%s: %w", op, err)
+		}
+		users = append(users, user)
+	}
+
+	missing := make([]uuid.UUID, 0, len(res.GetMissingIds()))
+	for _, id := range res.GetMissingIds() {
+		uid, err := uuid.Parse(id)
+		if err != nil {
+			s.log.Error(fmt.Sprintf("%s: invalid missing id: %v", op, err))
+			return nil, nil, fmt.Errorf("%s: %w", op, err)
+		}
+		missing = append(missing, uid)
+	}
+
+	return users, missing, nil
+}
+
+// BatchInsertUsers implements interfaces.ServerUserFetcher.
+func (s *ServerUsersStorage) BatchInsertUsers(ctx context.Context, items []models.BatchInsertItem, mode models.BatchMode) ([]models.BatchResult, error) {
+	const op = "storage.server.batchInsertUsers"
+	conn, err := grpc.NewClient(
+		fmt.Sprintf("%s:%d", s.ServerHost, s.ServerPort),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		s.log.Error(fmt.Sprintf("%s: %v", op, err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer conn.Close()
+
+	users := make([]*umv1.User, 0, len(items))
+	for _, item := range items {
+		users = append(users, profilers.UsrToProroUsr(item.User, item.Password))
+	}
+
+	c := umv1.NewUsersManagerClient(conn)
+	res, err := c.BatchInsertUsers(s.withToken(ctx), &umv1.BatchInsertUsersRequest{
+		Users: users,
+		Mode:  profilers.BatchModeToProto(mode),
+	})
+	if err != nil {
+		s.log.Error(fmt.Sprintf("%s: %v", op, err))
+		return nil, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	return s.batchResults(op, res.GetResults())
+}
+
+// BatchUpdateUsers implements interfaces.ServerUserFetcher.
+func (s *ServerUsersStorage) BatchUpdateUsers(ctx context.Context, users []models.User, mode models.BatchMode) ([]models.BatchResult, error) {
+	const op = "storage.server.batchUpdateUsers"
+	conn, err := grpc.NewClient(
+		fmt.Sprintf("%s:%d", s.ServerHost, s.ServerPort),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		s.log.Error(fmt.Sprintf("%s: %v", op, err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer conn.Close()
+
+	proto_users := make([]*umv1.User, 0, len(users))
+	for _, user := range users {
+		proto_users = append(proto_users, profilers.UsrToProroUsr(user, ""))
+	}
+
+	c := umv1.NewUsersManagerClient(conn)
+	res, err := c.BatchUpdateUsers(s.withToken(ctx), &umv1.BatchUpdateUsersRequest{
+		Users: proto_users,
+		Mode:  profilers.BatchModeToProto(mode),
+	})
+	if err != nil {
+		s.log.Error(fmt.Sprintf("%s: %v", op, err))
+		return nil, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	return s.batchResults(op, res.GetResults())
+}
+
+// BatchDeleteUsers implements interfaces.ServerUserFetcher.
+func (s *ServerUsersStorage) BatchDeleteUsers(ctx context.Context, uids []uuid.UUID, mode models.BatchMode) ([]models.BatchResult, error) {
+	const op = "storage.server.batchDeleteUsers"
+	conn, err := grpc.NewClient(
+		fmt.Sprintf("%s:%d", s.ServerHost, s.ServerPort),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		s.log.Error(fmt.Sprintf("%s: %v", op, err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer conn.Close()
+
+	ids := make([]string, 0, len(uids))
+	for _, uid := range uids {
+		ids = append(ids, uid.String())
+	}
+
+	c := umv1.NewUsersManagerClient(conn)
+	res, err := c.BatchDeleteUsers(s.withToken(ctx), &umv1.BatchDeleteUsersRequest{
+		Ids:  ids,
+		Mode: profilers.BatchModeToProto(mode),
+	})
+	if err != nil {
+		s.log.Error(fmt.Sprintf("%s: %v", op, err))
+		return nil, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	return s.batchResults(op, res.GetResults())
+}
+
+// batchResults converts the per-item results of a batch, in the order of the request.
+func (s *ServerUsersStorage) batchResults(op string, proto_results []*umv1.BatchItemResult) ([]models.BatchResult, error) {
+	results := make([]models.BatchResult, 0, len(proto_results))
+	for _, proto_result := range proto_results {
+		if err := batchItemError(proto_result.GetStatus()); err != nil {
+			results = append(results, models.BatchResult{Err: err})
+			continue
+		}
+
+		user, err := profilers.ProtoUsrToUsr(proto_result.GetUser())
+		if err != nil {
+			s.log.Error(fmt.Sprintf("%s: failed to convert proto user to model user: %v", op, err))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		results = append(results, models.BatchResult{User: user})
+	}
+
+	return results, nil
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"client/internal/storage"
+	"fmt"
+
+	umv1 "github.com/chas3air/protos/gen/go/usersManager"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var codeErrors = map[codes.Code]error{
+	codes.NotFound:         storage.ErrUserNotFound,
+	codes.AlreadyExists:    storage.ErrUserExists,
+	codes.InvalidArgument:  storage.ErrInvalidArgument,
+	codes.Aborted:          storage.ErrConflict,
+	codes.Unavailable:      storage.ErrUnavailable,
+	codes.PermissionDenied: storage.ErrPermissionDenied,
+	codes.Unauthenticated:  storage.ErrUnauthenticated,
+}
+
+// mapError translates a gRPC status returned by the server into the client storage errors,
+// keeping the server message. Other errors are returned unchanged.
+func mapError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+
+	if st.Code() == codes.InvalidArgument {
+		if violations := fieldViolations(st); len(violations) > 0 {
+			return &storage.ValidationError{
+				Message:    st.Message(),
+				Violations: violations,
+			}
+		}
+	}
+
+	if target, ok := codeErrors[st.Code()]; ok {
+		return fmt.Errorf("%w: %s", target, st.Message())
+	}
+
+	return err
+}
+
+// reasonBatchAborted is the reason the server gives for the items of a failed atomic batch.
+const reasonBatchAborted = "BATCH_ABORTED"
+
+// batchItemError translates the status of one batch item the way mapError does, nil for an
+// applied item.
+func batchItemError(st *umv1.BatchItemStatus) error {
+	code := codes.Code(st.GetCode())
+	if code == codes.OK {
+		return nil
+	}
+
+	if st.GetReason() == reasonBatchAborted {
+		return fmt.Errorf("%w: %s", storage.ErrBatchAborted, st.GetMessage())
+	}
+
+	if code == codes.InvalidArgument && len(st.GetViolations()) > 0 {
+		violations := make([]storage.FieldViolation, 0, len(st.GetViolations()))
+		for _, v := range st.GetViolations() {
+			violations = append(violations, storage.FieldViolation{
+				Field:       v.GetField(),
+				Description: v.GetDescription(),
+			})
+		}
+
+		return &storage.ValidationError{
+			Message:    st.GetMessage(),
+			Violations: violations,
+		}
+	}
+
+	if target, ok := codeErrors[code]; ok {
+		return fmt.Errorf("%w: %s", target, st.GetMessage())
+	}
+
+	return status.Error(code, st.GetMessage())
+}
+
+func fieldViolations(st *status.Status) []storage.FieldViolation {
+	var violations []storage.FieldViolation
+	for _, detail := range st.Details() {
+		badRequest, ok := detail.(*errdetails.BadRequest)
+		if !ok {
+			continue
+		}
+
+		for _, v := range badRequest.GetFieldViolations() {
+			violations = append(violations, storage.FieldViolation{
+				Field:       v.GetField(),
+				Description: v.GetDescription(),
+			})
+		}
+	}
+
+	return violations
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"client/internal/storage"
+	"errors"
+	"testing"
+
+	umv1 "github.com/chas3air/protos/gen/go/usersManager"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// serverStatus builds a status the way the server does, with an ErrorInfo
+// and the BadRequest of the violated fields.
+func serverStatus(t *testing.T, code codes.Code, reason string, violations ...*errdetails.BadRequest_FieldViolation) error {
+	t.Helper()
+
+	st := status.New(code, "server message")
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: reason, Domain: "usersmanager"}}
+	if len(violations) > 0 {
+		details = append(details, &errdetails.BadRequest{FieldViolations: violations})
+	}
+
+	st, err := st.WithDetails(details...)
+	if err != nil {
+		t.Fatalf("WithDetails() error = %v", err)
+	}
+	return st.Err()
+}
+
+func TestMapError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		target error
+	}{
+		{name: "not found", err: serverStatus(t, codes.NotFound, "USER_NOT_FOUND"), target: storage.ErrUserNotFound},
+		{name: "exists", err: serverStatus(t, codes.AlreadyExists, "USER_EXISTS"), target: storage.ErrUserExists},
+		{name: "conflict", err: serverStatus(t, codes.Aborted, "CONFLICT"), target: storage.ErrConflict},
+		{name: "invalid argument", err: serverStatus(t, codes.InvalidArgument, "VALIDATION_FAILED"), target: storage.ErrInvalidArgument},
+		{name: "unavailable", err: serverStatus(t, codes.Unavailable, "STORAGE_UNAVAILABLE"), target: storage.ErrUnavailable},
+		{name: "permission denied", err: serverStatus(t, codes.PermissionDenied, "PERMISSION_DENIED"), target: storage.ErrPermissionDenied},
+		{name: "unauthenticated", err: serverStatus(t, codes.Unauthenticated, "INVALID_CREDENTIALS"), target: storage.ErrUnauthenticated},
+		{name: "without details", err: status.Error(codes.NotFound, "user not found"), target: storage.ErrUserNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := mapError(tt.err)
+			if !errors.Is(err, tt.target) {
+				t.Errorf("mapError() = %v, want errors.Is %v", err, tt.target)
+			}
+			if err.Error() != tt.target.Error()+": "+status.Convert(tt.err).Message() {
+				t.Errorf("mapError() message = %q, want the server message", err.Error())
+			}
+		})
+	}
+}
+
+func TestMapErrorValidation(t *testing.T) {
+	err := mapError(serverStatus(t, codes.InvalidArgument, "VALIDATION_FAILED",
+		&errdetails.BadRequest_FieldViolation{Field: "email", Description: "is required"},
+		&errdetails.BadRequest_FieldViolation{Field: "nick", Description: "is required"},
+	))
+
+	var validationErr *storage.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("mapError() = %v, want *storage.ValidationError", err)
+	}
+	if !errors.Is(err, storage.ErrInvalidArgument) {
+		t.Errorf("mapError() = %v, want errors.Is %v", err, storage.ErrInvalidArgument)
+	}
+
+	want := []storage.FieldViolation{{Field: "email", Description: "is required"}, {Field: "nick", Description: "is required"}}
+	if len(validationErr.Violations) != len(want) {
+		t.Fatalf("violations = %v, want %v", validationErr.Violations, want)
+	}
+	for i := range want {
+		if validationErr.Violations[i] != want[i] {
+			t.Errorf("violations[%d] = %v, want %v", i, validationErr.Violations[i], want[i])
+		}
+	}
+}
+
+func TestMapErrorUnmapped(t *testing.T) {
+	internal := status.Error(codes.Internal, "failed to get users")
+	if err := mapError(internal); err != internal {
+		t.Errorf("mapError() of an internal error = %v, want it unchanged", err)
+	}
+
+	plain := errors.New("dial tcp: connection refused")
+	if err := mapError(plain); err != plain {
+		t.Errorf("mapError() of a non-status error = %v, want it unchanged", err)
+	}
+}
+
+func TestBatchItemError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status *umv1.BatchItemStatus
+		target error
+	}{
+		{name: "not found", status: &umv1.BatchItemStatus{Code: int32(codes.NotFound), Reason: "USER_NOT_FOUND"}, target: storage.ErrUserNotFound},
+		{name: "exists", status: &umv1.BatchItemStatus{Code: int32(codes.AlreadyExists), Reason: "USER_EXISTS"}, target: storage.ErrUserExists},
+		{name: "conflict", status: &umv1.BatchItemStatus{Code: int32(codes.Aborted), Reason: "CONFLICT"}, target: storage.ErrConflict},
+		{name: "batch aborted", status: &umv1.BatchItemStatus{Code: int32(codes.Aborted), Reason: "BATCH_ABORTED"}, target: storage.ErrBatchAborted},
+		{name: "validation", status: &umv1.BatchItemStatus{
+			Code:       int32(codes.InvalidArgument),
+			Reason:     "VALIDATION_FAILED",
+			Violations: []*umv1.FieldViolation{{Field: "email", Description: "is required"}},
+		}, target: storage.ErrInvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := batchItemError(tt.status); !errors.Is(err, tt.target) {
+				t.Errorf("batchItemError() = %v, want errors.Is %v", err, tt.target)
+			}
+		})
+	}
+
+	if err := batchItemError(&umv1.BatchItemStatus{Code: int32(codes.Aborted), Reason: "BATCH_ABORTED"}); errors.Is(err, storage.ErrConflict) {
+		t.Errorf("batchItemError() of an aborted item = %v, want it apart from %v", err, storage.ErrConflict)
+	}
+	if err := batchItemError(&umv1.BatchItemStatus{Code: int32(codes.OK)}); err != nil {
+		t.Errorf("batchItemError() of an applied item = %v, want nil", err)
+	}
+	if err := batchItemError(&umv1.BatchItemStatus{Code: int32(codes.Internal), Message: "boom"}); status.Code(err) != codes.Internal {
+		t.Errorf("batchItemError() of an internal error = %v, want code %v", err, codes.Internal)
+	}
+}
@@ -3,8 +3,11 @@ package server
 import (
 	"client/internal/domain/models"
 	"client/internal/domain/profilers"
+	"client/internal/storage"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 
 	umv1 "github.com/chas3air/protos/gen/go/usersManager"
@@ -12,12 +15,14 @@ import (
 	"github.com/google/uuid"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 )
 
 type ServerUsersStorage struct {
 	log        *slog.Logger
 	ServerHost string
 	ServerPort int
+	token      string
 }
 
 func New(log *slog.Logger, host string, port int) *ServerUsersStorage {
@@ -28,23 +33,65 @@ func New(log *slog.Logger, host string, port int) *ServerUsersStorage {
 	}
 }
 
-func (s ServerUsersStorage) GetUsers(ctx context.Context) ([]models.User, error) {
+// withToken attaches the access token received from Authenticate to the outgoing call.
+func (s *ServerUsersStorage) withToken(ctx context.Context) context.Context {
+	if s.token == "" {
+		return ctx
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+s.token)
+}
+
+// Authenticate logs in with the given credentials and keeps the issued token for subsequent calls.
+func (s *ServerUsersStorage) Authenticate(ctx context.Context, email string, password string) error {
+	const op = "storage.server.authenticate"
+	conn, err := grpc.NewClient(
+		fmt.Sprintf("%s:%d", s.ServerHost, s.ServerPort),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		s.log.Error(fmt.Sprintf("%s: %v", op, err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer conn.Close()
+
+	c := umv1.NewUsersManagerClient(conn)
+	res, err := c.Authenticate(ctx, &umv1.AuthenticateRequest{
+		Email:    email,
+		Password: password,
+	})
+	if err != nil {
+		s.log.Error(fmt.Sprintf("%s: %v", op, err))
+		return fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	s.token = res.GetToken()
+	return nil
+}
+
+func (s *ServerUsersStorage) GetUsers(ctx context.Context, query models.UsersQuery, pageSize int, pageToken string) (models.UsersPage, error) {
 	const op = "storage.server.getUsers"
+	req, err := profilers.UsersQueryToProto(query, pageSize, pageToken)
+	if err != nil {
+		s.log.Error(fmt.Sprintf("%s: %v", op, err))
+		return models.UsersPage{}, fmt.Errorf("%s: %w: %w", op, storage.ErrInvalidArgument, err)
+	}
+
 	conn, err := grpc.NewClient(
 		fmt.Sprintf("%s:%d", s.ServerHost, s.ServerPort),
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
 	)
 	if err != nil {
 		s.log.Error(fmt.Sprintf("%s: %v", op, err))
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return models.UsersPage{}, fmt.Errorf("%s: %w", op, err)
 	}
 	defer conn.Close()
 
 	c := umv1.NewUsersManagerClient(conn)
-	res, err := c.GetUsers(ctx, nil)
+	res, err := c.GetUsers(s.withToken(ctx), req)
 	if err != nil {
 		s.log.Error(fmt.Sprintf("%s: %v", op, err))
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return models.UsersPage{}, fmt.Errorf("%s: %w", op, mapError(err))
 	}
 
 	var res_users []models.User = make([]models.User, 0, len(res.Users))
@@ -57,10 +104,66 @@ func (s ServerUsersStorage) GetUsers(ctx context.Context) ([]models.User, error)
 		res_users = append(res_users, user)
 	}
 
-	return res_users, nil
+	return models.UsersPage{
+		Users:         res_users,
+		NextPageToken: res.GetNextPageToken(),
+	}, nil
 }
 
-func (s ServerUsersStorage) GetUserById(ctx context.Context, uid uuid.UUID) (models.User, error) {
+// StreamUsers receives the users one message at a time and passes each to fn
+// before reading the next one, so a slow fn slows the server down instead of
+// growing a buffer.
+func (s *ServerUsersStorage) StreamUsers(ctx context.Context, query models.UsersQuery, fn func(models.User) error) error {
+	const op = "storage.server.streamUsers"
+	req, err := profilers.UsersQueryToStreamProto(query)
+	if err != nil {
+		s.log.Error(fmt.Sprintf("%s: %v", op, err))
+		return fmt.Errorf("%s: %w: %w", op, storage.ErrInvalidArgument, err)
+	}
+
+	conn, err := grpc.NewClient(
+		fmt.Sprintf("%s:%d", s.ServerHost, s.ServerPort),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		s.log.Error(fmt.Sprintf("%s: %v", op, err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	c := umv1.NewUsersManagerClient(conn)
+	stream, err := c.StreamUsers(s.withToken(ctx), req)
+	if err != nil {
+		s.log.Error(fmt.Sprintf("%s: %v", op, err))
+		return fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	for {
+		res, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			s.log.Error(fmt.Sprintf("%s: %v", op, err))
+			return fmt.Errorf("%s: %w", op, mapError(err))
+		}
+
+		user, err := profilers.ProtoUsrToUsr(res.GetUser())
+		if err != nil {
+			s.log.Error(fmt.Sprintf("%s: failed to convert proto user to model user: %v", op, err))
+			continue
+		}
+
+		if err := fn(user); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+}
+
+func (s *ServerUsersStorage) GetUserById(ctx context.Context, uid uuid.UUID) (models.User, error) {
 	const op = "storage.server.getUserById"
 	conn, err := grpc.NewClient(
 		fmt.Sprintf("%s:%d", s.ServerHost, s.ServerPort),
@@ -73,12 +176,12 @@ func (s ServerUsersStorage) GetUserById(ctx context.Context, uid uuid.UUID) (mod
 	defer conn.Close()
 
 	c := umv1.NewUsersManagerClient(conn)
-	res, err := c.GetUserById(ctx, &umv1.GetUserByIdRequest{
+	res, err := c.GetUserById(s.withToken(ctx), &umv1.GetUserByIdRequest{
 		Id: uid.String(),
 	})
 	if err != nil {
 		s.log.Error(fmt.Sprintf("%s: %v", op, err))
-		return models.User{}, fmt.Errorf("%s: %w", op, err)
+		return models.User{}, fmt.Errorf("%s: %w", op, mapError(err))
 	}
 
 	user, err := profilers.ProtoUsrToUsr(res.GetUser())
@@ -90,7 +193,7 @@ func (s ServerUsersStorage) GetUserById(ctx context.Context, uid uuid.UUID) (mod
 	return user, nil
 }
 
-func (s ServerUsersStorage) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+func (s *ServerUsersStorage) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
 	const op = "storage.server.getUserByEmail"
 	conn, err := grpc.NewClient(
 		fmt.Sprintf("%s:%d", s.ServerHost, s.ServerPort),
@@ -103,12 +206,12 @@ func (s ServerUsersStorage) GetUserByEmail(ctx context.Context, email string) (m
 	defer conn.Close()
 
 	c := umv1.NewUsersManagerClient(conn)
-	res, err := c.GetUserByEmail(ctx, &umv1.GetUserByEmailRequest{
+	res, err := c.GetUserByEmail(s.withToken(ctx), &umv1.GetUserByEmailRequest{
 		Email: email,
 	})
 	if err != nil {
 		s.log.Error(fmt.Sprintf("%s: %v", op, err))
-		return models.User{}, fmt.Errorf("%s: %w", op, err)
+		return models.User{}, fmt.Errorf("%s: %w", op, mapError(err))
 	}
 
 	user, err := profilers.ProtoUsrToUsr(res.GetUser())
@@ -120,7 +223,7 @@ func (s ServerUsersStorage) GetUserByEmail(ctx context.Context, email string) (m
 	return user, nil
 }
 
-func (s ServerUsersStorage) Insert(ctx context.Context, user models.User) error {
+func (s *ServerUsersStorage) Insert(ctx context.Context, user models.User, password string) error {
 	const op = "storage.server.insert"
 	conn, err := grpc.NewClient(
 		fmt.Sprintf("%s:%d", s.ServerHost, s.ServerPort),
@@ -133,18 +236,18 @@ func (s ServerUsersStorage) Insert(ctx context.Context, user models.User) error
 	defer conn.Close()
 
 	c := umv1.NewUsersManagerClient(conn)
-	_, err = c.Insert(ctx, &umv1.InsertRequest{
-		User: profilers.UsrToProroUsr(user),
+	_, err = c.Insert(s.withToken(ctx), &umv1.InsertRequest{
+		User: profilers.UsrToProroUsr(user, password),
 	})
 	if err != nil {
 		s.log.Error(fmt.Sprintf("%s: %v", op, err))
-		return fmt.Errorf("%s: %w", op, err)
+		return fmt.Errorf("%s: %w", op, mapError(err))
 	}
 
 	return nil
 }
 
-func (s ServerUsersStorage) Update(ctx context.Context, uid uuid.UUID, user models.User) error {
+func (s *ServerUsersStorage) Update(ctx context.Context, uid uuid.UUID, user models.User) error {
 	const op = "storage.server.update"
 	conn, err := grpc.NewClient(
 		fmt.Sprintf("%s:%d", s.ServerHost, s.ServerPort),
@@ -157,20 +260,20 @@ func (s ServerUsersStorage) Update(ctx context.Context, uid uuid.UUID, user mode
 	defer conn.Close()
 
 	c := umv1.NewUsersManagerClient(conn)
-	_, err = c.Update(ctx, &umv1.UpdateRequest{
+	_, err = c.Update(s.withToken(ctx), &umv1.UpdateRequest{
 		Id:   uid.String(),
-		User: profilers.UsrToProroUsr(user),
+		User: profilers.UsrToProroUsr(user, ""),
 	})
 	if err != nil {
 		s.log.Error(fmt.Sprintf("%s: %v", op, err))
-		return fmt.Errorf("%s: %w", op, err)
+		return fmt.Errorf("%s: %w", op, mapError(err))
 	}
 
 	return nil
 }
 
 // Delete implements interfaces.ServerUserFetcher.
-func (s ServerUsersStorage) Delete(ctx context.Context, uid uuid.UUID) (models.User, error) {
+func (s *ServerUsersStorage) Delete(ctx context.Context, uid uuid.UUID) (models.User, error) {
 	const op = "storage.server.delete"
 	conn, err := grpc.NewClient(
 		fmt.Sprintf("%s:%d", s.ServerHost, s.ServerPort),
@@ -183,13 +286,70 @@ func (s ServerUsersStorage) Delete(ctx context.Context, uid uuid.UUID) (models.U
 	defer conn.Close()
 
 	c := umv1.NewUsersManagerClient(conn)
-	res, err := c.Delete(ctx, &umv1.DeleteRequest{
+	res, err := c.Delete(s.withToken(ctx), &umv1.DeleteRequest{
 		Id: uid.String(),
 	})
+	if err != nil {
+		s.log.Error(fmt.Sprintf("%s: %v", op, err))
+		return models.User{}, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	user, err := profilers.ProtoUsrToUsr(res.GetUser())
+	if err != nil {
+		s.log.Error(fmt.Sprintf("%s: failed to convert proto user to model user: %v", op, err))
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+func (s *ServerUsersStorage) ChangePassword(ctx context.Context, uid uuid.UUID, oldPassword string, newPassword string) error {
+	const op = "storage.server.changePassword"
+	conn, err := grpc.NewClient(
+		fmt.Sprintf("%s:%d", s.ServerHost, s.ServerPort),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		s.log.Error(fmt.Sprintf("%s: %v", op, err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer conn.Close()
+
+	c := umv1.NewUsersManagerClient(conn)
+	_, err = c.ChangePassword(s.withToken(ctx), &umv1.ChangePasswordRequest{
+		Id:          uid.String(),
+		OldPassword: oldPassword,
+		NewPassword: newPassword,
+	})
+	if err != nil {
+		s.log.Error(fmt.Sprintf("%s: %v", op, err))
+		return fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	return nil
+}
+
+// RestoreUser implements interfaces.ServerUserFetcher.
+func (s *ServerUsersStorage) RestoreUser(ctx context.Context, uid uuid.UUID) (models.User, error) {
+	const op = "storage.server.restoreUser"
+	conn, err := grpc.NewClient(
+		fmt.Sprintf("%s:%d", s.ServerHost, s.ServerPort),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
 	if err != nil {
 		s.log.Error(fmt.Sprintf("%s: %v", op, err))
 		return models.User{}, fmt.Errorf("%s: %w", op, err)
 	}
+	defer conn.Close()
+
+	c := umv1.NewUsersManagerClient(conn)
+	res, err := c.RestoreUser(s.withToken(ctx), &umv1.RestoreUserRequest{
+		Id: uid.String(),
+	})
+	if err != nil {
+		s.log.Error(fmt.Sprintf("%s: %v", op, err))
+		return models.User{}, fmt.Errorf("%s: %w", op, mapError(err))
+	}
 
 	user, err := profilers.ProtoUsrToUsr(res.GetUser())
 	if err != nil {
@@ -199,3 +359,39 @@ func (s ServerUsersStorage) Delete(ctx context.Context, uid uuid.UUID) (models.U
 
 	return user, nil
 }
+
+// ListAuditEvents implements interfaces.ServerUserFetcher.
+func (s *ServerUsersStorage) ListAuditEvents(ctx context.Context, query models.AuditQuery, pageSize int, pageToken string) (models.AuditPage, error) {
+	const op = "storage.server.listAuditEvents"
+	conn, err := grpc.NewClient(
+		fmt.Sprintf("%s:%d", s.ServerHost, s.ServerPort),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		s.log.Error(fmt.Sprintf("%s: %v", op, err))
+		return models.AuditPage{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer conn.Close()
+
+	c := umv1.NewUsersManagerClient(conn)
+	res, err := c.ListAuditEvents(s.withToken(ctx), profilers.AuditQueryToProto(query, pageSize, pageToken))
+	if err != nil {
+		s.log.Error(fmt.Sprintf("%s: %v", op, err))
+		return models.AuditPage{}, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	events := make([]models.AuditEvent, 0, len(res.GetEvents()))
+	for _, pb_event := range res.GetEvents() {
+		event, err := profilers.ProtoAuditEventToAuditEvent(pb_event)
+		if err != nil {
+			s.log.Error(fmt.Sprintf("%s: failed to convert proto audit event: %v", op, err))
+			continue
+		}
+		events = append(events, event)
+	}
+
+	return models.AuditPage{
+		Events:        events,
+		NextPageToken: res.GetNextPageToken(),
+	}, nil
+}
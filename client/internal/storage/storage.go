@@ -3,6 +3,33 @@ package storage
 import "errors"
 
 var (
-	ErrUserNotFound = errors.New("user not found")
-	ErrUserExists   = errors.New("user already exists")
+	ErrUserNotFound     = errors.New("user not found")
+	ErrUserExists       = errors.New("user already exists")
+	ErrInvalidArgument  = errors.New("invalid argument")
+	ErrConflict         = errors.New("user was modified concurrently")
+	ErrUnavailable      = errors.New("server unavailable")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrUnauthenticated  = errors.New("unauthenticated")
+	// ErrBatchAborted is the error of a batch item that was not applied
+	// because another item of the atomic batch failed.
+	ErrBatchAborted = errors.New("batch aborted")
 )
+
+type FieldViolation struct {
+	Field       string
+	Description string
+}
+
+// ValidationError is returned when the server rejected some of the fields sent to it.
+type ValidationError struct {
+	Message    string
+	Violations []FieldViolation
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrInvalidArgument
+}
@@ -14,6 +14,7 @@ type Config struct {
 	Host           string        `yaml:"host"`
 	Port           int           `yaml:"port"`
 	ExpirationTime time.Duration `yaml:"expiration_time"`
+	PageSize       int           `yaml:"page_size" env-default:"10"`
 }
 
 func MustLoad() *Config {
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"log/slog"
 	"os"
 	"os/signal"
@@ -15,13 +16,22 @@ func main() {
 
 	log := logger.SetupLogger(cfg.Env)
 
+	// The config flag comes first: cli --config=path migrate up
+	if args := flag.Args(); len(args) > 0 && args[0] == "migrate" {
+		os.Exit(migrate(log, cfg, args[1:]))
+	}
+
 	log.Info("starting application", slog.Any("config:", cfg))
 
-	application := app.New(log, cfg.Grpc.Port)
+	application := app.New(log, cfg)
 
 	go func() {
 		application.GRPCServer.MustRun()
 	}()
+	go application.Purger.Run()
+	if application.StorageService != nil {
+		go application.StorageService.Run()
+	}
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
@@ -29,5 +39,9 @@ func main() {
 	<-stop
 
 	application.GRPCServer.Stop()
+	application.Purger.Stop()
+	if application.StorageService != nil {
+		application.StorageService.Stop()
+	}
 	log.Info("application stopped")
 }
@@ -1,29 +1,223 @@
 package app
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
 	"log/slog"
 	grpcapp "server/internal/app/grpc"
 	"server/internal/domain/interfaces"
+	"server/internal/domain/validation"
+	"server/internal/services/authz"
+	"server/internal/services/purger"
 	"server/internal/services/usersmanager"
-	"server/internal/storage/mock"
+	"server/internal/storage/cache"
+	"server/internal/storage/file"
+	"server/internal/storage/memory"
 	psql "server/internal/storage/postgres"
+	"server/internal/storage/postgres/migrations"
+	"server/internal/storage/supervisor"
+	"server/pkg/config"
+	"server/pkg/lib/backoff"
+	"server/pkg/lib/email"
+	"server/pkg/lib/hasher"
+	"server/pkg/lib/logger/sl"
 )
 
+// Service is a background job run along with the gRPC server.
+type Service interface {
+	Run()
+	Stop()
+}
+
 type App struct {
 	GRPCServer *grpcapp.App
+	Purger     *purger.Purger
+	// StorageService keeps the storage backend going, e.g. reconnects the
+	// database. It is nil for backends that need nothing in the background.
+	StorageService Service
 }
 
-func New(log *slog.Logger, port int) *App {
-	//storage := mock.New(log)
+func New(log *slog.Logger, cfg *config.Config) *App {
+	if err := config.CheckTokenSecret(cfg.Auth.TokenSecret); err != nil {
+		panic("invalid auth token secret: " + err.Error())
+	}
+
 	var storage interfaces.Storage
-	storage, err := psql.New("psql", "postgres", "123", 5432, "psql", "Users", log)
+	var storageService Service
+	switch cfg.Storage.Backend {
+	case config.BackendPostgres:
+		storageSupervisor := newPostgresSupervisor(log, cfg)
+		if err := storageSupervisor.Connect(context.Background()); err != nil {
+			log.Error("cannot connect to postgres, starting degraded until it is reachable", sl.Err(err))
+		}
+		storage, storageService = storageSupervisor, storageSupervisor
+	case config.BackendMemory:
+		storage = memory.New(log)
+	case config.BackendFile:
+		fileStorage, err := file.Open(log, file.Options{
+			Dir:              cfg.Storage.File.Dir,
+			Fsync:            cfg.Storage.File.Fsync,
+			FsyncInterval:    cfg.Storage.File.FsyncInterval,
+			SnapshotInterval: cfg.Storage.File.SnapshotInterval,
+			SnapshotRecords:  cfg.Storage.File.SnapshotRecords,
+		})
+		if err != nil {
+			panic("cannot open file storage: " + err.Error())
+		}
+		storage, storageService = fileStorage, fileStorage
+	default:
+		panic("unknown storage backend: " + cfg.Storage.Backend)
+	}
+
+	if cfg.Storage.Cache.Enabled {
+		storage = cache.New(storage, cfg.Storage.Cache.Size, cfg.Storage.Cache.TTL)
+	}
+
+	health := storage.Health(context.Background())
+	log.Info("storage backend selected", slog.String("backend", health.Backend), slog.Bool("degraded", health.Degraded))
+
+	hasher := hasher.New(hasher.Params{
+		Memory:      cfg.Password.Memory,
+		Iterations:  cfg.Password.Iterations,
+		Parallelism: cfg.Password.Parallelism,
+		SaltLength:  cfg.Password.SaltLength,
+		KeyLength:   cfg.Password.KeyLength,
+	})
+	policy, err := authz.NewPolicy(cfg.Authz.Roles)
 	if err != nil {
-		storage = mock.New(log)
+		panic("invalid authz config: " + err.Error())
 	}
-	usersmanager := usersmanager.New(log, storage)
 
-	grpcapp := grpcapp.New(log, usersmanager, port)
+	validator := validation.New(policy.Roles())
+	normalizer := email.New(cfg.Email.FoldPlusAddress)
+	usersmanager := usersmanager.New(log, storage, hasher, validator, normalizer, cfg.Auth.TokenSecret, cfg.Auth.TokenTTL)
+	authorizedUsersManager := authz.New(log, usersmanager, policy, normalizer)
+
+	grpcapp := grpcapp.New(log, authorizedUsersManager, cfg.Grpc.Port, cfg.Auth.TokenSecret)
+	purger := purger.New(log, storage, cfg.SoftDelete.Retention, cfg.SoftDelete.PurgeInterval)
 	return &App{
-		GRPCServer: grpcapp,
+		GRPCServer:     grpcapp,
+		Purger:         purger,
+		StorageService: storageService,
+	}
+}
+
+// usersTable is the table created by the migrations.
+const usersTable = "Users"
+
+func postgresConfig(cfg config.PostgresConfig) psql.Config {
+	return psql.Config{
+		Host:            cfg.Host,
+		Port:            cfg.Port,
+		User:            cfg.User,
+		Password:        cfg.Password,
+		DBName:          cfg.DBName,
+		SSLMode:         cfg.SSLMode,
+		Schema:          cfg.Schema,
+		MaxOpenConns:    cfg.MaxOpenConns,
+		MaxIdleConns:    cfg.MaxIdleConns,
+		ConnMaxLifetime: cfg.ConnMaxLifetime,
+		ConnectTimeout:  cfg.ConnectTimeout,
+	}
+}
+
+// OpenPostgres connects to the users database through database/sql.
+func OpenPostgres(log *slog.Logger, cfg config.PostgresConfig) (*psql.PostgresDB, error) {
+	return psql.New(postgresConfig(cfg), usersTable, log)
+}
+
+// OpenPgx connects a pgx pool to the users database.
+func OpenPgx(log *slog.Logger, cfg config.PostgresConfig) (*psql.PgxDB, error) {
+	return psql.NewPgx(postgresConfig(cfg), usersTable, log)
+}
+
+// newPostgresSupervisor returns a supervisor that connects to the database and
+// migrates it, a database that cannot be migrated is not used.
+func newPostgresSupervisor(log *slog.Logger, cfg *config.Config) *supervisor.Supervisor {
+	connect := func(ctx context.Context) (supervisor.Backend, error) {
+		if cfg.Storage.Postgres.Driver == config.DriverPq {
+			return connectPq(ctx, log, cfg)
+		}
+
+		return connectPgx(ctx, log, cfg)
+	}
+
+	return supervisor.New(log, config.BackendPostgres, connect, supervisor.Options{
+		Attempts:      cfg.Storage.Postgres.ConnectAttempts,
+		Backoff:       backoff.New(cfg.Storage.Postgres.ConnectBackoff, cfg.Storage.Postgres.ConnectMaxBackoff),
+		CheckInterval: cfg.Storage.Postgres.HealthCheckInterval,
+		PingTimeout:   cfg.Storage.Postgres.ConnectTimeout,
+	})
+}
+
+func connectPgx(ctx context.Context, log *slog.Logger, cfg *config.Config) (supervisor.Backend, error) {
+	db, err := OpenPgx(log, cfg.Storage.Postgres)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Migrations.AutoApply {
+		// The migrations run on database/sql, over the connections of the pool.
+		sqlDB := db.OpenDB()
+		err := migrate(ctx, log, sqlDB, cfg.Migrations)
+		sqlDB.Close()
+		if err != nil {
+			_ = db.Stop()
+			return nil, err
+		}
+	}
+
+	return db, nil
+}
+
+func connectPq(ctx context.Context, log *slog.Logger, cfg *config.Config) (supervisor.Backend, error) {
+	db, err := OpenPostgres(log, cfg.Storage.Postgres)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Migrations.AutoApply {
+		if err := migrate(ctx, log, db.DB, cfg.Migrations); err != nil {
+			_ = db.Stop()
+			return nil, err
+		}
+	}
+
+	// Statements that fail here, e.g. while the schema is not migrated, are
+	// prepared again on first use.
+	if err := db.Prepare(ctx); err != nil {
+		log.Warn("failed to prepare statements", sl.Err(err))
+	}
+
+	return db, nil
+}
+
+// migrate brings the schema up to date and adds the development accounts if
+// asked to.
+func migrate(ctx context.Context, log *slog.Logger, db *sql.DB, cfg config.MigrationsConfig) error {
+	const op = "app.migrate"
+
+	migrator, err := migrations.New(log, db)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("database schema is up to date", slog.Int("applied", applied))
+
+	if cfg.DevFixtures {
+		if err := migrator.SeedDevFixtures(ctx); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
 }
@@ -5,8 +5,10 @@ import (
 	"log/slog"
 	"net"
 	"server/internal/domain/interfaces"
+	"server/internal/grpc/interceptors"
 	"server/internal/grpc/usersmanager"
 
+	umv1 "github.com/chas3air/protos/gen/go/usersManager"
 	"google.golang.org/grpc"
 )
 
@@ -16,8 +18,17 @@ type App struct {
 	port       int
 }
 
-func New(log *slog.Logger, usersManager interfaces.UsersManager, port int) *App {
-	gRPCServer := grpc.NewServer()
+func New(log *slog.Logger, usersManager interfaces.UsersManager, port int, tokenSecret string) *App {
+	gRPCServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			interceptors.RequestIdUnaryInterceptor(),
+			interceptors.AuthUnaryInterceptor(log, tokenSecret, umv1.UsersManager_Authenticate_FullMethodName, umv1.UsersManager_Health_FullMethodName),
+		),
+		grpc.ChainStreamInterceptor(
+			interceptors.RequestIdStreamInterceptor(),
+			interceptors.AuthStreamInterceptor(log, tokenSecret),
+		),
+	)
 
 	usersmanager.Register(gRPCServer, usersManager)
 
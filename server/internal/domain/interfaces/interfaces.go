@@ -3,24 +3,81 @@ package interfaces
 import (
 	"context"
 	"server/internal/domain/models"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+// Storage mutations write the audit event attached to the context with
+// audit.WithEvent, if any, atomically with the change. The storage fills in
+// the changes from the rows it holds.
 type Storage interface {
-	GetUsers(ctx context.Context) ([]models.User, error)
+	GetUsers(ctx context.Context, query models.UsersQuery) ([]models.User, error)
+	// StreamUsers calls fn for every user matching the query, ignoring its limit,
+	// and stops at the first error returned by fn.
+	StreamUsers(ctx context.Context, query models.UsersQuery, fn func(models.User) error) error
 	GetUserById(ctx context.Context, uid uuid.UUID) (models.User, error)
+	// GetUsersByIds returns the users found by the ids, each once and in the
+	// order of the ids. The ids of missing or deleted users are skipped.
+	GetUsersByIds(ctx context.Context, uids []uuid.UUID) ([]models.User, error)
 	GetUserByEmail(ctx context.Context, email string) (models.User, error)
 	Insert(ctx context.Context, user models.User) error
+	// Update replaces the user if its stored version equals user.Version and
+	// increments the version, otherwise it fails with storage.ErrConflict.
 	Update(ctx context.Context, uid uuid.UUID, user models.User) error
+	// Delete soft-deletes the user, reads skip deleted users unless asked
+	// for them with UsersFilter.IncludeDeleted.
 	Delete(ctx context.Context, uid uuid.UUID) (models.User, error)
+	// Restore undoes Delete, it fails with storage.ErrUserExists when the
+	// email has been taken since.
+	Restore(ctx context.Context, uid uuid.UUID) (models.User, error)
+	// InsertUsers, UpdateUsers and DeleteUsers apply Insert, Update and Delete
+	// to every item in order, each item seeing the changes of the earlier ones,
+	// and return one result per item. A failing item does not stop the others,
+	// run them in WithTx and roll back to apply all or none. The audit event
+	// carried by ctx is recorded for every applied item, see audit.ForTarget.
+	InsertUsers(ctx context.Context, users []models.User) ([]models.BatchResult, error)
+	// UpdateUsers updates the users by their ids but keeps the stored
+	// passwords, they are changed one at a time with Update.
+	UpdateUsers(ctx context.Context, users []models.User) ([]models.BatchResult, error)
+	DeleteUsers(ctx context.Context, uids []uuid.UUID) ([]models.BatchResult, error)
+	// Purge permanently removes users deleted before the given time.
+	Purge(ctx context.Context, deletedBefore time.Time) (int64, error)
+	// GetAuditEvents returns the audit events matching the query, newest first.
+	GetAuditEvents(ctx context.Context, query models.AuditQuery) ([]models.AuditEvent, error)
+	// Health reports the backend and whether it is reachable.
+	Health(ctx context.Context) models.StorageHealth
+	// WithTx runs fn in a transaction: the changes made through tx are kept
+	// only if fn returns nil. Calling WithTx on tx joins the transaction.
+	WithTx(ctx context.Context, fn func(tx Storage) error) error
 }
 
 type UsersManager interface {
-	GetUsers(ctx context.Context) ([]models.User, error)
+	GetUsers(ctx context.Context, req models.UsersPageRequest) (models.UsersPage, error)
+	StreamUsers(ctx context.Context, filter models.UsersFilter, sort models.UsersSort, fn func(models.User) error) error
 	GetUserById(ctx context.Context, uid uuid.UUID) (models.User, error)
+	// BatchGetUsers returns the users found by the ids and the ids that were
+	// not found, both in the order of the ids and without repeats.
+	BatchGetUsers(ctx context.Context, uids []uuid.UUID) ([]models.User, []uuid.UUID, error)
 	GetUserByEmail(ctx context.Context, email string) (models.User, error)
 	Insert(ctx context.Context, user models.User) error
 	Update(ctx context.Context, uid uuid.UUID, user models.User) error
 	Delete(ctx context.Context, uid uuid.UUID) (models.User, error)
+	RestoreUser(ctx context.Context, uid uuid.UUID) (models.User, error)
+	// BatchInsertUsers, BatchUpdateUsers and BatchDeleteUsers return one
+	// result per item. In an atomic batch that failed, the items that could
+	// have been applied fail with batch.ErrAborted.
+	BatchInsertUsers(ctx context.Context, users []models.User, mode models.BatchMode) ([]models.BatchResult, error)
+	BatchUpdateUsers(ctx context.Context, users []models.User, mode models.BatchMode) ([]models.BatchResult, error)
+	BatchDeleteUsers(ctx context.Context, uids []uuid.UUID, mode models.BatchMode) ([]models.BatchResult, error)
+	ListAuditEvents(ctx context.Context, req models.AuditPageRequest) (models.AuditPage, error)
+	ChangePassword(ctx context.Context, uid uuid.UUID, oldPassword string, newPassword string) error
+	VerifyCredentials(ctx context.Context, email string, password string) (models.User, error)
+	Authenticate(ctx context.Context, email string, password string) (string, error)
+	Health(ctx context.Context) models.StorageHealth
+}
+
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(password string, stored string) (ok bool, needsRehash bool, err error)
 }
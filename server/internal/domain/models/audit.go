@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Audited operations.
+const (
+	AuditInsert         = "insert"
+	AuditUpdate         = "update"
+	AuditDelete         = "delete"
+	AuditRestore        = "restore"
+	AuditChangePassword = "change_password"
+	AuditRehashPassword = "rehash_password"
+)
+
+// FieldChange is a changed field of the target user. Secrets are redacted.
+type FieldChange struct {
+	Field  string `json:"field"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// AuditEvent records a mutation of a user. ActorId is uuid.Nil when the
+// change was not made on behalf of an authenticated caller.
+type AuditEvent struct {
+	Id         uuid.UUID
+	OccurredAt time.Time
+	RequestId  string
+	ActorId    uuid.UUID
+	Operation  string
+	TargetId   uuid.UUID
+	Changes    []FieldChange
+}
+
+// AuditCursor is the position of the last event of a page in the
+// (OccurredAt, Id) descending order.
+type AuditCursor struct {
+	OccurredAt time.Time
+	Id         uuid.UUID
+}
+
+// AuditQuery selects at most Limit events, newest first, matching the
+// non-nil target and actor and placed after the cursor.
+type AuditQuery struct {
+	TargetId uuid.UUID
+	ActorId  uuid.UUID
+	Limit    int
+	After    *AuditCursor
+}
+
+// AuditPageRequest is a request for one page of audit events, see
+// UsersManager.ListAuditEvents.
+type AuditPageRequest struct {
+	TargetId  uuid.UUID
+	ActorId   uuid.UUID
+	PageSize  int
+	PageToken string
+}
+
+type AuditPage struct {
+	Events        []AuditEvent
+	NextPageToken string
+}
@@ -0,0 +1,18 @@
+package models
+
+// BatchMode selects how a batch mutation treats the items that fail.
+type BatchMode int
+
+const (
+	// BatchAtomic applies the items only if every one of them can be applied.
+	BatchAtomic BatchMode = iota
+	// BatchBestEffort applies every item that can be applied.
+	BatchBestEffort
+)
+
+// BatchResult is the outcome of one item of a batch mutation: the user as
+// stored after the change, or the error that kept the item from being applied.
+type BatchResult struct {
+	User User
+	Err  error
+}
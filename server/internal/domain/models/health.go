@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// StorageHealth describes the storage backend serving requests.
+type StorageHealth struct {
+	// Backend is the name of the backend as in the storage config, e.g. "postgres".
+	Backend string
+	// Degraded is set while the backend cannot be reached, writes are refused then.
+	Degraded bool
+	// Since is when the backend entered its current state, zero when it is not tracked.
+	Since time.Time
+	// Cache is nil when the storage is not cached.
+	Cache *CacheStats
+}
+
+// CacheStats counts the lookups served from the cache and those that went to
+// the backend since the start.
+type CacheStats struct {
+	Hits     uint64
+	Misses   uint64
+	Size     int
+	Capacity int
+}
@@ -0,0 +1,10 @@
+package models
+
+import "github.com/google/uuid"
+
+// Identity describes the authenticated caller of a request.
+type Identity struct {
+	UserId uuid.UUID
+	Email  string
+	Role   string
+}
@@ -1,11 +1,34 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type User struct {
-	Id       uuid.UUID
-	Email    string
-	Password string
-	Role     string
-	Nick     string
+	Id        uuid.UUID
+	Email     string
+	Password  string
+	Role      string
+	Nick      string
+	CreatedAt time.Time
+	// Version is incremented by the storage on every update.
+	Version int64
+	// DeletedAt is set when the user is soft-deleted.
+	DeletedAt *time.Time
+	// UpdatedAt and UpdatedBy record the last insert or update of the user.
+	// UpdatedBy is uuid.Nil for changes made by the server itself.
+	UpdatedAt time.Time
+	UpdatedBy uuid.UUID
+}
+
+// LogValue keeps the password hash and the email out of the logs.
+func (u User) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("id", u.Id.String()),
+		slog.String("role", u.Role),
+		slog.Int64("version", u.Version),
+	)
 }
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type SortField string
+
+const (
+	SortByCreatedAt SortField = "created_at"
+	SortByEmail     SortField = "email"
+	SortByRole      SortField = "role"
+	SortByNick      SortField = "nick"
+)
+
+// UsersSort orders users by Field and then by Id in the same direction.
+// An empty Field means SortByCreatedAt.
+type UsersSort struct {
+	Field SortField
+	Desc  bool
+}
+
+// Key returns the value of the text column the users are sorted by,
+// it is empty when sorting by creation time.
+func (s UsersSort) Key(user User) string {
+	switch s.Field {
+	case SortByEmail:
+		return user.Email
+	case SortByRole:
+		return user.Role
+	case SortByNick:
+		return user.Nick
+	default:
+		return ""
+	}
+}
+
+// Cursor returns the position of user in the s order.
+func (s UsersSort) Cursor(user User) UsersCursor {
+	return UsersCursor{
+		Key:       s.Key(user),
+		CreatedAt: user.CreatedAt,
+		Id:        user.Id,
+	}
+}
+
+// UsersFilter selects users matching all non-empty fields. EmailDomain is
+// compared with the part of the email after '@', NickPrefix and NickContains
+// are case sensitive. CreatedAfter is inclusive and CreatedBefore is exclusive.
+// Soft-deleted users are skipped unless IncludeDeleted is set.
+type UsersFilter struct {
+	Role           string
+	EmailDomain    string
+	NickPrefix     string
+	NickContains   string
+	CreatedAfter   time.Time
+	CreatedBefore  time.Time
+	IncludeDeleted bool
+}
+
+func (f UsersFilter) Equal(other UsersFilter) bool {
+	return f.Role == other.Role &&
+		f.EmailDomain == other.EmailDomain &&
+		f.NickPrefix == other.NickPrefix &&
+		f.NickContains == other.NickContains &&
+		f.CreatedAfter.Equal(other.CreatedAfter) &&
+		f.CreatedBefore.Equal(other.CreatedBefore) &&
+		f.IncludeDeleted == other.IncludeDeleted
+}
+
+// UsersCursor is the position of the last user of a page. Key holds the value
+// of the sort column for text sorts, CreatedAt and Id are always set.
+type UsersCursor struct {
+	Key       string
+	CreatedAt time.Time
+	Id        uuid.UUID
+}
+
+// UsersQuery selects at most Limit users matching Filter, ordered by Sort and
+// placed after the cursor.
+type UsersQuery struct {
+	Filter UsersFilter
+	Sort   UsersSort
+	Limit  int
+	After  *UsersCursor
+}
+
+// UsersPageRequest is a request for one page of users, see UsersManager.GetUsers.
+type UsersPageRequest struct {
+	Filter    UsersFilter
+	Sort      UsersSort
+	PageSize  int
+	PageToken string
+}
+
+type UsersPage struct {
+	Users         []User
+	NextPageToken string
+}
@@ -1,20 +1,33 @@
 package profiles
 
 import (
+	"fmt"
 	"server/internal/domain/models"
 
 	umv1 "github.com/chas3air/protos/gen/go/usersManager"
 	"github.com/google/uuid"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-func UsrToProroUsr(user models.User) (*umv1.User, error) {
-	return &umv1.User{
-		Id:       user.Id.String(),
-		Email:    user.Email,
-		Password: user.Password,
-		Role:     user.Role,
-		Nick:     user.Nick,
-	}, nil
+// UsrToProtoPublicUsr converts user to its public representation, the password is never copied.
+func UsrToProtoPublicUsr(user models.User) (*umv1.PublicUser, error) {
+	publicUser := &umv1.PublicUser{
+		Id:        user.Id.String(),
+		Email:     user.Email,
+		Role:      user.Role,
+		Nick:      user.Nick,
+		Version:   user.Version,
+		CreatedAt: timestamppb.New(user.CreatedAt),
+		UpdatedAt: timestamppb.New(user.UpdatedAt),
+	}
+	if user.DeletedAt != nil {
+		publicUser.DeletedAt = timestamppb.New(*user.DeletedAt)
+	}
+	if user.UpdatedBy != uuid.Nil {
+		publicUser.UpdatedBy = user.UpdatedBy.String()
+	}
+
+	return publicUser, nil
 }
 
 func ProtoUsrToUsr(proto_usr *umv1.User) (models.User, error) {
@@ -23,11 +36,138 @@ func ProtoUsrToUsr(proto_usr *umv1.User) (models.User, error) {
 		return models.User{}, err
 	}
 
+	return ProtoUsrToUsrWithId(proto_usr, parsedUUID), nil
+}
+
+// ProtoUsrToUsrWithId converts a user whose id is given apart, the id of
+// proto_usr is ignored.
+func ProtoUsrToUsrWithId(proto_usr *umv1.User, id uuid.UUID) models.User {
 	return models.User{
-		Id:       parsedUUID,
+		Id:       id,
 		Email:    proto_usr.GetEmail(),
 		Password: proto_usr.GetPassword(),
 		Role:     proto_usr.GetRole(),
 		Nick:     proto_usr.GetNick(),
+		Version:  proto_usr.GetVersion(),
+	}
+}
+
+var sortFields = map[umv1.UserSortField]models.SortField{
+	umv1.UserSortField_USER_SORT_FIELD_UNSPECIFIED: models.SortByCreatedAt,
+	umv1.UserSortField_USER_SORT_FIELD_CREATED_AT:  models.SortByCreatedAt,
+	umv1.UserSortField_USER_SORT_FIELD_EMAIL:       models.SortByEmail,
+	umv1.UserSortField_USER_SORT_FIELD_ROLE:        models.SortByRole,
+	umv1.UserSortField_USER_SORT_FIELD_NICK:        models.SortByNick,
+}
+
+// usersListRequest is implemented by GetUsersRequest and StreamUsersRequest.
+type usersListRequest interface {
+	GetRole() string
+	GetEmailDomain() string
+	GetNickPrefix() string
+	GetNickContains() string
+	GetCreatedAfter() *timestamppb.Timestamp
+	GetCreatedBefore() *timestamppb.Timestamp
+	GetSortBy() umv1.UserSortField
+	GetDescending() bool
+	GetIncludeDeleted() bool
+}
+
+// ProtoGetUsersReqToPageReq converts the list request, it fails on an unknown sort field.
+func ProtoGetUsersReqToPageReq(in *umv1.GetUsersRequest) (models.UsersPageRequest, error) {
+	filter, sort, err := ProtoListReqToQuery(in)
+	if err != nil {
+		return models.UsersPageRequest{}, err
+	}
+
+	return models.UsersPageRequest{
+		Filter:    filter,
+		Sort:      sort,
+		PageSize:  int(in.GetPageSize()),
+		PageToken: in.GetPageToken(),
 	}, nil
 }
+
+// ProtoListReqToQuery converts the filter and sort of a list request, it fails on an unknown sort field.
+func ProtoListReqToQuery(in usersListRequest) (models.UsersFilter, models.UsersSort, error) {
+	field, ok := sortFields[in.GetSortBy()]
+	if !ok {
+		return models.UsersFilter{}, models.UsersSort{}, fmt.Errorf("unknown sort field %d", in.GetSortBy())
+	}
+
+	filter := models.UsersFilter{
+		Role:           in.GetRole(),
+		EmailDomain:    in.GetEmailDomain(),
+		NickPrefix:     in.GetNickPrefix(),
+		NickContains:   in.GetNickContains(),
+		IncludeDeleted: in.GetIncludeDeleted(),
+	}
+	if in.GetCreatedAfter() != nil {
+		filter.CreatedAfter = in.GetCreatedAfter().AsTime()
+	}
+	if in.GetCreatedBefore() != nil {
+		filter.CreatedBefore = in.GetCreatedBefore().AsTime()
+	}
+
+	return filter, models.UsersSort{Field: field, Desc: in.GetDescending()}, nil
+}
+
+var batchModes = map[umv1.BatchMode]models.BatchMode{
+	umv1.BatchMode_BATCH_MODE_UNSPECIFIED: models.BatchAtomic,
+	umv1.BatchMode_BATCH_MODE_ATOMIC:      models.BatchAtomic,
+	umv1.BatchMode_BATCH_MODE_BEST_EFFORT: models.BatchBestEffort,
+}
+
+// ProtoBatchModeToMode converts the mode of a batch, it fails on an unknown mode.
+func ProtoBatchModeToMode(mode umv1.BatchMode) (models.BatchMode, error) {
+	batchMode, ok := batchModes[mode]
+	if !ok {
+		return 0, fmt.Errorf("unknown batch mode %d", mode)
+	}
+
+	return batchMode, nil
+}
+
+// AuditEventToProto converts the audit event, a nil actor becomes an empty actor_id.
+func AuditEventToProto(event models.AuditEvent) *umv1.AuditEvent {
+	protoEvent := &umv1.AuditEvent{
+		Id:         event.Id.String(),
+		OccurredAt: timestamppb.New(event.OccurredAt),
+		RequestId:  event.RequestId,
+		Operation:  event.Operation,
+		TargetId:   event.TargetId.String(),
+		Changes:    make([]*umv1.FieldChange, 0, len(event.Changes)),
+	}
+	if event.ActorId != uuid.Nil {
+		protoEvent.ActorId = event.ActorId.String()
+	}
+	for _, change := range event.Changes {
+		protoEvent.Changes = append(protoEvent.Changes, &umv1.FieldChange{
+			Field:  change.Field,
+			Before: change.Before,
+			After:  change.After,
+		})
+	}
+
+	return protoEvent
+}
+
+func StorageHealthToProto(health models.StorageHealth) *umv1.HealthResponse {
+	protoHealth := &umv1.HealthResponse{
+		Backend:  health.Backend,
+		Degraded: health.Degraded,
+	}
+	if !health.Since.IsZero() {
+		protoHealth.Since = timestamppb.New(health.Since)
+	}
+	if health.Cache != nil {
+		protoHealth.Cache = &umv1.CacheStats{
+			Hits:     health.Cache.Hits,
+			Misses:   health.Cache.Misses,
+			Size:     int64(health.Cache.Size),
+			Capacity: int64(health.Cache.Capacity),
+		}
+	}
+
+	return protoHealth
+}
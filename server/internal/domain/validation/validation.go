@@ -0,0 +1,173 @@
+package validation
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"server/internal/domain/models"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits mirror the column sizes of the Users table.
+const (
+	MaxEmailLength    = 50
+	MaxNickLength     = 50
+	MinNickLength     = 2
+	MaxRoleLength     = 20
+	MinPasswordLength = 8
+	MaxPasswordLength = 128
+)
+
+var nickPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+type FieldViolation struct {
+	Field       string
+	Description string
+}
+
+// Error lists every field that failed validation.
+type Error struct {
+	Violations []FieldViolation
+}
+
+func (e *Error) Error() string {
+	parts := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		parts = append(parts, v.Field+": "+v.Description)
+	}
+
+	return "invalid fields: " + strings.Join(parts, "; ")
+}
+
+type Validator struct {
+	roles map[string]struct{}
+}
+
+// New creates a validator accepting only the given roles.
+func New(roles []string) *Validator {
+	allowed := make(map[string]struct{}, len(roles))
+	for _, role := range roles {
+		allowed[role] = struct{}{}
+	}
+
+	return &Validator{
+		roles: allowed,
+	}
+}
+
+// ValidateUser checks email, nick and role of the user. It returns *Error or nil.
+func (v *Validator) ValidateUser(user models.User) error {
+	var violations []FieldViolation
+	add := func(field string, format string, args ...any) {
+		violations = append(violations, FieldViolation{Field: field, Description: fmt.Sprintf(format, args...)})
+	}
+
+	switch {
+	case user.Email == "":
+		add("email", "is required")
+	case utf8.RuneCountInString(user.Email) > MaxEmailLength:
+		add("email", "must be at most %d characters", MaxEmailLength)
+	case !isEmail(user.Email):
+		add("email", "must be a valid email address")
+	}
+
+	switch {
+	case user.Nick == "":
+		add("nick", "is required")
+	case utf8.RuneCountInString(user.Nick) < MinNickLength || utf8.RuneCountInString(user.Nick) > MaxNickLength:
+		add("nick", "must be between %d and %d characters", MinNickLength, MaxNickLength)
+	case !nickPattern.MatchString(user.Nick):
+		add("nick", "may contain only latin letters, digits, '_', '.' and '-'")
+	}
+
+	switch {
+	case user.Role == "":
+		add("role", "is required")
+	case utf8.RuneCountInString(user.Role) > MaxRoleLength:
+		add("role", "must be at most %d characters", MaxRoleLength)
+	default:
+		if _, ok := v.roles[user.Role]; !ok {
+			add("role", "must be one of the configured roles")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &Error{Violations: violations}
+	}
+
+	return nil
+}
+
+// ValidateNewUser checks the user fields together with the plaintext password of a user being created.
+func (v *Validator) ValidateNewUser(user models.User) error {
+	var violations []FieldViolation
+	if err, ok := v.ValidateUser(user).(*Error); ok {
+		violations = append(violations, err.Violations...)
+	}
+	if err, ok := v.ValidatePassword(user.Password).(*Error); ok {
+		violations = append(violations, err.Violations...)
+	}
+
+	if len(violations) > 0 {
+		return &Error{Violations: violations}
+	}
+
+	return nil
+}
+
+// ValidatePassword checks a new password. It returns *Error or nil.
+func (v *Validator) ValidatePassword(password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < MinPasswordLength || length > MaxPasswordLength {
+		return &Error{Violations: []FieldViolation{{
+			Field:       "password",
+			Description: fmt.Sprintf("must be between %d and %d characters", MinPasswordLength, MaxPasswordLength),
+		}}}
+	}
+
+	return nil
+}
+
+// ValidateUsersFilter checks the filter of a user list. It returns *Error or nil.
+func (v *Validator) ValidateUsersFilter(filter models.UsersFilter) error {
+	var violations []FieldViolation
+	add := func(field string, format string, args ...any) {
+		violations = append(violations, FieldViolation{Field: field, Description: fmt.Sprintf(format, args...)})
+	}
+
+	if utf8.RuneCountInString(filter.Role) > MaxRoleLength {
+		add("role", "must be at most %d characters", MaxRoleLength)
+	}
+	if utf8.RuneCountInString(filter.EmailDomain) > MaxEmailLength {
+		add("email_domain", "must be at most %d characters", MaxEmailLength)
+	}
+	if strings.Contains(filter.EmailDomain, "@") {
+		add("email_domain", "must not contain '@'")
+	}
+	if utf8.RuneCountInString(filter.NickPrefix) > MaxNickLength {
+		add("nick_prefix", "must be at most %d characters", MaxNickLength)
+	}
+	if utf8.RuneCountInString(filter.NickContains) > MaxNickLength {
+		add("nick_contains", "must be at most %d characters", MaxNickLength)
+	}
+	if !filter.CreatedAfter.IsZero() && !filter.CreatedBefore.IsZero() && !filter.CreatedAfter.Before(filter.CreatedBefore) {
+		add("created_before", "must be later than created_after")
+	}
+
+	if len(violations) > 0 {
+		return &Error{Violations: violations}
+	}
+
+	return nil
+}
+
+func isEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return false
+	}
+
+	at := strings.LastIndex(email, "@")
+	return at > 0 && strings.Contains(email[at+1:], ".")
+}
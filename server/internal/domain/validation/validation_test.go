@@ -0,0 +1,198 @@
+package validation_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"server/internal/domain/models"
+	"server/internal/domain/validation"
+)
+
+// roles stand in for the roles of the authz policy.
+var roles = []string{"admin", "user"}
+
+func validUser() models.User {
+	return models.User{Email: "user@example.com", Nick: "user_1.a-b", Role: "user", Password: "password"}
+}
+
+// violations returns the violations of err, nil for a nil error.
+func violations(t *testing.T, err error) []validation.FieldViolation {
+	t.Helper()
+
+	if err == nil {
+		return nil
+	}
+
+	var verr *validation.Error
+	if !errors.As(err, &verr) {
+		t.Fatalf("error = %v, want *validation.Error", err)
+	}
+	return verr.Violations
+}
+
+func TestValidateUser(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(user *models.User)
+		want   []validation.FieldViolation
+	}{
+		{name: "valid", modify: func(*models.User) {}},
+		{name: "no email", modify: func(u *models.User) { u.Email = "" },
+			want: []validation.FieldViolation{{Field: "email", Description: "is required"}}},
+		{name: "long email", modify: func(u *models.User) { u.Email = strings.Repeat("a", 39) + "@example.com" },
+			want: []validation.FieldViolation{{Field: "email", Description: "must be at most 50 characters"}}},
+		{name: "email with a name", modify: func(u *models.User) { u.Email = "User <user@example.com>" },
+			want: []validation.FieldViolation{{Field: "email", Description: "must be a valid email address"}}},
+		{name: "email without a domain", modify: func(u *models.User) { u.Email = "user@localhost" },
+			want: []validation.FieldViolation{{Field: "email", Description: "must be a valid email address"}}},
+		{name: "no nick", modify: func(u *models.User) { u.Nick = "" },
+			want: []validation.FieldViolation{{Field: "nick", Description: "is required"}}},
+		{name: "shortest nick", modify: func(u *models.User) { u.Nick = "ab" }},
+		{name: "short nick", modify: func(u *models.User) { u.Nick = "a" },
+			want: []validation.FieldViolation{{Field: "nick", Description: "must be between 2 and 50 characters"}}},
+		{name: "longest nick", modify: func(u *models.User) { u.Nick = strings.Repeat("a", 50) }},
+		{name: "long nick", modify: func(u *models.User) { u.Nick = strings.Repeat("a", 51) },
+			want: []validation.FieldViolation{{Field: "nick", Description: "must be between 2 and 50 characters"}}},
+		{name: "nick with a space", modify: func(u *models.User) { u.Nick = "user name" },
+			want: []validation.FieldViolation{{Field: "nick", Description: "may contain only latin letters, digits, '_', '.' and '-'"}}},
+		{name: "nick with cyrillic letters", modify: func(u *models.User) { u.Nick = "юзер" },
+			want: []validation.FieldViolation{{Field: "nick", Description: "may contain only latin letters, digits, '_', '.' and '-'"}}},
+		{name: "no role", modify: func(u *models.User) { u.Role = "" },
+			want: []validation.FieldViolation{{Field: "role", Description: "is required"}}},
+		{name: "long role", modify: func(u *models.User) { u.Role = strings.Repeat("a", 21) },
+			want: []validation.FieldViolation{{Field: "role", Description: "must be at most 20 characters"}}},
+		{name: "unknown role", modify: func(u *models.User) { u.Role = "root" },
+			want: []validation.FieldViolation{{Field: "role", Description: "must be one of the configured roles"}}},
+		{name: "role in another case", modify: func(u *models.User) { u.Role = "Admin" },
+			want: []validation.FieldViolation{{Field: "role", Description: "must be one of the configured roles"}}},
+		{name: "every field", modify: func(u *models.User) { *u = models.User{} },
+			want: []validation.FieldViolation{
+				{Field: "email", Description: "is required"},
+				{Field: "nick", Description: "is required"},
+				{Field: "role", Description: "is required"},
+			}},
+	}
+
+	v := validation.New(roles)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := validUser()
+			tt.modify(&user)
+
+			if got := violations(t, v.ValidateUser(user)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidateUser() violations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateUserRolesFromPolicy(t *testing.T) {
+	user := validUser()
+	user.Role = "auditor"
+
+	if err := validation.New(roles).ValidateUser(user); err == nil {
+		t.Error("ValidateUser() of a role missing from the policy error = nil")
+	}
+	if err := validation.New(append(roles, "auditor")).ValidateUser(user); err != nil {
+		t.Errorf("ValidateUser() of a role of the policy error = %v", err)
+	}
+	if err := validation.New(nil).ValidateUser(validUser()); err == nil {
+		t.Error("ValidateUser() without roles error = nil")
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	lengthViolation := []validation.FieldViolation{{Field: "password", Description: "must be between 8 and 128 characters"}}
+
+	tests := []struct {
+		name     string
+		password string
+		want     []validation.FieldViolation
+	}{
+		{name: "empty", password: "", want: lengthViolation},
+		{name: "short", password: "1234567", want: lengthViolation},
+		{name: "shortest", password: "12345678"},
+		{name: "longest", password: strings.Repeat("a", 128)},
+		{name: "long", password: strings.Repeat("a", 129), want: lengthViolation},
+		// The limits count characters, not bytes.
+		{name: "multibyte shortest", password: strings.Repeat("п", 8)},
+		{name: "multibyte short", password: strings.Repeat("п", 7), want: lengthViolation},
+		{name: "multibyte longest", password: strings.Repeat("п", 128)},
+	}
+
+	v := validation.New(roles)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := violations(t, v.ValidatePassword(tt.password)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValidatePassword() violations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateNewUser(t *testing.T) {
+	v := validation.New(roles)
+
+	if err := v.ValidateNewUser(validUser()); err != nil {
+		t.Fatalf("ValidateNewUser() error = %v", err)
+	}
+
+	user := validUser()
+	user.Nick = "a"
+	user.Password = "short"
+
+	want := []validation.FieldViolation{
+		{Field: "nick", Description: "must be between 2 and 50 characters"},
+		{Field: "password", Description: "must be between 8 and 128 characters"},
+	}
+	if got := violations(t, v.ValidateNewUser(user)); !reflect.DeepEqual(got, want) {
+		t.Errorf("ValidateNewUser() violations = %v, want %v", got, want)
+	}
+}
+
+func TestValidateUsersFilter(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		filter models.UsersFilter
+		want   []string
+	}{
+		{name: "empty", filter: models.UsersFilter{}},
+		{name: "valid", filter: models.UsersFilter{Role: "user", EmailDomain: "example.com", CreatedAfter: now, CreatedBefore: now.Add(time.Hour)}},
+		{name: "long role", filter: models.UsersFilter{Role: strings.Repeat("a", 21)}, want: []string{"role"}},
+		{name: "email domain with @", filter: models.UsersFilter{EmailDomain: "@example.com"}, want: []string{"email_domain"}},
+		{name: "long nick prefix", filter: models.UsersFilter{NickPrefix: strings.Repeat("a", 51)}, want: []string{"nick_prefix"}},
+		{name: "long nick part", filter: models.UsersFilter{NickContains: strings.Repeat("a", 51)}, want: []string{"nick_contains"}},
+		{name: "empty period", filter: models.UsersFilter{CreatedAfter: now, CreatedBefore: now}, want: []string{"created_before"}},
+		{name: "only one bound", filter: models.UsersFilter{CreatedBefore: now}},
+	}
+
+	v := validation.New(roles)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fields []string
+			for _, violation := range violations(t, v.ValidateUsersFilter(tt.filter)) {
+				fields = append(fields, violation.Field)
+			}
+
+			if !reflect.DeepEqual(fields, tt.want) {
+				t.Errorf("ValidateUsersFilter() fields = %v, want %v", fields, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	err := &validation.Error{Violations: []validation.FieldViolation{
+		{Field: "email", Description: "is required"},
+		{Field: "nick", Description: "is required"},
+	}}
+
+	if got, want := err.Error(), "invalid fields: email: is required; nick: is required"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,103 @@
+package interceptors
+
+import (
+	"context"
+	"log/slog"
+	"server/internal/domain/models"
+	"server/internal/lib/identity"
+	"server/pkg/lib/jwt"
+	"server/pkg/lib/logger/sl"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const authorizationHeader = "authorization"
+
+// AuthUnaryInterceptor validates the bearer token of every call except publicMethods
+// and stores the caller identity in the request context.
+func AuthUnaryInterceptor(log *slog.Logger, secret string, publicMethods ...string) grpc.UnaryServerInterceptor {
+	public := make(map[string]struct{}, len(publicMethods))
+	for _, method := range publicMethods {
+		public[method] = struct{}{}
+	}
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if _, ok := public[info.FullMethod]; ok {
+			return handler(ctx, req)
+		}
+
+		ctx, err := authenticate(ctx, log, secret, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// AuthStreamInterceptor is the streaming counterpart of AuthUnaryInterceptor.
+func AuthStreamInterceptor(log *slog.Logger, secret string, publicMethods ...string) grpc.StreamServerInterceptor {
+	public := make(map[string]struct{}, len(publicMethods))
+	for _, method := range publicMethods {
+		public[method] = struct{}{}
+	}
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if _, ok := public[info.FullMethod]; ok {
+			return handler(srv, ss)
+		}
+
+		ctx, err := authenticate(ss.Context(), log, secret, info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// contextStream replaces the context of a server stream.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+func authenticate(ctx context.Context, log *slog.Logger, secret string, method string) (context.Context, error) {
+	const op = "grpc.interceptors.authenticate"
+	log = log.With(slog.String("op", op), slog.String("method", method))
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authorization token is required")
+	}
+
+	values := md.Get(authorizationHeader)
+	if len(values) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "authorization token is required")
+	}
+
+	token, found := strings.CutPrefix(values[0], "Bearer ")
+	if !found || token == "" {
+		return nil, status.Error(codes.Unauthenticated, "authorization token must be a bearer token")
+	}
+
+	claims, err := jwt.ParseToken(token, secret)
+	if err != nil {
+		log.Warn("Invalid token", sl.Err(err))
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	return identity.WithIdentity(ctx, models.Identity{
+		UserId: claims.UserId,
+		Email:  claims.Email,
+		Role:   claims.Role,
+	}), nil
+}
@@ -0,0 +1,143 @@
+package interceptors_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"server/internal/domain/models"
+	"server/internal/grpc/interceptors"
+	"server/internal/lib/identity"
+	"server/pkg/lib/jwt"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	secret        = "0123456789abcdef0123456789abcdef"
+	publicMethod  = "/usersManager.UsersManager/Authenticate"
+	privateMethod = "/usersManager.UsersManager/GetUsers"
+)
+
+type authCase struct {
+	name     string
+	method   string
+	md       metadata.MD
+	wantCode codes.Code
+	wantId   *models.Identity
+}
+
+func authCases(t *testing.T) []authCase {
+	t.Helper()
+
+	caller := models.Identity{UserId: uuid.New(), Email: "admin@example.com", Role: "admin"}
+	token, err := jwt.NewToken(caller.UserId, caller.Email, caller.Role, secret, time.Minute)
+	if err != nil {
+		t.Fatalf("NewToken() error = %v", err)
+	}
+	expired, err := jwt.NewToken(caller.UserId, caller.Email, caller.Role, secret, -time.Minute)
+	if err != nil {
+		t.Fatalf("NewToken() error = %v", err)
+	}
+
+	return []authCase{
+		{name: "public method without token", method: publicMethod, wantCode: codes.OK},
+		{name: "public method with invalid token", method: publicMethod, md: metadata.Pairs("authorization", "Bearer x"), wantCode: codes.OK},
+		{name: "valid token", method: privateMethod, md: metadata.Pairs("authorization", "Bearer "+token), wantCode: codes.OK, wantId: &caller},
+		{name: "no metadata", method: privateMethod, wantCode: codes.Unauthenticated},
+		{name: "no authorization header", method: privateMethod, md: metadata.Pairs("x-request-id", "1"), wantCode: codes.Unauthenticated},
+		{name: "not a bearer token", method: privateMethod, md: metadata.Pairs("authorization", "Basic "+token), wantCode: codes.Unauthenticated},
+		{name: "raw token", method: privateMethod, md: metadata.Pairs("authorization", token), wantCode: codes.Unauthenticated},
+		{name: "empty bearer token", method: privateMethod, md: metadata.Pairs("authorization", "Bearer "), wantCode: codes.Unauthenticated},
+		{name: "expired token", method: privateMethod, md: metadata.Pairs("authorization", "Bearer "+expired), wantCode: codes.Unauthenticated},
+		{name: "tampered signature", method: privateMethod, md: metadata.Pairs("authorization", "Bearer "+token[:len(token)-2]+"xx"), wantCode: codes.Unauthenticated},
+	}
+}
+
+func incomingContext(md metadata.MD) context.Context {
+	if md == nil {
+		return context.Background()
+	}
+	return metadata.NewIncomingContext(context.Background(), md)
+}
+
+// checkHandler records whether the handler ran and compares the identity it
+// saw with the expected one.
+func checkHandler(t *testing.T, tc authCase, called *bool) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		*called = true
+
+		got, ok := identity.FromContext(ctx)
+		switch {
+		case tc.wantId == nil && ok:
+			t.Errorf("handler got identity %+v, want none", got)
+		case tc.wantId != nil && (!ok || got != *tc.wantId):
+			t.Errorf("handler got identity %+v, %v, want %+v", got, ok, *tc.wantId)
+		}
+	}
+}
+
+func TestAuthUnaryInterceptor(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	interceptor := interceptors.AuthUnaryInterceptor(log, secret, publicMethod)
+
+	for _, tc := range authCases(t) {
+		t.Run(tc.name, func(t *testing.T) {
+			var called bool
+			check := checkHandler(t, tc, &called)
+
+			_, err := interceptor(incomingContext(tc.md), nil, &grpc.UnaryServerInfo{FullMethod: tc.method},
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+					check(ctx)
+					return nil, nil
+				})
+
+			if code := status.Code(err); code != tc.wantCode {
+				t.Fatalf("interceptor() code = %v, want %v (err = %v)", code, tc.wantCode, err)
+			}
+			if called != (tc.wantCode == codes.OK) {
+				t.Errorf("handler called = %v, want %v", called, tc.wantCode == codes.OK)
+			}
+		})
+	}
+}
+
+type fakeStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *fakeStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestAuthStreamInterceptor(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	interceptor := interceptors.AuthStreamInterceptor(log, secret, publicMethod)
+
+	for _, tc := range authCases(t) {
+		t.Run(tc.name, func(t *testing.T) {
+			var called bool
+			check := checkHandler(t, tc, &called)
+
+			err := interceptor(nil, &fakeStream{ctx: incomingContext(tc.md)}, &grpc.StreamServerInfo{FullMethod: tc.method},
+				func(srv interface{}, ss grpc.ServerStream) error {
+					check(ss.Context())
+					return nil
+				})
+
+			if code := status.Code(err); code != tc.wantCode {
+				t.Fatalf("interceptor() code = %v, want %v (err = %v)", code, tc.wantCode, err)
+			}
+			if called != (tc.wantCode == codes.OK) {
+				t.Errorf("handler called = %v, want %v", called, tc.wantCode == codes.OK)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package interceptors
+
+import (
+	"context"
+	"server/internal/lib/requestid"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	requestIdHeader = "x-request-id"
+	// maxRequestIdLength bounds ids chosen by clients, longer ones are replaced.
+	maxRequestIdLength = 128
+)
+
+// RequestIdUnaryInterceptor stores the "x-request-id" of the call in the request
+// context, generating one when the client sent none, and echoes it in the
+// response header.
+func RequestIdUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx = withRequestId(ctx)
+		_ = grpc.SetHeader(ctx, metadata.Pairs(requestIdHeader, requestid.FromContext(ctx)))
+
+		return handler(ctx, req)
+	}
+}
+
+// RequestIdStreamInterceptor is the streaming counterpart of RequestIdUnaryInterceptor.
+func RequestIdStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := withRequestId(ss.Context())
+		_ = ss.SetHeader(metadata.Pairs(requestIdHeader, requestid.FromContext(ctx)))
+
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func withRequestId(ctx context.Context) context.Context {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIdHeader); len(values) > 0 && values[0] != "" && len(values[0]) <= maxRequestIdLength {
+			return requestid.WithRequestId(ctx, values[0])
+		}
+	}
+
+	return requestid.WithRequestId(ctx, uuid.NewString())
+}
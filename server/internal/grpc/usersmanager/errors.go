@@ -0,0 +1,136 @@
+package usersmanager
+
+import (
+	"context"
+	"errors"
+	"server/internal/domain/validation"
+	"server/internal/lib/batch"
+	"server/internal/services/authz"
+	"server/internal/services/usersmanager"
+	"server/internal/storage"
+
+	umv1 "github.com/chas3air/protos/gen/go/usersManager"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const errorDomain = "usersmanager"
+
+// Reasons sent in errdetails.ErrorInfo, clients may switch on them.
+const (
+	ReasonUserNotFound       = "USER_NOT_FOUND"
+	ReasonUserExists         = "USER_EXISTS"
+	ReasonValidationFailed   = "VALIDATION_FAILED"
+	ReasonConflict           = "CONFLICT"
+	ReasonUnavailable        = "STORAGE_UNAVAILABLE"
+	ReasonPermissionDenied   = "PERMISSION_DENIED"
+	ReasonInvalidCredentials = "INVALID_CREDENTIALS"
+	ReasonBatchAborted       = "BATCH_ABORTED"
+)
+
+type errorMapping struct {
+	target error
+	code   codes.Code
+	reason string
+	msg    string
+}
+
+var errorMappings = []errorMapping{
+	{storage.ErrUserNotFound, codes.NotFound, ReasonUserNotFound, "user not found"},
+	{storage.ErrUserExists, codes.AlreadyExists, ReasonUserExists, "user already exists"},
+	{usersmanager.ErrValidation, codes.InvalidArgument, ReasonValidationFailed, "validation failed"},
+	{storage.ErrConflict, codes.Aborted, ReasonConflict, "user was modified concurrently, retry"},
+	{storage.ErrUnavailable, codes.Unavailable, ReasonUnavailable, "storage is unavailable"},
+	{authz.ErrPermissionDenied, codes.PermissionDenied, ReasonPermissionDenied, "permission denied"},
+	{usersmanager.ErrInvalidCredentials, codes.Unauthenticated, ReasonInvalidCredentials, "invalid email or password"},
+	{batch.ErrAborted, codes.Aborted, ReasonBatchAborted, "not applied, another item of the batch failed"},
+}
+
+// handleError converts an error returned by the users manager into a gRPC status
+// with an errdetails.ErrorInfo attached. Errors outside the taxonomy become
+// codes.Internal with msg, so internal details never reach the caller.
+func handleError(err error, msg string) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, "deadline exceeded")
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, "request canceled")
+	}
+
+	var validationErr *validation.Error
+	if errors.As(err, &validationErr) {
+		return newValidationStatus(validationErr)
+	}
+
+	for _, m := range errorMappings {
+		if errors.Is(err, m.target) {
+			return newStatus(m.code, m.reason, m.msg)
+		}
+	}
+
+	return status.Error(codes.Internal, msg)
+}
+
+func newStatus(code codes.Code, reason string, msg string) error {
+	st := status.New(code, msg)
+
+	withDetails, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason: reason,
+		Domain: errorDomain,
+	})
+	if err != nil {
+		return st.Err()
+	}
+
+	return withDetails.Err()
+}
+
+// newValidationStatus reports every violated field in errdetails.BadRequest.
+func newValidationStatus(validationErr *validation.Error) error {
+	st := status.New(codes.InvalidArgument, "validation failed")
+
+	badRequest := &errdetails.BadRequest{}
+	for _, v := range validationErr.Violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       v.Field,
+			Description: v.Description,
+		})
+	}
+
+	withDetails, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason: ReasonValidationFailed,
+		Domain: errorDomain,
+	}, badRequest)
+	if err != nil {
+		return st.Err()
+	}
+
+	return withDetails.Err()
+}
+
+// batchItemStatus describes the error of a batch item with the code, reason
+// and field violations handleError would have returned for it.
+func batchItemStatus(err error) *umv1.BatchItemStatus {
+	st := status.Convert(handleError(err, "failed to apply item"))
+
+	itemStatus := &umv1.BatchItemStatus{
+		Code:    int32(st.Code()),
+		Message: st.Message(),
+	}
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.ErrorInfo:
+			itemStatus.Reason = detail.GetReason()
+		case *errdetails.BadRequest:
+			for _, v := range detail.GetFieldViolations() {
+				itemStatus.Violations = append(itemStatus.Violations, &umv1.FieldViolation{
+					Field:       v.GetField(),
+					Description: v.GetDescription(),
+				})
+			}
+		}
+	}
+
+	return itemStatus
+}
@@ -0,0 +1,135 @@
+package usersmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"server/internal/domain/validation"
+	"server/internal/lib/batch"
+	"server/internal/services/authz"
+	"server/internal/services/usersmanager"
+	"server/internal/storage"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// details returns the ErrorInfo reason and the BadRequest violations of st.
+func details(st *status.Status) (reason string, violations []validation.FieldViolation) {
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.ErrorInfo:
+			reason = detail.GetReason()
+		case *errdetails.BadRequest:
+			for _, v := range detail.GetFieldViolations() {
+				violations = append(violations, validation.FieldViolation{Field: v.GetField(), Description: v.GetDescription()})
+			}
+		}
+	}
+
+	return reason, violations
+}
+
+func TestHandleError(t *testing.T) {
+	violation := validation.FieldViolation{Field: "email", Description: "is required"}
+
+	tests := []struct {
+		name           string
+		err            error
+		wantCode       codes.Code
+		wantReason     string
+		wantViolations []validation.FieldViolation
+	}{
+		{name: "user not found", err: storage.ErrUserNotFound, wantCode: codes.NotFound, wantReason: ReasonUserNotFound},
+		{name: "user exists", err: storage.ErrUserExists, wantCode: codes.AlreadyExists, wantReason: ReasonUserExists},
+		{name: "validation", err: usersmanager.ErrValidation, wantCode: codes.InvalidArgument, wantReason: ReasonValidationFailed},
+		{
+			name:           "validation with fields",
+			err:            fmt.Errorf("%w: %w", usersmanager.ErrValidation, &validation.Error{Violations: []validation.FieldViolation{violation}}),
+			wantCode:       codes.InvalidArgument,
+			wantReason:     ReasonValidationFailed,
+			wantViolations: []validation.FieldViolation{violation},
+		},
+		{name: "conflict", err: storage.ErrConflict, wantCode: codes.Aborted, wantReason: ReasonConflict},
+		{name: "unavailable", err: storage.ErrUnavailable, wantCode: codes.Unavailable, wantReason: ReasonUnavailable},
+		{name: "permission denied", err: authz.ErrPermissionDenied, wantCode: codes.PermissionDenied, wantReason: ReasonPermissionDenied},
+		{name: "invalid credentials", err: usersmanager.ErrInvalidCredentials, wantCode: codes.Unauthenticated, wantReason: ReasonInvalidCredentials},
+		{name: "batch aborted", err: batch.ErrAborted, wantCode: codes.Aborted, wantReason: ReasonBatchAborted},
+		{name: "deadline exceeded", err: context.DeadlineExceeded, wantCode: codes.DeadlineExceeded},
+		{name: "canceled", err: context.Canceled, wantCode: codes.Canceled},
+		{name: "unknown", err: errors.New("pq: connection reset"), wantCode: codes.Internal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The layers below wrap the sentinels with their op.
+			st := status.Convert(handleError(fmt.Errorf("services.usersmanager.Op: %w", tt.err), "failed to do it"))
+
+			if st.Code() != tt.wantCode {
+				t.Errorf("handleError() code = %v, want %v", st.Code(), tt.wantCode)
+			}
+
+			reason, violations := details(st)
+			if reason != tt.wantReason {
+				t.Errorf("handleError() reason = %q, want %q", reason, tt.wantReason)
+			}
+			if !reflect.DeepEqual(violations, tt.wantViolations) {
+				t.Errorf("handleError() violations = %v, want %v", violations, tt.wantViolations)
+			}
+		})
+	}
+}
+
+func TestHandleErrorHidesInternalErrors(t *testing.T) {
+	st := status.Convert(handleError(errors.New("pq: password authentication failed"), "failed to get users"))
+
+	if st.Message() != "failed to get users" {
+		t.Errorf("handleError() message = %q, want the given message", st.Message())
+	}
+	if len(st.Details()) != 0 {
+		t.Errorf("handleError() details = %v, want none", st.Details())
+	}
+}
+
+func TestBatchItemStatus(t *testing.T) {
+	violation := validation.FieldViolation{Field: "nick", Description: "is required"}
+
+	tests := []struct {
+		name           string
+		err            error
+		wantCode       codes.Code
+		wantReason     string
+		wantViolations int
+	}{
+		{name: "user exists", err: storage.ErrUserExists, wantCode: codes.AlreadyExists, wantReason: ReasonUserExists},
+		{name: "batch aborted", err: batch.ErrAborted, wantCode: codes.Aborted, wantReason: ReasonBatchAborted},
+		{
+			name:           "validation",
+			err:            fmt.Errorf("%w: %w", usersmanager.ErrValidation, &validation.Error{Violations: []validation.FieldViolation{violation}}),
+			wantCode:       codes.InvalidArgument,
+			wantReason:     ReasonValidationFailed,
+			wantViolations: 1,
+		},
+		{name: "unknown", err: errors.New("boom"), wantCode: codes.Internal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := batchItemStatus(tt.err)
+
+			if codes.Code(got.GetCode()) != tt.wantCode || got.GetReason() != tt.wantReason {
+				t.Errorf("batchItemStatus() = %v, %q, want %v, %q", codes.Code(got.GetCode()), got.GetReason(), tt.wantCode, tt.wantReason)
+			}
+			if len(got.GetViolations()) != tt.wantViolations {
+				t.Fatalf("batchItemStatus() violations = %v, want %d", got.GetViolations(), tt.wantViolations)
+			}
+			if tt.wantViolations > 0 && (got.GetViolations()[0].GetField() != violation.Field || got.GetViolations()[0].GetDescription() != violation.Description) {
+				t.Errorf("batchItemStatus() violation = %v, want %v", got.GetViolations()[0], violation)
+			}
+		})
+	}
+}
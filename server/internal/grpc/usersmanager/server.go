@@ -2,8 +2,14 @@ package usersmanager
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"server/internal/domain/interfaces"
+	"server/internal/domain/models"
 	"server/internal/domain/profiles"
+	"server/internal/domain/validation"
+	"server/internal/lib/batch"
+	"server/internal/services/usersmanager"
 
 	umv1 "github.com/chas3air/protos/gen/go/usersManager"
 	"github.com/google/uuid"
@@ -28,25 +34,63 @@ func Register(grpc *grpc.Server, usersManager interfaces.UsersManager) {
 }
 
 func (s *serverAPI) GetUsers(ctx context.Context, in *umv1.GetUsersRequest) (*umv1.GetUsersResponse, error) {
-	users, err := s.usersManager.GetUsers(ctx)
+	if in.GetPageSize() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "page_size must not be negative")
+	}
+
+	req, err := profiles.ProtoGetUsersReqToPageReq(in)
 	if err != nil {
-		return nil, status.Error(codes.Internal, "failed to retrieve users")
+		return nil, status.Error(codes.InvalidArgument, "sort_by is not supported")
 	}
 
-	usersForResp := make([]*umv1.User, len(users))
-	for i, user := range users {
-		profileUser, err := profiles.UsrToProroUsr(user)
+	page, err := s.usersManager.GetUsers(ctx, req)
+	if err != nil {
+		return nil, handleError(err, "failed to retrieve users")
+	}
+
+	usersForResp := make([]*umv1.PublicUser, 0, len(page.Users))
+	for _, user := range page.Users {
+		profileUser, err := profiles.UsrToProtoPublicUsr(user)
 		if err != nil {
 			continue
 		}
-		usersForResp[i] = profileUser
+		usersForResp = append(usersForResp, profileUser)
 	}
 
 	return &umv1.GetUsersResponse{
-		Users: usersForResp,
+		Users:         usersForResp,
+		NextPageToken: page.NextPageToken,
 	}, nil
 }
 
+// StreamUsers sends the matching users one per message. Send blocks while the
+// client's flow control window is full, which in turn pauses the storage scan.
+func (s *serverAPI) StreamUsers(in *umv1.StreamUsersRequest, stream umv1.UsersManager_StreamUsersServer) error {
+	filter, sort, err := profiles.ProtoListReqToQuery(in)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "sort_by is not supported")
+	}
+
+	var sendErr error
+	err = s.usersManager.StreamUsers(stream.Context(), filter, sort, func(user models.User) error {
+		profileUser, err := profiles.UsrToProtoPublicUsr(user)
+		if err != nil {
+			return err
+		}
+
+		sendErr = stream.Send(&umv1.StreamUsersResponse{User: profileUser})
+		return sendErr
+	})
+	if sendErr != nil {
+		return sendErr
+	}
+	if err != nil {
+		return handleError(err, "failed to stream users")
+	}
+
+	return nil
+}
+
 func (s *serverAPI) GetUserById(ctx context.Context, in *umv1.GetUserByIdRequest) (*umv1.GetUserByIdResponse, error) {
 	userID := in.GetId()
 	if userID == "" {
@@ -60,10 +104,10 @@ func (s *serverAPI) GetUserById(ctx context.Context, in *umv1.GetUserByIdRequest
 
 	user, err := s.usersManager.GetUserById(ctx, parsedUUID)
 	if err != nil {
-		return nil, status.Error(codes.Internal, "failed to retrieve user by id")
+		return nil, handleError(err, "failed to retrieve user by id")
 	}
 
-	userForResp, err := profiles.UsrToProroUsr(user)
+	userForResp, err := profiles.UsrToProtoPublicUsr(user)
 	if err != nil {
 		return nil, status.Error(codes.Internal, "failed to convert user")
 	}
@@ -73,6 +117,39 @@ func (s *serverAPI) GetUserById(ctx context.Context, in *umv1.GetUserByIdRequest
 	}, nil
 }
 
+func (s *serverAPI) BatchGetUsers(ctx context.Context, in *umv1.BatchGetUsersRequest) (*umv1.BatchGetUsersResponse, error) {
+	ids := make([]uuid.UUID, len(in.GetIds()))
+	for i, id := range in.GetIds() {
+		parsedUUID, err := uuid.Parse(id)
+		if err != nil {
+			return nil, handleError(invalidField(fmt.Sprintf("ids[%d]", i), "must be uuid"), "invalid ids")
+		}
+		ids[i] = parsedUUID
+	}
+
+	users, missing, err := s.usersManager.BatchGetUsers(ctx, ids)
+	if err != nil {
+		return nil, handleError(err, "failed to retrieve users by ids")
+	}
+
+	usersForResp := make([]*umv1.PublicUser, len(users))
+	for i, user := range users {
+		if usersForResp[i], err = profiles.UsrToProtoPublicUsr(user); err != nil {
+			return nil, status.Error(codes.Internal, "failed to convert user")
+		}
+	}
+
+	missingIds := make([]string, len(missing))
+	for i, id := range missing {
+		missingIds[i] = id.String()
+	}
+
+	return &umv1.BatchGetUsersResponse{
+		Users:      usersForResp,
+		MissingIds: missingIds,
+	}, nil
+}
+
 func (s *serverAPI) GetUserByEmail(ctx context.Context, in *umv1.GetUserByEmailRequest) (*umv1.GetUserByEmailResponse, error) {
 	email := in.GetEmail()
 	if email == "" {
@@ -81,10 +158,10 @@ func (s *serverAPI) GetUserByEmail(ctx context.Context, in *umv1.GetUserByEmailR
 
 	user, err := s.usersManager.GetUserByEmail(ctx, email)
 	if err != nil {
-		return nil, status.Error(codes.Internal, "failed to retrieve user by email")
+		return nil, handleError(err, "failed to retrieve user by email")
 	}
 
-	userForResp, err := profiles.UsrToProroUsr(user)
+	userForResp, err := profiles.UsrToProtoPublicUsr(user)
 	if err != nil {
 		return nil, status.Error(codes.Internal, "failed to convert user")
 	}
@@ -107,10 +184,10 @@ func (s *serverAPI) Insert(ctx context.Context, in *umv1.InsertRequest) (*umv1.I
 
 	err = s.usersManager.Insert(ctx, user)
 	if err != nil {
-		return nil, status.Error(codes.Internal, "failed to insert user")
+		return nil, handleError(err, "failed to insert user")
 	}
 
-	return nil, nil
+	return &umv1.InsertResponse{}, nil
 }
 
 func (s *serverAPI) Update(ctx context.Context, in *umv1.UpdateRequest) (*umv1.UpdateResponse, error) {
@@ -129,17 +206,20 @@ func (s *serverAPI) Update(ctx context.Context, in *umv1.UpdateRequest) (*umv1.U
 		return nil, status.Error(codes.InvalidArgument, "user is required")
 	}
 
-	user, err := profiles.ProtoUsrToUsr(protoUser)
-	if err != nil {
-		return nil, status.Error(codes.InvalidArgument, "failed to convert user")
+	// The id of the body is optional, the path id names the user.
+	if bodyID := protoUser.GetId(); bodyID != "" {
+		if parsedBodyUUID, err := uuid.Parse(bodyID); err != nil || parsedBodyUUID != parsedUUID {
+			return nil, status.Error(codes.InvalidArgument, "user.id must be empty or equal to id")
+		}
 	}
 
+	user := profiles.ProtoUsrToUsrWithId(protoUser, parsedUUID)
 	err = s.usersManager.Update(ctx, parsedUUID, user)
 	if err != nil {
-		return nil, status.Error(codes.Internal, "failed to update user")
+		return nil, handleError(err, "failed to update user")
 	}
 
-	return nil, nil
+	return &umv1.UpdateResponse{}, nil
 }
 
 func (s *serverAPI) Delete(ctx context.Context, in *umv1.DeleteRequest) (*umv1.DeleteResponse, error) {
@@ -155,10 +235,10 @@ func (s *serverAPI) Delete(ctx context.Context, in *umv1.DeleteRequest) (*umv1.D
 
 	user, err := s.usersManager.Delete(ctx, parsedUUID)
 	if err != nil {
-		return nil, status.Error(codes.Internal, "failed to delete user")
+		return nil, handleError(err, "failed to delete user")
 	}
 
-	userForResp, err := profiles.UsrToProroUsr(user)
+	userForResp, err := profiles.UsrToProtoPublicUsr(user)
 	if err != nil {
 		return nil, status.Error(codes.Internal, "failed to convert user")
 	}
@@ -167,3 +247,236 @@ func (s *serverAPI) Delete(ctx context.Context, in *umv1.DeleteRequest) (*umv1.D
 		User: userForResp,
 	}, nil
 }
+
+func (s *serverAPI) ChangePassword(ctx context.Context, in *umv1.ChangePasswordRequest) (*umv1.ChangePasswordResponse, error) {
+	userID := in.GetId()
+	if userID == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	parsedUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "user_id must be uuid")
+	}
+
+	if in.GetNewPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "new_password is required")
+	}
+
+	err = s.usersManager.ChangePassword(ctx, parsedUUID, in.GetOldPassword(), in.GetNewPassword())
+	if err != nil {
+		if errors.Is(err, usersmanager.ErrInvalidCredentials) {
+			return nil, newStatus(codes.InvalidArgument, ReasonInvalidCredentials, "invalid old password")
+		}
+
+		return nil, handleError(err, "failed to change password")
+	}
+
+	return &umv1.ChangePasswordResponse{}, nil
+}
+
+func (s *serverAPI) Authenticate(ctx context.Context, in *umv1.AuthenticateRequest) (*umv1.AuthenticateResponse, error) {
+	if in.GetEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+
+	if in.GetPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "password is required")
+	}
+
+	token, err := s.usersManager.Authenticate(ctx, in.GetEmail(), in.GetPassword())
+	if err != nil {
+		return nil, handleError(err, "failed to authenticate")
+	}
+
+	return &umv1.AuthenticateResponse{
+		Token: token,
+	}, nil
+}
+
+func (s *serverAPI) RestoreUser(ctx context.Context, in *umv1.RestoreUserRequest) (*umv1.RestoreUserResponse, error) {
+	userID := in.GetId()
+	if userID == "" {
+		return nil, status.Error(codes.InvalidArgument, "user_id is required")
+	}
+
+	parsedUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "user_id must be uuid")
+	}
+
+	user, err := s.usersManager.RestoreUser(ctx, parsedUUID)
+	if err != nil {
+		return nil, handleError(err, "failed to restore user")
+	}
+
+	userForResp, err := profiles.UsrToProtoPublicUsr(user)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to convert user")
+	}
+
+	return &umv1.RestoreUserResponse{
+		User: userForResp,
+	}, nil
+}
+
+func (s *serverAPI) BatchInsertUsers(ctx context.Context, in *umv1.BatchInsertUsersRequest) (*umv1.BatchInsertUsersResponse, error) {
+	mode, err := batchMode(in.GetMode(), len(in.GetUsers()))
+	if err != nil {
+		return nil, err
+	}
+
+	users, rejected := batchUsers(in.GetUsers())
+	results, err := batch.Run(users, rejected, mode, func(users []models.User) ([]models.BatchResult, error) {
+		return s.usersManager.BatchInsertUsers(ctx, users, mode)
+	})
+	if err != nil {
+		return nil, handleError(err, "failed to insert users")
+	}
+
+	return &umv1.BatchInsertUsersResponse{
+		Results: batchResultsToProto(results),
+	}, nil
+}
+
+func (s *serverAPI) BatchUpdateUsers(ctx context.Context, in *umv1.BatchUpdateUsersRequest) (*umv1.BatchUpdateUsersResponse, error) {
+	mode, err := batchMode(in.GetMode(), len(in.GetUsers()))
+	if err != nil {
+		return nil, err
+	}
+
+	users, rejected := batchUsers(in.GetUsers())
+	results, err := batch.Run(users, rejected, mode, func(users []models.User) ([]models.BatchResult, error) {
+		return s.usersManager.BatchUpdateUsers(ctx, users, mode)
+	})
+	if err != nil {
+		return nil, handleError(err, "failed to update users")
+	}
+
+	return &umv1.BatchUpdateUsersResponse{
+		Results: batchResultsToProto(results),
+	}, nil
+}
+
+func (s *serverAPI) BatchDeleteUsers(ctx context.Context, in *umv1.BatchDeleteUsersRequest) (*umv1.BatchDeleteUsersResponse, error) {
+	mode, err := batchMode(in.GetMode(), len(in.GetIds()))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uuid.UUID, len(in.GetIds()))
+	rejected := make([]error, len(in.GetIds()))
+	for i, id := range in.GetIds() {
+		if ids[i], err = uuid.Parse(id); err != nil {
+			rejected[i] = invalidField("id", "must be uuid")
+		}
+	}
+
+	results, err := batch.Run(ids, rejected, mode, func(ids []uuid.UUID) ([]models.BatchResult, error) {
+		return s.usersManager.BatchDeleteUsers(ctx, ids, mode)
+	})
+	if err != nil {
+		return nil, handleError(err, "failed to delete users")
+	}
+
+	return &umv1.BatchDeleteUsersResponse{
+		Results: batchResultsToProto(results),
+	}, nil
+}
+
+// batchMode converts the mode of a batch of size items.
+func batchMode(protoMode umv1.BatchMode, size int) (models.BatchMode, error) {
+	mode, err := profiles.ProtoBatchModeToMode(protoMode)
+	if err != nil {
+		return 0, status.Error(codes.InvalidArgument, "mode is not supported")
+	}
+
+	if size > usersmanager.MaxBatchSize {
+		return 0, status.Errorf(codes.InvalidArgument, "a batch holds at most %d items", usersmanager.MaxBatchSize)
+	}
+
+	return mode, nil
+}
+
+// batchUsers converts the users of a batch, those that cannot be converted
+// are rejected with a validation error.
+func batchUsers(protoUsers []*umv1.User) ([]models.User, []error) {
+	users := make([]models.User, len(protoUsers))
+	rejected := make([]error, len(protoUsers))
+	for i, protoUser := range protoUsers {
+		user, err := profiles.ProtoUsrToUsr(protoUser)
+		if err != nil {
+			rejected[i] = invalidField("id", "must be uuid")
+			continue
+		}
+		users[i] = user
+	}
+
+	return users, rejected
+}
+
+func invalidField(field string, description string) error {
+	return fmt.Errorf("%w: %w", usersmanager.ErrValidation, &validation.Error{
+		Violations: []validation.FieldViolation{{Field: field, Description: description}},
+	})
+}
+
+func batchResultsToProto(results []models.BatchResult) []*umv1.BatchItemResult {
+	protoResults := make([]*umv1.BatchItemResult, len(results))
+	for i, result := range results {
+		if result.Err != nil {
+			protoResults[i] = &umv1.BatchItemResult{Status: batchItemStatus(result.Err)}
+			continue
+		}
+
+		user, _ := profiles.UsrToProtoPublicUsr(result.User)
+		protoResults[i] = &umv1.BatchItemResult{
+			Status: &umv1.BatchItemStatus{Code: int32(codes.OK)},
+			User:   user,
+		}
+	}
+
+	return protoResults
+}
+
+func (s *serverAPI) ListAuditEvents(ctx context.Context, in *umv1.ListAuditEventsRequest) (*umv1.ListAuditEventsResponse, error) {
+	if in.GetPageSize() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "page_size must not be negative")
+	}
+
+	req := models.AuditPageRequest{
+		PageSize:  int(in.GetPageSize()),
+		PageToken: in.GetPageToken(),
+	}
+
+	var err error
+	if in.GetTargetId() != "" {
+		if req.TargetId, err = uuid.Parse(in.GetTargetId()); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "target_id must be uuid")
+		}
+	}
+	if in.GetActorId() != "" {
+		if req.ActorId, err = uuid.Parse(in.GetActorId()); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "actor_id must be uuid")
+		}
+	}
+
+	page, err := s.usersManager.ListAuditEvents(ctx, req)
+	if err != nil {
+		return nil, handleError(err, "failed to retrieve audit events")
+	}
+
+	events := make([]*umv1.AuditEvent, 0, len(page.Events))
+	for _, event := range page.Events {
+		events = append(events, profiles.AuditEventToProto(event))
+	}
+
+	return &umv1.ListAuditEventsResponse{
+		Events:        events,
+		NextPageToken: page.NextPageToken,
+	}, nil
+}
+
+func (s *serverAPI) Health(ctx context.Context, in *umv1.HealthRequest) (*umv1.HealthResponse, error) {
+	return profiles.StorageHealthToProto(s.usersManager.Health(ctx)), nil
+}
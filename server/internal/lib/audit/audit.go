@@ -0,0 +1,80 @@
+package audit
+
+import (
+	"context"
+	"server/internal/domain/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Redacted replaces the value of secret fields in a diff.
+const Redacted = "[REDACTED]"
+
+type ctxKey struct{}
+
+// WithEvent returns a copy of ctx carrying the audit event of the mutation
+// about to be made. The storage writes it together with the mutation.
+func WithEvent(ctx context.Context, event models.AuditEvent) context.Context {
+	return context.WithValue(ctx, ctxKey{}, event)
+}
+
+// EventFromContext returns the audit event stored in ctx.
+func EventFromContext(ctx context.Context) (models.AuditEvent, bool) {
+	event, ok := ctx.Value(ctxKey{}).(models.AuditEvent)
+	return event, ok
+}
+
+// ForTarget returns the event of a batch mutation for one of its targets. Every
+// target gets its own event id.
+func ForTarget(event models.AuditEvent, target uuid.UUID) models.AuditEvent {
+	event.Id = uuid.New()
+	event.TargetId = target
+
+	return event
+}
+
+// Diff lists the fields that differ between before and after, either of which
+// may be nil. Passwords are never written, only the fact that they changed.
+func Diff(before *models.User, after *models.User) []models.FieldChange {
+	var b, a models.User
+	if before != nil {
+		b = *before
+	}
+	if after != nil {
+		a = *after
+	}
+
+	var changes []models.FieldChange
+	add := func(field string, before string, after string) {
+		if before != after {
+			changes = append(changes, models.FieldChange{Field: field, Before: before, After: after})
+		}
+	}
+
+	add("email", b.Email, a.Email)
+	add("role", b.Role, a.Role)
+	add("nick", b.Nick, a.Nick)
+	if b.Password != a.Password {
+		changes = append(changes, models.FieldChange{Field: "password", Before: redact(b.Password), After: redact(a.Password)})
+	}
+	add("deleted_at", formatTime(b.DeletedAt), formatTime(a.DeletedAt))
+
+	return changes
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+
+	return Redacted
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339Nano)
+}
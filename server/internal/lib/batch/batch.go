@@ -0,0 +1,71 @@
+// Package batch helps the layers of a batch mutation reject some of its items
+// before passing the rest on.
+package batch
+
+import (
+	"errors"
+	"server/internal/domain/models"
+)
+
+// ErrAborted is the error of the items of an atomic batch that were not
+// applied because another item failed.
+var ErrAborted = errors.New("batch aborted")
+
+// Failed reports whether an item of the results failed.
+func Failed(results []models.BatchResult) bool {
+	for _, result := range results {
+		if result.Err != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Abort marks the applied items of the results as aborted, e.g. once the
+// transaction of an atomic batch has been rolled back.
+func Abort(results []models.BatchResult) {
+	for i := range results {
+		if results[i].Err == nil {
+			results[i] = models.BatchResult{Err: ErrAborted}
+		}
+	}
+}
+
+// Run passes the items whose rejected error is nil to fn and returns the
+// results of every item in order, the rejected ones failing with their error.
+// An atomic batch with a rejected item fails as a whole without calling fn.
+func Run[T any](items []T, rejected []error, mode models.BatchMode, fn func(items []T) ([]models.BatchResult, error)) ([]models.BatchResult, error) {
+	results := make([]models.BatchResult, len(items))
+	var passed []T
+	var positions []int
+	for i, item := range items {
+		if rejected[i] != nil {
+			results[i].Err = rejected[i]
+			continue
+		}
+		passed = append(passed, item)
+		positions = append(positions, i)
+	}
+
+	if len(passed) == len(items) {
+		return fn(items)
+	}
+	if mode == models.BatchAtomic {
+		Abort(results)
+		return results, nil
+	}
+	if len(passed) == 0 {
+		return results, nil
+	}
+
+	applied, err := fn(passed)
+	if err != nil {
+		return nil, err
+	}
+	for i, result := range applied {
+		results[positions[i]] = result
+	}
+
+	return results, nil
+}
@@ -0,0 +1,19 @@
+package identity
+
+import (
+	"context"
+	"server/internal/domain/models"
+)
+
+type ctxKey struct{}
+
+// WithIdentity returns a copy of ctx carrying the authenticated caller.
+func WithIdentity(ctx context.Context, identity models.Identity) context.Context {
+	return context.WithValue(ctx, ctxKey{}, identity)
+}
+
+// FromContext returns the authenticated caller stored in ctx.
+func FromContext(ctx context.Context) (models.Identity, bool) {
+	identity, ok := ctx.Value(ctxKey{}).(models.Identity)
+	return identity, ok
+}
@@ -0,0 +1,16 @@
+package requestid
+
+import "context"
+
+type ctxKey struct{}
+
+// WithRequestId returns a copy of ctx carrying the id of the current request.
+func WithRequestId(ctx context.Context, requestId string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, requestId)
+}
+
+// FromContext returns the request id stored in ctx or an empty string.
+func FromContext(ctx context.Context) string {
+	requestId, _ := ctx.Value(ctxKey{}).(string)
+	return requestId
+}
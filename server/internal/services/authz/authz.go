@@ -0,0 +1,335 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"server/internal/domain/interfaces"
+	"server/internal/domain/models"
+	"server/internal/lib/batch"
+	"server/internal/lib/identity"
+	"server/pkg/lib/email"
+
+	"github.com/google/uuid"
+)
+
+type Operation string
+
+const (
+	OpGetUsers       Operation = "get_users"
+	OpGetUserById    Operation = "get_user_by_id"
+	OpGetUserByEmail Operation = "get_user_by_email"
+	OpInsert         Operation = "insert"
+	OpUpdate         Operation = "update"
+	OpDelete         Operation = "delete"
+	OpChangePassword Operation = "change_password"
+	OpRestore        Operation = "restore"
+	// OpGetDeletedUsers is required on top of OpGetUsers to list soft-deleted users.
+	OpGetDeletedUsers Operation = "get_deleted_users"
+	OpListAuditEvents Operation = "list_audit_events"
+)
+
+// Scope limits which records an operation may touch.
+type Scope string
+
+const (
+	// ScopeAny allows the operation on every record.
+	ScopeAny Scope = "any"
+	// ScopeOwn allows the operation only on the caller's own record.
+	ScopeOwn Scope = "own"
+)
+
+var ErrPermissionDenied = errors.New("permission denied")
+
+var operations = map[Operation]struct{}{
+	OpGetUsers:        {},
+	OpGetUserById:     {},
+	OpGetUserByEmail:  {},
+	OpInsert:          {},
+	OpUpdate:          {},
+	OpDelete:          {},
+	OpChangePassword:  {},
+	OpRestore:         {},
+	OpGetDeletedUsers: {},
+	OpListAuditEvents: {},
+}
+
+// Policy maps a role to the operations it may perform and their scope.
+// Operations missing for a role are denied.
+type Policy map[string]map[Operation]Scope
+
+// NewPolicy builds a Policy from the role matrix of the config.
+func NewPolicy(roles map[string]map[string]string) (Policy, error) {
+	const op = "services.authz.NewPolicy"
+
+	policy := make(Policy, len(roles))
+	for role, permissions := range roles {
+		policy[role] = make(map[Operation]Scope, len(permissions))
+		for operation, scope := range permissions {
+			if _, ok := operations[Operation(operation)]; !ok {
+				return nil, fmt.Errorf("%s: role %q: unknown operation %q", op, role, operation)
+			}
+
+			if Scope(scope) != ScopeAny && Scope(scope) != ScopeOwn {
+				return nil, fmt.Errorf("%s: role %q: unknown scope %q for %q", op, role, scope, operation)
+			}
+
+			policy[role][Operation(operation)] = Scope(scope)
+		}
+	}
+
+	return policy, nil
+}
+
+// Roles returns the roles known to the policy.
+func (p Policy) Roles() []string {
+	roles := make([]string, 0, len(p))
+	for role := range p {
+		roles = append(roles, role)
+	}
+
+	return roles
+}
+
+// UsersManager enforces the policy in front of another interfaces.UsersManager.
+// The caller is taken from the identity stored in the request context.
+type UsersManager struct {
+	log        *slog.Logger
+	next       interfaces.UsersManager
+	policy     Policy
+	normalizer *email.Normalizer
+}
+
+func New(log *slog.Logger, next interfaces.UsersManager, policy Policy, normalizer *email.Normalizer) *UsersManager {
+	return &UsersManager{
+		log:        log,
+		next:       next,
+		policy:     policy,
+		normalizer: normalizer,
+	}
+}
+
+// authorize checks that the caller may perform op. owns reports whether the
+// target record belongs to the caller and is consulted only for ScopeOwn.
+func (a *UsersManager) authorize(ctx context.Context, op Operation, owns func(caller models.Identity) bool) error {
+	log := a.log.With(slog.String("op", "services.authz.authorize"), slog.String("operation", string(op)))
+
+	caller, ok := identity.FromContext(ctx)
+	if !ok {
+		log.Warn("No caller identity in context")
+		return fmt.Errorf("services.authz.%s: %w", op, ErrPermissionDenied)
+	}
+
+	scope, ok := a.policy[caller.Role][op]
+	switch {
+	case !ok:
+	case scope == ScopeAny:
+		return nil
+	case scope == ScopeOwn && owns != nil && owns(caller):
+		return nil
+	}
+
+	log.Warn("Permission denied", slog.String("userId", caller.UserId.String()), slog.String("role", caller.Role))
+	return fmt.Errorf("services.authz.%s: %w", op, ErrPermissionDenied)
+}
+
+// authorizeEach checks op on the n items of a batch, owns reports whether the
+// item i belongs to the caller. A caller who may not perform op at all is
+// denied the whole batch, otherwise one error per item is returned, nil for
+// the items the caller may touch.
+func (a *UsersManager) authorizeEach(ctx context.Context, op Operation, n int, owns func(i int, caller models.Identity) bool) ([]error, error) {
+	denied := make([]error, n)
+
+	caller, ok := identity.FromContext(ctx)
+	scope, allowed := a.policy[caller.Role][op]
+	switch {
+	case !ok || !allowed:
+		return nil, a.authorize(ctx, op, nil)
+	case scope == ScopeAny:
+		return denied, nil
+	}
+
+	for i := range n {
+		denied[i] = a.authorize(ctx, op, func(caller models.Identity) bool {
+			return owns(i, caller)
+		})
+	}
+
+	return denied, nil
+}
+
+func ownsId(uid uuid.UUID) func(models.Identity) bool {
+	return func(caller models.Identity) bool {
+		return caller.UserId == uid
+	}
+}
+
+func (a *UsersManager) GetUsers(ctx context.Context, req models.UsersPageRequest) (models.UsersPage, error) {
+	if err := a.authorize(ctx, OpGetUsers, nil); err != nil {
+		return models.UsersPage{}, err
+	}
+	if req.Filter.IncludeDeleted {
+		if err := a.authorize(ctx, OpGetDeletedUsers, nil); err != nil {
+			return models.UsersPage{}, err
+		}
+	}
+
+	return a.next.GetUsers(ctx, req)
+}
+
+// StreamUsers is an export of the user list and requires the get_users permission.
+func (a *UsersManager) StreamUsers(ctx context.Context, filter models.UsersFilter, sort models.UsersSort, fn func(models.User) error) error {
+	if err := a.authorize(ctx, OpGetUsers, nil); err != nil {
+		return err
+	}
+	if filter.IncludeDeleted {
+		if err := a.authorize(ctx, OpGetDeletedUsers, nil); err != nil {
+			return err
+		}
+	}
+
+	return a.next.StreamUsers(ctx, filter, sort, fn)
+}
+
+func (a *UsersManager) GetUserById(ctx context.Context, uid uuid.UUID) (models.User, error) {
+	if err := a.authorize(ctx, OpGetUserById, ownsId(uid)); err != nil {
+		return models.User{}, err
+	}
+
+	return a.next.GetUserById(ctx, uid)
+}
+
+// BatchGetUsers requires get_user_by_id on every id, a caller limited to
+// their own record is denied a batch holding other ids.
+func (a *UsersManager) BatchGetUsers(ctx context.Context, uids []uuid.UUID) ([]models.User, []uuid.UUID, error) {
+	denied, err := a.authorizeEach(ctx, OpGetUserById, len(uids), func(i int, caller models.Identity) bool {
+		return ownsId(uids[i])(caller)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, err := range denied {
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return a.next.BatchGetUsers(ctx, uids)
+}
+
+func (a *UsersManager) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	err := a.authorize(ctx, OpGetUserByEmail, func(caller models.Identity) bool {
+		return a.normalizer.Normalize(email) == a.normalizer.Normalize(caller.Email)
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return a.next.GetUserByEmail(ctx, email)
+}
+
+func (a *UsersManager) Insert(ctx context.Context, user models.User) error {
+	if err := a.authorize(ctx, OpInsert, nil); err != nil {
+		return err
+	}
+
+	return a.next.Insert(ctx, user)
+}
+
+// Update with ScopeOwn also forbids changing the caller's own role.
+func (a *UsersManager) Update(ctx context.Context, uid uuid.UUID, user models.User) error {
+	err := a.authorize(ctx, OpUpdate, func(caller models.Identity) bool {
+		return caller.UserId == uid && user.Role == caller.Role
+	})
+	if err != nil {
+		return err
+	}
+
+	return a.next.Update(ctx, uid, user)
+}
+
+func (a *UsersManager) Delete(ctx context.Context, uid uuid.UUID) (models.User, error) {
+	if err := a.authorize(ctx, OpDelete, ownsId(uid)); err != nil {
+		return models.User{}, err
+	}
+
+	return a.next.Delete(ctx, uid)
+}
+
+func (a *UsersManager) RestoreUser(ctx context.Context, uid uuid.UUID) (models.User, error) {
+	if err := a.authorize(ctx, OpRestore, ownsId(uid)); err != nil {
+		return models.User{}, err
+	}
+
+	return a.next.RestoreUser(ctx, uid)
+}
+
+func (a *UsersManager) BatchInsertUsers(ctx context.Context, users []models.User, mode models.BatchMode) ([]models.BatchResult, error) {
+	if err := a.authorize(ctx, OpInsert, nil); err != nil {
+		return nil, err
+	}
+
+	return a.next.BatchInsertUsers(ctx, users, mode)
+}
+
+// BatchUpdateUsers checks every user as Update does, the users the caller may
+// not update fail with ErrPermissionDenied.
+func (a *UsersManager) BatchUpdateUsers(ctx context.Context, users []models.User, mode models.BatchMode) ([]models.BatchResult, error) {
+	denied, err := a.authorizeEach(ctx, OpUpdate, len(users), func(i int, caller models.Identity) bool {
+		return caller.UserId == users[i].Id && users[i].Role == caller.Role
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return batch.Run(users, denied, mode, func(users []models.User) ([]models.BatchResult, error) {
+		return a.next.BatchUpdateUsers(ctx, users, mode)
+	})
+}
+
+// BatchDeleteUsers checks every user as Delete does.
+func (a *UsersManager) BatchDeleteUsers(ctx context.Context, uids []uuid.UUID, mode models.BatchMode) ([]models.BatchResult, error) {
+	denied, err := a.authorizeEach(ctx, OpDelete, len(uids), func(i int, caller models.Identity) bool {
+		return caller.UserId == uids[i]
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return batch.Run(uids, denied, mode, func(uids []uuid.UUID) ([]models.BatchResult, error) {
+		return a.next.BatchDeleteUsers(ctx, uids, mode)
+	})
+}
+
+// ListAuditEvents with ScopeOwn is limited to the history of the caller's own record.
+func (a *UsersManager) ListAuditEvents(ctx context.Context, req models.AuditPageRequest) (models.AuditPage, error) {
+	if err := a.authorize(ctx, OpListAuditEvents, ownsId(req.TargetId)); err != nil {
+		return models.AuditPage{}, err
+	}
+
+	return a.next.ListAuditEvents(ctx, req)
+}
+
+func (a *UsersManager) ChangePassword(ctx context.Context, uid uuid.UUID, oldPassword string, newPassword string) error {
+	if err := a.authorize(ctx, OpChangePassword, ownsId(uid)); err != nil {
+		return err
+	}
+
+	return a.next.ChangePassword(ctx, uid, oldPassword, newPassword)
+}
+
+// VerifyCredentials is not restricted, the caller proves the identity with the password.
+func (a *UsersManager) VerifyCredentials(ctx context.Context, email string, password string) (models.User, error) {
+	return a.next.VerifyCredentials(ctx, email, password)
+}
+
+// Authenticate is not restricted, it is how callers obtain an identity.
+func (a *UsersManager) Authenticate(ctx context.Context, email string, password string) (string, error) {
+	return a.next.Authenticate(ctx, email, password)
+}
+
+// Health is not restricted, it reveals nothing about the users.
+func (a *UsersManager) Health(ctx context.Context) models.StorageHealth {
+	return a.next.Health(ctx)
+}
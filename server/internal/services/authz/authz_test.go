@@ -0,0 +1,459 @@
+package authz_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"server/internal/domain/models"
+	"server/internal/lib/batch"
+	"server/internal/lib/identity"
+	"server/internal/services/authz"
+	"server/pkg/lib/email"
+
+	"github.com/google/uuid"
+)
+
+// stubUsersManager records the calls that got past the authz layer.
+type stubUsersManager struct {
+	calls   int
+	updated []uuid.UUID
+}
+
+func (s *stubUsersManager) GetUsers(context.Context, models.UsersPageRequest) (models.UsersPage, error) {
+	s.calls++
+	return models.UsersPage{}, nil
+}
+
+func (s *stubUsersManager) StreamUsers(context.Context, models.UsersFilter, models.UsersSort, func(models.User) error) error {
+	s.calls++
+	return nil
+}
+
+func (s *stubUsersManager) GetUserById(context.Context, uuid.UUID) (models.User, error) {
+	s.calls++
+	return models.User{}, nil
+}
+
+func (s *stubUsersManager) BatchGetUsers(context.Context, []uuid.UUID) ([]models.User, []uuid.UUID, error) {
+	s.calls++
+	return nil, nil, nil
+}
+
+func (s *stubUsersManager) GetUserByEmail(context.Context, string) (models.User, error) {
+	s.calls++
+	return models.User{}, nil
+}
+
+func (s *stubUsersManager) Insert(context.Context, models.User) error {
+	s.calls++
+	return nil
+}
+
+func (s *stubUsersManager) Update(context.Context, uuid.UUID, models.User) error {
+	s.calls++
+	return nil
+}
+
+func (s *stubUsersManager) Delete(context.Context, uuid.UUID) (models.User, error) {
+	s.calls++
+	return models.User{}, nil
+}
+
+func (s *stubUsersManager) RestoreUser(context.Context, uuid.UUID) (models.User, error) {
+	s.calls++
+	return models.User{}, nil
+}
+
+func (s *stubUsersManager) BatchInsertUsers(_ context.Context, users []models.User, _ models.BatchMode) ([]models.BatchResult, error) {
+	s.calls++
+	return make([]models.BatchResult, len(users)), nil
+}
+
+func (s *stubUsersManager) BatchUpdateUsers(_ context.Context, users []models.User, _ models.BatchMode) ([]models.BatchResult, error) {
+	s.calls++
+	results := make([]models.BatchResult, len(users))
+	for i, user := range users {
+		s.updated = append(s.updated, user.Id)
+		results[i].User = user
+	}
+	return results, nil
+}
+
+func (s *stubUsersManager) BatchDeleteUsers(_ context.Context, uids []uuid.UUID, _ models.BatchMode) ([]models.BatchResult, error) {
+	s.calls++
+	return make([]models.BatchResult, len(uids)), nil
+}
+
+func (s *stubUsersManager) ListAuditEvents(context.Context, models.AuditPageRequest) (models.AuditPage, error) {
+	s.calls++
+	return models.AuditPage{}, nil
+}
+
+func (s *stubUsersManager) ChangePassword(context.Context, uuid.UUID, string, string) error {
+	s.calls++
+	return nil
+}
+
+func (s *stubUsersManager) VerifyCredentials(context.Context, string, string) (models.User, error) {
+	s.calls++
+	return models.User{}, nil
+}
+
+func (s *stubUsersManager) Authenticate(context.Context, string, string) (string, error) {
+	s.calls++
+	return "", nil
+}
+
+func (s *stubUsersManager) Health(context.Context) models.StorageHealth {
+	s.calls++
+	return models.StorageHealth{}
+}
+
+// roles is the role matrix under test: admin may do anything, user only
+// touches their own record and support mixes both scopes.
+var roles = map[string]map[string]string{
+	"admin": {
+		"get_users":         "any",
+		"get_user_by_id":    "any",
+		"get_user_by_email": "any",
+		"insert":            "any",
+		"update":            "any",
+		"delete":            "any",
+		"change_password":   "any",
+		"restore":           "any",
+		"get_deleted_users": "any",
+		"list_audit_events": "any",
+	},
+	"user": {
+		"get_user_by_id":    "own",
+		"get_user_by_email": "own",
+		"update":            "own",
+		"change_password":   "own",
+		"list_audit_events": "own",
+	},
+	"support": {
+		"get_users":         "any",
+		"get_user_by_id":    "any",
+		"get_user_by_email": "any",
+		"insert":            "own",
+		"update":            "own",
+		"delete":            "own",
+		"restore":           "own",
+		"list_audit_events": "any",
+	},
+}
+
+func newAuthz(t *testing.T) (*authz.UsersManager, *stubUsersManager) {
+	t.Helper()
+
+	policy, err := authz.NewPolicy(roles)
+	if err != nil {
+		t.Fatalf("NewPolicy() error = %v", err)
+	}
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	next := &stubUsersManager{}
+	return authz.New(log, next, policy, email.New(false)), next
+}
+
+func callerContext(role string) (context.Context, models.Identity) {
+	caller := models.Identity{UserId: uuid.New(), Email: "caller@example.com", Role: role}
+	return identity.WithIdentity(context.Background(), caller), caller
+}
+
+// operation calls an authz method guarded by op on the target record.
+type operation struct {
+	op   authz.Operation
+	call func(ctx context.Context, a *authz.UsersManager, caller models.Identity, target uuid.UUID) error
+}
+
+// emailOf returns the email of the target, the caller's email when the target
+// is the caller.
+func emailOf(caller models.Identity, target uuid.UUID) string {
+	if target == caller.UserId {
+		// The comparison is done on normalized emails.
+		return strings.ToUpper(caller.Email)
+	}
+	return target.String() + "@example.com"
+}
+
+var operations = []operation{
+	{op: authz.OpGetUsers, call: func(ctx context.Context, a *authz.UsersManager, _ models.Identity, _ uuid.UUID) error {
+		_, err := a.GetUsers(ctx, models.UsersPageRequest{})
+		return err
+	}},
+	{op: authz.OpGetUsers, call: func(ctx context.Context, a *authz.UsersManager, _ models.Identity, _ uuid.UUID) error {
+		return a.StreamUsers(ctx, models.UsersFilter{}, models.UsersSort{}, func(models.User) error { return nil })
+	}},
+	{op: authz.OpGetUserById, call: func(ctx context.Context, a *authz.UsersManager, _ models.Identity, target uuid.UUID) error {
+		_, err := a.GetUserById(ctx, target)
+		return err
+	}},
+	{op: authz.OpGetUserByEmail, call: func(ctx context.Context, a *authz.UsersManager, caller models.Identity, target uuid.UUID) error {
+		_, err := a.GetUserByEmail(ctx, emailOf(caller, target))
+		return err
+	}},
+	{op: authz.OpInsert, call: func(ctx context.Context, a *authz.UsersManager, _ models.Identity, _ uuid.UUID) error {
+		return a.Insert(ctx, models.User{})
+	}},
+	{op: authz.OpInsert, call: func(ctx context.Context, a *authz.UsersManager, _ models.Identity, _ uuid.UUID) error {
+		_, err := a.BatchInsertUsers(ctx, []models.User{{}}, models.BatchAtomic)
+		return err
+	}},
+	{op: authz.OpUpdate, call: func(ctx context.Context, a *authz.UsersManager, caller models.Identity, target uuid.UUID) error {
+		return a.Update(ctx, target, models.User{Id: target, Role: caller.Role})
+	}},
+	{op: authz.OpDelete, call: func(ctx context.Context, a *authz.UsersManager, _ models.Identity, target uuid.UUID) error {
+		_, err := a.Delete(ctx, target)
+		return err
+	}},
+	{op: authz.OpChangePassword, call: func(ctx context.Context, a *authz.UsersManager, _ models.Identity, target uuid.UUID) error {
+		return a.ChangePassword(ctx, target, "old password", "new password")
+	}},
+	{op: authz.OpRestore, call: func(ctx context.Context, a *authz.UsersManager, _ models.Identity, target uuid.UUID) error {
+		_, err := a.RestoreUser(ctx, target)
+		return err
+	}},
+	{op: authz.OpListAuditEvents, call: func(ctx context.Context, a *authz.UsersManager, _ models.Identity, target uuid.UUID) error {
+		_, err := a.ListAuditEvents(ctx, models.AuditPageRequest{TargetId: target})
+		return err
+	}},
+}
+
+// targeted lists the operations that act on a single record and so can be
+// allowed with ScopeOwn.
+var targeted = map[authz.Operation]bool{
+	authz.OpGetUserById:     true,
+	authz.OpGetUserByEmail:  true,
+	authz.OpUpdate:          true,
+	authz.OpDelete:          true,
+	authz.OpChangePassword:  true,
+	authz.OpRestore:         true,
+	authz.OpListAuditEvents: true,
+}
+
+func TestPolicyMatrix(t *testing.T) {
+	for _, role := range []string{"admin", "user", "support", "unknown"} {
+		for _, own := range []bool{true, false} {
+			for _, operation := range operations {
+				scope := roles[role][string(operation.op)]
+				want := scope == "any" || scope == "own" && own && targeted[operation.op]
+
+				a, next := newAuthz(t)
+				ctx, caller := callerContext(role)
+				target := uuid.New()
+				if own {
+					target = caller.UserId
+				}
+
+				err := operation.call(ctx, a, caller, target)
+				switch {
+				case want && err != nil:
+					t.Errorf("%s by %s, own = %v: error = %v, want nil", operation.op, role, own, err)
+				case !want && !errors.Is(err, authz.ErrPermissionDenied):
+					t.Errorf("%s by %s, own = %v: error = %v, want %v", operation.op, role, own, err, authz.ErrPermissionDenied)
+				}
+				if (next.calls == 1) != want {
+					t.Errorf("%s by %s, own = %v: next called %d times, want allowed = %v", operation.op, role, own, next.calls, want)
+				}
+			}
+		}
+	}
+}
+
+func TestNoIdentity(t *testing.T) {
+	for _, operation := range operations {
+		a, next := newAuthz(t)
+
+		err := operation.call(context.Background(), a, models.Identity{}, uuid.Nil)
+		if !errors.Is(err, authz.ErrPermissionDenied) {
+			t.Errorf("%s without identity: error = %v, want %v", operation.op, err, authz.ErrPermissionDenied)
+		}
+		if next.calls != 0 {
+			t.Errorf("%s without identity: next called %d times", operation.op, next.calls)
+		}
+	}
+}
+
+func TestUpdateOwnRoleChange(t *testing.T) {
+	tests := []struct {
+		name    string
+		role    string
+		newRole string
+		wantErr error
+	}{
+		{name: "own scope keeps the role", role: "user", newRole: "user"},
+		{name: "own scope changes the role", role: "user", newRole: "admin", wantErr: authz.ErrPermissionDenied},
+		{name: "own scope clears the role", role: "user", newRole: "", wantErr: authz.ErrPermissionDenied},
+		{name: "any scope changes the role", role: "admin", newRole: "user"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _ := newAuthz(t)
+			ctx, caller := callerContext(tt.role)
+
+			err := a.Update(ctx, caller.UserId, models.User{Id: caller.UserId, Role: tt.newRole})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Update() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetDeletedUsers(t *testing.T) {
+	tests := []struct {
+		role    string
+		wantErr error
+	}{
+		{role: "admin"},
+		// support may list the users but not the deleted ones.
+		{role: "support", wantErr: authz.ErrPermissionDenied},
+		{role: "user", wantErr: authz.ErrPermissionDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.role, func(t *testing.T) {
+			a, _ := newAuthz(t)
+			ctx, _ := callerContext(tt.role)
+			filter := models.UsersFilter{IncludeDeleted: true}
+
+			if _, err := a.GetUsers(ctx, models.UsersPageRequest{Filter: filter}); !errors.Is(err, tt.wantErr) {
+				t.Errorf("GetUsers() error = %v, want %v", err, tt.wantErr)
+			}
+			err := a.StreamUsers(ctx, filter, models.UsersSort{}, func(models.User) error { return nil })
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("StreamUsers() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBatchGetUsers(t *testing.T) {
+	a, next := newAuthz(t)
+	ctx, caller := callerContext("user")
+
+	if _, _, err := a.BatchGetUsers(ctx, []uuid.UUID{caller.UserId}); err != nil {
+		t.Fatalf("BatchGetUsers() of the own id error = %v", err)
+	}
+	if _, _, err := a.BatchGetUsers(ctx, []uuid.UUID{caller.UserId, uuid.New()}); !errors.Is(err, authz.ErrPermissionDenied) {
+		t.Errorf("BatchGetUsers() with another id error = %v, want %v", err, authz.ErrPermissionDenied)
+	}
+	if next.calls != 1 {
+		t.Errorf("next called %d times, want 1", next.calls)
+	}
+}
+
+func TestBatchUpdateUsers(t *testing.T) {
+	ctx, caller := callerContext("user")
+	users := []models.User{
+		{Id: caller.UserId, Role: "user"},
+		{Id: uuid.New(), Role: "user"},
+		{Id: caller.UserId, Role: "admin"},
+	}
+
+	t.Run("best effort", func(t *testing.T) {
+		a, next := newAuthz(t)
+
+		results, err := a.BatchUpdateUsers(ctx, users, models.BatchBestEffort)
+		if err != nil {
+			t.Fatalf("BatchUpdateUsers() error = %v", err)
+		}
+
+		wantErrs := []error{nil, authz.ErrPermissionDenied, authz.ErrPermissionDenied}
+		for i, want := range wantErrs {
+			if !errors.Is(results[i].Err, want) {
+				t.Errorf("results[%d].Err = %v, want %v", i, results[i].Err, want)
+			}
+		}
+		if len(next.updated) != 1 || next.updated[0] != caller.UserId {
+			t.Errorf("next updated %v, want only %v", next.updated, caller.UserId)
+		}
+	})
+
+	t.Run("atomic", func(t *testing.T) {
+		a, next := newAuthz(t)
+
+		results, err := a.BatchUpdateUsers(ctx, users, models.BatchAtomic)
+		if err != nil {
+			t.Fatalf("BatchUpdateUsers() error = %v", err)
+		}
+
+		wantErrs := []error{batch.ErrAborted, authz.ErrPermissionDenied, authz.ErrPermissionDenied}
+		for i, want := range wantErrs {
+			if !errors.Is(results[i].Err, want) {
+				t.Errorf("results[%d].Err = %v, want %v", i, results[i].Err, want)
+			}
+		}
+		if next.calls != 0 {
+			t.Errorf("next called %d times, want 0", next.calls)
+		}
+	})
+}
+
+func TestBatchDeleteUsers(t *testing.T) {
+	tests := []struct {
+		name     string
+		role     string
+		own      []bool
+		wantErr  error
+		wantErrs []error
+	}{
+		{name: "any scope", role: "admin", own: []bool{false, false}, wantErrs: []error{nil, nil}},
+		{name: "own scope", role: "support", own: []bool{true, false}, wantErrs: []error{nil, authz.ErrPermissionDenied}},
+		{name: "not allowed", role: "user", own: []bool{true}, wantErr: authz.ErrPermissionDenied},
+		{name: "unknown role", role: "unknown", own: []bool{true}, wantErr: authz.ErrPermissionDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _ := newAuthz(t)
+			ctx, caller := callerContext(tt.role)
+
+			uids := make([]uuid.UUID, len(tt.own))
+			for i, own := range tt.own {
+				uids[i] = uuid.New()
+				if own {
+					uids[i] = caller.UserId
+				}
+			}
+
+			results, err := a.BatchDeleteUsers(ctx, uids, models.BatchBestEffort)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("BatchDeleteUsers() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(results) != len(tt.wantErrs) {
+				t.Fatalf("BatchDeleteUsers() returned %d results, want %d", len(results), len(tt.wantErrs))
+			}
+			for i, want := range tt.wantErrs {
+				if !errors.Is(results[i].Err, want) {
+					t.Errorf("results[%d].Err = %v, want %v", i, results[i].Err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		roles   map[string]map[string]string
+		wantErr bool
+	}{
+		{name: "valid", roles: roles},
+		{name: "unknown operation", roles: map[string]map[string]string{"user": {"drop_users": "any"}}, wantErr: true},
+		{name: "unknown scope", roles: map[string]map[string]string{"user": {"get_users": "all"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := authz.NewPolicy(tt.roles); (err != nil) != tt.wantErr {
+				t.Errorf("NewPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package purger
+
+import (
+	"context"
+	"log/slog"
+	"server/internal/domain/interfaces"
+	"server/pkg/lib/logger/sl"
+	"time"
+)
+
+// Purger periodically removes users that were soft-deleted longer than the
+// retention ago.
+type Purger struct {
+	log       *slog.Logger
+	storage   interfaces.Storage
+	retention time.Duration
+	interval  time.Duration
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+func New(log *slog.Logger, storage interfaces.Storage, retention time.Duration, interval time.Duration) *Purger {
+	return &Purger{
+		log:       log,
+		storage:   storage,
+		retention: retention,
+		interval:  interval,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Run purges once right away and then every interval until Stop is called.
+// A non-positive retention or interval disables purging.
+func (p *Purger) Run() {
+	const op = "services.purger.Run"
+	log := p.log.With(slog.String("op", op))
+	defer close(p.done)
+
+	if p.retention <= 0 || p.interval <= 0 {
+		log.Info("purging of deleted users is disabled")
+		<-p.stop
+		return
+	}
+
+	log.Info("starting purger", slog.Duration("retention", p.retention), slog.Duration("interval", p.interval))
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.purge()
+
+		select {
+		case <-ticker.C:
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// Stop ends Run and waits for the purge in progress to finish.
+func (p *Purger) Stop() {
+	const op = "services.purger.Stop"
+
+	p.log.With(slog.String("op", op)).Info("stopping purger")
+
+	close(p.stop)
+	<-p.done
+}
+
+func (p *Purger) purge() {
+	const op = "services.purger.purge"
+	log := p.log.With(slog.String("op", op))
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.interval)
+	defer cancel()
+
+	deletedBefore := time.Now().Add(-p.retention)
+	purged, err := p.storage.Purge(ctx, deletedBefore)
+	if err != nil {
+		log.Error("failed to purge deleted users", sl.Err(err))
+		return
+	}
+
+	if purged > 0 {
+		log.Info("purged deleted users", slog.Int64("count", purged), slog.Time("deletedBefore", deletedBefore))
+	}
+}
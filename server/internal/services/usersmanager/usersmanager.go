@@ -5,45 +5,190 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"runtime"
 	"server/internal/domain/interfaces"
 	"server/internal/domain/models"
+	"server/internal/domain/validation"
+	"server/internal/lib/audit"
+	"server/internal/lib/batch"
+	"server/internal/lib/identity"
+	"server/internal/lib/requestid"
 	"server/internal/storage"
+	"server/pkg/lib/email"
+	"server/pkg/lib/jwt"
 	"server/pkg/lib/logger/sl"
+	"server/pkg/lib/pagetoken"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"golang.org/x/sync/errgroup"
 )
 
 type UsersManager struct {
-	log     *slog.Logger
-	storage interfaces.Storage
+	log         *slog.Logger
+	storage     interfaces.Storage
+	hasher      interfaces.PasswordHasher
+	validator   *validation.Validator
+	normalizer  *email.Normalizer
+	tokenSecret string
+	tokenTTL    time.Duration
+	// dummyHash is verified for unknown emails, so they take as long as
+	// known ones and logins do not reveal which emails exist.
+	dummyHash string
 }
 
-var ErrInvalidCredentials = errors.New("invalid credentials")
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+	// MaxBatchSize bounds the items of a batch.
+	MaxBatchSize = 500
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrValidation         = errors.New("validation failed")
+)
+
+// errBatchFailed rolls back the transaction of an atomic batch with a failed item.
+var errBatchFailed = errors.New("batch item failed")
+
+func New(log *slog.Logger, storage interfaces.Storage, hasher interfaces.PasswordHasher, validator *validation.Validator, normalizer *email.Normalizer, tokenSecret string, tokenTTL time.Duration) *UsersManager {
+	dummyHash, err := hasher.Hash("dummy password")
+	if err != nil {
+		log.Error("Failed to hash the dummy password", slog.String("operation", "services.usersmanager.New"), sl.Err(err))
+	}
 
-func New(log *slog.Logger, storage interfaces.Storage) *UsersManager {
 	return &UsersManager{
-		log:     log,
-		storage: storage,
+		log:         log,
+		storage:     storage,
+		hasher:      hasher,
+		validator:   validator,
+		normalizer:  normalizer,
+		tokenSecret: tokenSecret,
+		tokenTTL:    tokenTTL,
+		dummyHash:   dummyHash,
 	}
 }
 
-func (u *UsersManager) GetUsers(ctx context.Context) ([]models.User, error) {
+// pageToken ties the cursor to the filter and sort of the query that produced it.
+type pageToken struct {
+	Filter models.UsersFilter
+	Sort   models.UsersSort
+	After  models.UsersCursor
+}
+
+// GetUsers returns one page of users. PageSize is clamped to [1, MaxPageSize]
+// with 0 meaning DefaultPageSize, an empty PageToken starts from the first page.
+func (u *UsersManager) GetUsers(ctx context.Context, req models.UsersPageRequest) (models.UsersPage, error) {
 	const op = "services.usersmanager.getUsers"
 	log := u.log.With(slog.String("operation", op))
 
-	users, err := u.storage.GetUsers(ctx)
+	pageSize := req.PageSize
+	switch {
+	case pageSize <= 0:
+		pageSize = DefaultPageSize
+	case pageSize > MaxPageSize:
+		pageSize = MaxPageSize
+	}
+
+	filter, sort, err := u.prepareQuery(req.Filter, req.Sort)
 	if err != nil {
-		if errors.Is(err, storage.ErrNotFound) {
-			log.Warn("%s: %w", op, ErrInvalidCredentials)
+		log.Warn("Invalid users filter", sl.Err(err))
+		return models.UsersPage{}, fmt.Errorf("%s: %w", op, err)
+	}
 
-			return nil, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	query := models.UsersQuery{Filter: filter, Sort: sort, Limit: pageSize + 1}
+	if req.PageToken != "" {
+		var token pageToken
+		if err := pagetoken.Decode(req.PageToken, &token); err != nil {
+			log.Warn("Invalid page token", sl.Err(err))
+			return models.UsersPage{}, fmt.Errorf("%s: %w: %w", op, ErrValidation, &validation.Error{
+				Violations: []validation.FieldViolation{{Field: "page_token", Description: "is malformed"}},
+			})
 		}
 
+		if !token.Filter.Equal(filter) || token.Sort != sort {
+			log.Warn("Page token does not match the query")
+			return models.UsersPage{}, fmt.Errorf("%s: %w: %w", op, ErrValidation, &validation.Error{
+				Violations: []validation.FieldViolation{{Field: "page_token", Description: "does not match the filter or sort of the request"}},
+			})
+		}
+		query.After = &token.After
+	}
+
+	users, err := u.storage.GetUsers(ctx, query)
+	if err != nil {
 		log.Error("Failed to retrieve users", sl.Err(err))
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return models.UsersPage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	page := models.UsersPage{Users: users}
+	if len(users) > pageSize {
+		page.Users = users[:pageSize]
+
+		last := page.Users[pageSize-1]
+		page.NextPageToken, err = pagetoken.Encode(pageToken{Filter: filter, Sort: sort, After: sort.Cursor(last)})
+		if err != nil {
+			log.Error("Failed to encode page token", sl.Err(err))
+			return models.UsersPage{}, fmt.Errorf("%s: %w", op, err)
+		}
 	}
 
-	return users, nil
+	return page, nil
+}
+
+// StreamUsers calls fn for every user matching the filter in the sort order.
+// Users are read from the storage one at a time, so fn controls the pace.
+func (u *UsersManager) StreamUsers(ctx context.Context, filter models.UsersFilter, sort models.UsersSort, fn func(models.User) error) error {
+	const op = "services.usersmanager.streamUsers"
+	log := u.log.With(slog.String("operation", op))
+
+	filter, sort, err := u.prepareQuery(filter, sort)
+	if err != nil {
+		log.Warn("Invalid users filter", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	count := 0
+	err = u.storage.StreamUsers(ctx, models.UsersQuery{Filter: filter, Sort: sort}, func(user models.User) error {
+		count++
+		return fn(user)
+	})
+	if err != nil {
+		log.Error("Failed to stream users", slog.Int("sent", count), sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("Users streamed", slog.Int("count", count))
+	return nil
+}
+
+// prepareQuery normalizes and validates the filter and fills in the default sort.
+func (u *UsersManager) prepareQuery(filter models.UsersFilter, sort models.UsersSort) (models.UsersFilter, models.UsersSort, error) {
+	filter.EmailDomain = strings.ToLower(strings.TrimSpace(filter.EmailDomain))
+	// Postgres keeps microseconds, so both backends compare the same instants.
+	filter.CreatedAfter = truncateTime(filter.CreatedAfter)
+	filter.CreatedBefore = truncateTime(filter.CreatedBefore)
+
+	if err := u.validator.ValidateUsersFilter(filter); err != nil {
+		return models.UsersFilter{}, models.UsersSort{}, fmt.Errorf("%w: %w", ErrValidation, err)
+	}
+
+	if sort.Field == "" {
+		sort.Field = models.SortByCreatedAt
+	}
+
+	return filter, sort, nil
+}
+
+func truncateTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+
+	return t.UTC().Truncate(time.Microsecond)
 }
 
 func (u *UsersManager) GetUserById(ctx context.Context, id uuid.UUID) (models.User, error) {
@@ -52,10 +197,10 @@ func (u *UsersManager) GetUserById(ctx context.Context, id uuid.UUID) (models.Us
 
 	user, err := u.storage.GetUserById(ctx, id)
 	if err != nil {
-		if errors.Is(err, storage.ErrNotFound) {
-			log.Warn("%s: %w", op, ErrInvalidCredentials)
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("User not found", sl.Err(err))
 
-			return models.User{}, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+			return models.User{}, fmt.Errorf("%s: %w", op, err)
 		}
 
 		log.Error("Failed to retrieve user by id", sl.Err(err))
@@ -65,16 +210,48 @@ func (u *UsersManager) GetUserById(ctx context.Context, id uuid.UUID) (models.Us
 	return user, nil
 }
 
+func (u *UsersManager) BatchGetUsers(ctx context.Context, ids []uuid.UUID) ([]models.User, []uuid.UUID, error) {
+	const op = "services.usersmanager.batchGetUsers"
+	log := u.log.With(slog.String("operation", op))
+
+	if err := checkBatchSize("ids", len(ids)); err != nil {
+		log.Warn("Batch too large", slog.Int("count", len(ids)))
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	users, err := u.storage.GetUsersByIds(ctx, ids)
+	if err != nil {
+		log.Error("Failed to retrieve users by ids", sl.Err(err))
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	found := make(map[uuid.UUID]struct{}, len(users))
+	for _, user := range users {
+		found[user.Id] = struct{}{}
+	}
+
+	var missing []uuid.UUID
+	for _, id := range ids {
+		if _, ok := found[id]; !ok {
+			found[id] = struct{}{}
+			missing = append(missing, id)
+		}
+	}
+
+	log.Info("Users retrieved", slog.Int("count", len(users)), slog.Int("missing", len(missing)))
+	return users, missing, nil
+}
+
 func (u *UsersManager) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
 	const op = "services.usersmanager.getUserByEmail"
 	log := u.log.With(slog.String("operation", op))
 
-	user, err := u.storage.GetUserByEmail(ctx, email)
+	user, err := u.storage.GetUserByEmail(ctx, u.normalizer.Normalize(email))
 	if err != nil {
-		if errors.Is(err, storage.ErrNotFound) {
-			log.Warn("%s: %w", op, ErrInvalidCredentials)
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("User not found", sl.Err(err))
 
-			return models.User{}, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+			return models.User{}, fmt.Errorf("%s: %w", op, err)
 		}
 
 		log.Error("Failed to retrieve user by email", sl.Err(err))
@@ -88,12 +265,29 @@ func (u *UsersManager) Insert(ctx context.Context, user models.User) error {
 	const op = "services.usersmanager.insert"
 	log := u.log.With(slog.String("operation", op))
 
-	err := u.storage.Insert(ctx, user)
+	user.Email = u.normalizer.Normalize(user.Email)
+
+	if err := u.validator.ValidateNewUser(user); err != nil {
+		log.Warn("Invalid user", sl.Err(err))
+		return fmt.Errorf("%s: %w: %w", op, ErrValidation, err)
+	}
+
+	hash, err := u.hasher.Hash(user.Password)
+	if err != nil {
+		log.Error("Failed to hash password", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	user.Password = hash
+	user.Version = 1
+	touch(ctx, &user)
+	user.CreatedAt = user.UpdatedAt
+
+	err = u.storage.Insert(u.audited(ctx, models.AuditInsert, user.Id), user)
 	if err != nil {
-		if errors.Is(err, storage.ErrNotFound) {
-			log.Warn("%s: %w", op, ErrInvalidCredentials)
+		if errors.Is(err, storage.ErrUserExists) {
+			log.Warn("User already exists", slog.String("email", user.Email))
 
-			return fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+			return fmt.Errorf("%s: %w", op, err)
 		}
 
 		log.Error("Failed to insert user", sl.Err(err))
@@ -107,16 +301,52 @@ func (u *UsersManager) Update(ctx context.Context, id uuid.UUID, user models.Use
 	const op = "services.usermanager.update"
 	log := u.log.With(slog.String("op", op))
 
-	err := u.storage.Update(ctx, id, user)
+	user.Email = u.normalizer.Normalize(user.Email)
+
+	if err := u.validator.ValidateUser(user); err != nil {
+		log.Warn("Invalid user", sl.Err(err))
+		return fmt.Errorf("%s: %w: %w", op, ErrValidation, err)
+	}
+
+	if user.Version <= 0 {
+		log.Warn("Update without version", slog.String("userId", id.String()))
+		return fmt.Errorf("%s: %w: %w", op, ErrValidation, &validation.Error{
+			Violations: []validation.FieldViolation{{Field: "version", Description: "must be the version of the user being updated"}},
+		})
+	}
+
+	// The password is read and written back in one transaction, so a password
+	// changed meanwhile is not overwritten.
+	err := u.storage.WithTx(ctx, func(tx interfaces.Storage) error {
+		current, err := tx.GetUserById(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if current.Version != user.Version {
+			log.Warn("User has changed since it was read", slog.String("userId", id.String()), slog.Int64("version", user.Version), slog.Int64("current", current.Version))
+			return storage.ErrConflict
+		}
+
+		// Passwords are changed only through ChangePassword.
+		user.Password = current.Password
+		user.CreatedAt = current.CreatedAt
+		touch(ctx, &user)
+
+		return tx.Update(u.audited(ctx, models.AuditUpdate, id), id, user)
+	})
 	if err != nil {
-		if errors.Is(err, storage.ErrNotFound) {
-			log.Warn("%s: %w", op, ErrInvalidCredentials)
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("User not found", sl.Err(err))
 
-			return fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if errors.Is(err, storage.ErrConflict) {
+			return fmt.Errorf("%s: %w", op, err)
 		}
 
-		log.Error("Failed to update user:", sl.Err(err))
-		return fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+		log.Error("Failed to update user", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
 	return nil
@@ -126,17 +356,434 @@ func (u *UsersManager) Delete(ctx context.Context, id uuid.UUID) (models.User, e
 	const op = "services.usermanager.delete"
 	log := u.log.With(slog.String("op", op))
 
-	user, err := u.storage.Delete(ctx, id)
+	user, err := u.storage.Delete(u.audited(ctx, models.AuditDelete, id), id)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("User not found", sl.Err(err))
+
+			return models.User{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		log.Error("Failed to delete user", sl.Err(err))
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return user, nil
+}
+
+// RestoreUser brings back a soft-deleted user.
+func (u *UsersManager) RestoreUser(ctx context.Context, id uuid.UUID) (models.User, error) {
+	const op = "services.usersmanager.restoreUser"
+	log := u.log.With(slog.String("operation", op))
+
+	user, err := u.storage.Restore(u.audited(ctx, models.AuditRestore, id), id)
 	if err != nil {
-		if errors.Is(err, storage.ErrNotFound) {
-			log.Warn("%s: %w", op, ErrInvalidCredentials)
+		if errors.Is(err, storage.ErrUserNotFound) || errors.Is(err, storage.ErrUserExists) {
+			log.Warn("Failed to restore user", slog.String("userId", id.String()), sl.Err(err))
 
+			return models.User{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		log.Error("Failed to restore user", slog.String("userId", id.String()), sl.Err(err))
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("User restored", slog.String("userId", id.String()))
+	return user, nil
+}
+
+// BatchInsertUsers inserts the users as Insert does. Invalid users fail
+// before the storage is written, the passwords of the others are hashed in
+// parallel.
+func (u *UsersManager) BatchInsertUsers(ctx context.Context, users []models.User, mode models.BatchMode) ([]models.BatchResult, error) {
+	const op = "services.usersmanager.batchInsertUsers"
+	log := u.log.With(slog.String("operation", op))
+
+	if err := checkBatchSize("users", len(users)); err != nil {
+		log.Warn("Batch too large", slog.Int("count", len(users)))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	users = slices.Clone(users)
+	rejected := make([]error, len(users))
+	for i := range users {
+		users[i].Email = u.normalizer.Normalize(users[i].Email)
+		if err := u.validator.ValidateNewUser(users[i]); err != nil {
+			log.Warn("Invalid user", slog.Int("index", i), sl.Err(err))
+			rejected[i] = fmt.Errorf("%s: %w: %w", op, ErrValidation, err)
+		}
+	}
+
+	results, err := batch.Run(users, rejected, mode, func(users []models.User) ([]models.BatchResult, error) {
+		if err := u.hashPasswords(ctx, users); err != nil {
+			return nil, err
+		}
+		for i := range users {
+			users[i].Version = 1
+			touch(ctx, &users[i])
+			users[i].CreatedAt = users[i].UpdatedAt
+		}
+
+		return u.applyBatch(ctx, mode, func(s interfaces.Storage) ([]models.BatchResult, error) {
+			return s.InsertUsers(u.audited(ctx, models.AuditInsert, uuid.Nil), users)
+		})
+	})
+	if err != nil {
+		log.Error("Failed to insert users", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("Users inserted", slog.Int("count", len(users)), slog.Int("failed", countFailed(results)))
+	return results, nil
+}
+
+// BatchUpdateUsers updates the users by their ids as Update does.
+func (u *UsersManager) BatchUpdateUsers(ctx context.Context, users []models.User, mode models.BatchMode) ([]models.BatchResult, error) {
+	const op = "services.usersmanager.batchUpdateUsers"
+	log := u.log.With(slog.String("operation", op))
+
+	if err := checkBatchSize("users", len(users)); err != nil {
+		log.Warn("Batch too large", slog.Int("count", len(users)))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	users = slices.Clone(users)
+	rejected := make([]error, len(users))
+	for i := range users {
+		users[i].Email = u.normalizer.Normalize(users[i].Email)
+		if err := u.validator.ValidateUser(users[i]); err != nil {
+			log.Warn("Invalid user", slog.Int("index", i), sl.Err(err))
+			rejected[i] = fmt.Errorf("%s: %w: %w", op, ErrValidation, err)
+			continue
+		}
+
+		if users[i].Version <= 0 {
+			log.Warn("Update without version", slog.Int("index", i), slog.String("userId", users[i].Id.String()))
+			rejected[i] = fmt.Errorf("%s: %w: %w", op, ErrValidation, &validation.Error{
+				Violations: []validation.FieldViolation{{Field: "version", Description: "must be the version of the user being updated"}},
+			})
+			continue
+		}
+		touch(ctx, &users[i])
+	}
+
+	results, err := batch.Run(users, rejected, mode, func(users []models.User) ([]models.BatchResult, error) {
+		return u.applyBatch(ctx, mode, func(s interfaces.Storage) ([]models.BatchResult, error) {
+			return s.UpdateUsers(u.audited(ctx, models.AuditUpdate, uuid.Nil), users)
+		})
+	})
+	if err != nil {
+		log.Error("Failed to update users", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("Users updated", slog.Int("count", len(users)), slog.Int("failed", countFailed(results)))
+	return results, nil
+}
+
+// BatchDeleteUsers deletes the users as Delete does.
+func (u *UsersManager) BatchDeleteUsers(ctx context.Context, ids []uuid.UUID, mode models.BatchMode) ([]models.BatchResult, error) {
+	const op = "services.usersmanager.batchDeleteUsers"
+	log := u.log.With(slog.String("operation", op))
+
+	if err := checkBatchSize("ids", len(ids)); err != nil {
+		log.Warn("Batch too large", slog.Int("count", len(ids)))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	results, err := u.applyBatch(ctx, mode, func(s interfaces.Storage) ([]models.BatchResult, error) {
+		return s.DeleteUsers(u.audited(ctx, models.AuditDelete, uuid.Nil), ids)
+	})
+	if err != nil {
+		log.Error("Failed to delete users", sl.Err(err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("Users deleted", slog.Int("count", len(ids)), slog.Int("failed", countFailed(results)))
+	return results, nil
+}
+
+func checkBatchSize(field string, size int) error {
+	if size > MaxBatchSize {
+		return fmt.Errorf("%w: %w", ErrValidation, &validation.Error{
+			Violations: []validation.FieldViolation{{Field: field, Description: fmt.Sprintf("must hold at most %d items", MaxBatchSize)}},
+		})
+	}
+
+	return nil
+}
+
+func countFailed(results []models.BatchResult) int {
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
+
+	return failed
+}
+
+// applyBatch runs the storage mutation of a batch. An atomic batch runs in a
+// transaction that is rolled back when an item fails, its applied items then
+// fail with batch.ErrAborted.
+func (u *UsersManager) applyBatch(ctx context.Context, mode models.BatchMode, fn func(s interfaces.Storage) ([]models.BatchResult, error)) ([]models.BatchResult, error) {
+	if mode == models.BatchBestEffort {
+		return fn(u.storage)
+	}
+
+	var results []models.BatchResult
+	err := u.storage.WithTx(ctx, func(tx interfaces.Storage) error {
+		var err error
+		results, err = fn(tx)
+		if err != nil {
+			return err
+		}
+		if batch.Failed(results) {
+			return errBatchFailed
+		}
+		return nil
+	})
+	if errors.Is(err, errBatchFailed) {
+		batch.Abort(results)
+		return results, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// hashPasswords replaces the passwords of the users with their hashes, on as
+// many goroutines as there are CPUs.
+func (u *UsersManager) hashPasswords(ctx context.Context, users []models.User) error {
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(runtime.GOMAXPROCS(0))
+	for i := range users {
+		g.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			hash, err := u.hasher.Hash(users[i].Password)
+			if err != nil {
+				return err
+			}
+			users[i].Password = hash
+			return nil
+		})
+	}
+
+	return g.Wait()
+}
+
+// ChangePassword replaces the password of the user after checking the old one.
+func (u *UsersManager) ChangePassword(ctx context.Context, id uuid.UUID, oldPassword string, newPassword string) error {
+	const op = "services.usersmanager.changePassword"
+	log := u.log.With(slog.String("operation", op))
+
+	if err := u.validator.ValidatePassword(newPassword); err != nil {
+		log.Warn("Invalid password", sl.Err(err))
+		return fmt.Errorf("%s: %w: %w", op, ErrValidation, err)
+	}
+
+	user, err := u.storage.GetUserById(ctx, id)
+	if err != nil {
+		log.Warn("Failed to retrieve user", slog.String("userId", id.String()), sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	ok, _, err := u.hasher.Verify(oldPassword, user.Password)
+	if err != nil {
+		log.Error("Failed to verify password", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !ok {
+		log.Warn("Invalid old password", slog.String("userId", id.String()))
+		return fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	}
+
+	hash, err := u.hasher.Hash(newPassword)
+	if err != nil {
+		log.Error("Failed to hash password", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	user.Password = hash
+	touch(ctx, &user)
+
+	// Hashing is too slow to hold a transaction for, the version read above
+	// makes the update fail if the user changed meanwhile.
+	if err := u.storage.Update(u.audited(ctx, models.AuditChangePassword, id), id, user); err != nil {
+		log.Error("Failed to update password", slog.String("userId", id.String()), sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("Password changed", slog.String("userId", id.String()))
+	return nil
+}
+
+// touch stamps the user as changed now by the caller stored in ctx. Values
+// sent by clients are never kept.
+func touch(ctx context.Context, user *models.User) {
+	caller, _ := identity.FromContext(ctx)
+	user.UpdatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	user.UpdatedBy = caller.UserId
+}
+
+// audited attaches the audit event of the operation on target to ctx. The
+// caller and the request id are taken from ctx, the storage fills in the diff.
+func (u *UsersManager) audited(ctx context.Context, operation string, target uuid.UUID) context.Context {
+	caller, _ := identity.FromContext(ctx)
+
+	return audit.WithEvent(ctx, models.AuditEvent{
+		Id:         uuid.New(),
+		OccurredAt: time.Now().UTC().Truncate(time.Microsecond),
+		RequestId:  requestid.FromContext(ctx),
+		ActorId:    caller.UserId,
+		Operation:  operation,
+		TargetId:   target,
+	})
+}
+
+// auditPageToken ties the cursor to the filter of the query that produced it.
+type auditPageToken struct {
+	TargetId uuid.UUID
+	ActorId  uuid.UUID
+	After    models.AuditCursor
+}
+
+// ListAuditEvents returns one page of audit events, newest first, paged the
+// same way as GetUsers.
+func (u *UsersManager) ListAuditEvents(ctx context.Context, req models.AuditPageRequest) (models.AuditPage, error) {
+	const op = "services.usersmanager.listAuditEvents"
+	log := u.log.With(slog.String("operation", op))
+
+	pageSize := req.PageSize
+	switch {
+	case pageSize <= 0:
+		pageSize = DefaultPageSize
+	case pageSize > MaxPageSize:
+		pageSize = MaxPageSize
+	}
+
+	query := models.AuditQuery{TargetId: req.TargetId, ActorId: req.ActorId, Limit: pageSize + 1}
+	if req.PageToken != "" {
+		var token auditPageToken
+		if err := pagetoken.Decode(req.PageToken, &token); err != nil {
+			log.Warn("Invalid page token", sl.Err(err))
+			return models.AuditPage{}, fmt.Errorf("%s: %w: %w", op, ErrValidation, &validation.Error{
+				Violations: []validation.FieldViolation{{Field: "page_token", Description: "is malformed"}},
+			})
+		}
+
+		if token.TargetId != req.TargetId || token.ActorId != req.ActorId {
+			log.Warn("Page token does not match the query")
+			return models.AuditPage{}, fmt.Errorf("%s: %w: %w", op, ErrValidation, &validation.Error{
+				Violations: []validation.FieldViolation{{Field: "page_token", Description: "does not match the filter of the request"}},
+			})
+		}
+		query.After = &token.After
+	}
+
+	events, err := u.storage.GetAuditEvents(ctx, query)
+	if err != nil {
+		log.Error("Failed to retrieve audit events", sl.Err(err))
+		return models.AuditPage{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	page := models.AuditPage{Events: events}
+	if len(events) > pageSize {
+		page.Events = events[:pageSize]
+
+		last := page.Events[pageSize-1]
+		page.NextPageToken, err = pagetoken.Encode(auditPageToken{
+			TargetId: req.TargetId,
+			ActorId:  req.ActorId,
+			After:    models.AuditCursor{OccurredAt: last.OccurredAt, Id: last.Id},
+		})
+		if err != nil {
+			log.Error("Failed to encode page token", sl.Err(err))
+			return models.AuditPage{}, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return page, nil
+}
+
+// VerifyCredentials checks the password of the user with the given email.
+// Passwords stored in plaintext or with outdated hash parameters are
+// re-hashed on successful verification.
+func (u *UsersManager) VerifyCredentials(ctx context.Context, email string, password string) (models.User, error) {
+	const op = "services.usersmanager.verifyCredentials"
+	log := u.log.With(slog.String("operation", op))
+
+	email = u.normalizer.Normalize(email)
+	user, err := u.storage.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			_, _, _ = u.hasher.Verify(password, u.dummyHash)
+			log.Warn("User not found", slog.String("email", email))
 			return models.User{}, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
 		}
 
-		log.Error("Failed to update user:", sl.Err(err))
+		log.Error("Failed to retrieve user by email", sl.Err(err))
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	ok, needsRehash, err := u.hasher.Verify(password, user.Password)
+	if err != nil {
+		log.Error("Failed to verify password", sl.Err(err))
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !ok {
+		log.Warn("Invalid password", slog.String("email", email))
 		return models.User{}, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
 	}
 
+	if needsRehash {
+		hash, err := u.hasher.Hash(password)
+		if err != nil {
+			log.Error("Failed to hash password", sl.Err(err))
+			return user, nil
+		}
+
+		user.Password = hash
+		touch(ctx, &user)
+		if err := u.storage.Update(u.audited(ctx, models.AuditRehashPassword, user.Id), user.Id, user); err != nil {
+			log.Error("Failed to upgrade password hash", slog.String("userId", user.Id.String()), sl.Err(err))
+			return user, nil
+		}
+
+		log.Info("Password hash upgraded", slog.String("userId", user.Id.String()))
+	}
+
 	return user, nil
 }
+
+// Authenticate verifies the credentials and issues a signed access token.
+func (u *UsersManager) Authenticate(ctx context.Context, email string, password string) (string, error) {
+	const op = "services.usersmanager.authenticate"
+	log := u.log.With(slog.String("operation", op))
+
+	user, err := u.VerifyCredentials(ctx, email, password)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	token, err := jwt.NewToken(user.Id, user.Email, user.Role, u.tokenSecret, u.tokenTTL)
+	if err != nil {
+		log.Error("Failed to generate token", sl.Err(err))
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("User authenticated", slog.String("userId", user.Id.String()))
+	return token, nil
+}
+
+// Health reports the storage backend serving requests.
+func (u *UsersManager) Health(ctx context.Context) models.StorageHealth {
+	return u.storage.Health(ctx)
+}
@@ -0,0 +1,411 @@
+// Package cache wraps a storage with a read-through cache of the users looked
+// up by id or email. Writes go to the wrapped storage and drop the users they
+// touch from the cache, so a replica sees its own writes at once and those of
+// other replicas once the entries expire.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"server/internal/domain/interfaces"
+	"server/internal/domain/models"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type entry struct {
+	user      models.User
+	email     string
+	expiresAt time.Time
+}
+
+// Cache is a bounded LRU of users with a TTL, each user is found by id and by
+// email. It is safe for concurrent use.
+type Cache struct {
+	next     interfaces.Storage
+	capacity int
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	lru     *list.List // of *entry, most recently used first
+	byId    map[uuid.UUID]*list.Element
+	byEmail map[string]*list.Element
+	// generation grows on every invalidation. A read stores what it fetched
+	// only when no invalidation happened meanwhile, so a write racing with the
+	// read cannot leave the old user cached.
+	generation uint64
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+// New caches up to capacity users of next for ttl.
+func New(next interfaces.Storage, capacity int, ttl time.Duration) *Cache {
+	return &Cache{
+		next:     next,
+		capacity: capacity,
+		ttl:      ttl,
+		lru:      list.New(),
+		byId:     make(map[uuid.UUID]*list.Element, capacity),
+		byEmail:  make(map[string]*list.Element, capacity),
+	}
+}
+
+// emailKey matches the storages, which compare emails case-insensitively.
+func emailKey(email string) string {
+	return strings.ToLower(email)
+}
+
+// clone keeps callers from changing the cached user through DeletedAt.
+func clone(user models.User) models.User {
+	if user.DeletedAt != nil {
+		deletedAt := *user.DeletedAt
+		user.DeletedAt = &deletedAt
+	}
+
+	return user
+}
+
+// lookup returns the cached user found by find and the generation to pass to
+// store on a miss.
+func (c *Cache) lookup(find func() (*list.Element, bool)) (models.User, uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := find()
+	if ok && time.Now().Before(elem.Value.(*entry).expiresAt) {
+		c.lru.MoveToFront(elem)
+		c.hits.Add(1)
+		return clone(elem.Value.(*entry).user), c.generation, true
+	}
+	if ok {
+		c.remove(elem)
+	}
+
+	c.misses.Add(1)
+	return models.User{}, c.generation, false
+}
+
+// store caches the user unless the cache was invalidated since generation.
+func (c *Cache) store(user models.User, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	if elem, ok := c.byId[user.Id]; ok {
+		c.remove(elem)
+	}
+	key := emailKey(user.Email)
+	if elem, ok := c.byEmail[key]; ok {
+		c.remove(elem)
+	}
+
+	elem := c.lru.PushFront(&entry{
+		user:      clone(user),
+		email:     key,
+		expiresAt: time.Now().Add(c.ttl),
+	})
+	c.byId[user.Id] = elem
+	c.byEmail[key] = elem
+
+	for c.lru.Len() > c.capacity {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove drops elem, the caller holds mu.
+func (c *Cache) remove(elem *list.Element) {
+	e := c.lru.Remove(elem).(*entry)
+	delete(c.byId, e.user.Id)
+	delete(c.byEmail, e.email)
+}
+
+// invalidate drops the users with the given id or email, an empty email or a
+// nil id matches nothing.
+func (c *Cache) invalidate(id uuid.UUID, email string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	if elem, ok := c.byId[id]; ok {
+		c.remove(elem)
+	}
+	if elem, ok := c.byEmail[emailKey(email)]; ok && email != "" {
+		c.remove(elem)
+	}
+}
+
+// Stats returns the cache counters.
+func (c *Cache) Stats() models.CacheStats {
+	c.mu.Lock()
+	size := c.lru.Len()
+	c.mu.Unlock()
+
+	return models.CacheStats{
+		Hits:     c.hits.Load(),
+		Misses:   c.misses.Load(),
+		Size:     size,
+		Capacity: c.capacity,
+	}
+}
+
+func (c *Cache) GetUserById(ctx context.Context, uid uuid.UUID) (models.User, error) {
+	user, generation, ok := c.lookup(func() (*list.Element, bool) {
+		elem, ok := c.byId[uid]
+		return elem, ok
+	})
+	if ok {
+		return user, nil
+	}
+
+	user, err := c.next.GetUserById(ctx, uid)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	c.store(user, generation)
+	return user, nil
+}
+
+// GetUsersByIds serves the cached users and fetches the others from the
+// wrapped storage at once.
+func (c *Cache) GetUsersByIds(ctx context.Context, uids []uuid.UUID) ([]models.User, error) {
+	cached := make(map[uuid.UUID]models.User, len(uids))
+	var missed []uuid.UUID
+	var generation uint64
+	for i, uid := range uids {
+		user, gen, ok := c.lookup(func() (*list.Element, bool) {
+			elem, ok := c.byId[uid]
+			return elem, ok
+		})
+		if i == 0 {
+			generation = gen
+		}
+		if ok {
+			cached[uid] = user
+		} else {
+			missed = append(missed, uid)
+		}
+	}
+
+	if len(missed) > 0 {
+		fetched, err := c.next.GetUsersByIds(ctx, missed)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, user := range fetched {
+			c.store(user, generation)
+			cached[user.Id] = user
+		}
+	}
+
+	users := make([]models.User, 0, len(cached))
+	for _, uid := range uids {
+		if user, ok := cached[uid]; ok {
+			users = append(users, user)
+			delete(cached, uid)
+		}
+	}
+
+	return users, nil
+}
+
+func (c *Cache) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	user, generation, ok := c.lookup(func() (*list.Element, bool) {
+		elem, ok := c.byEmail[emailKey(email)]
+		return elem, ok
+	})
+	if ok {
+		return user, nil
+	}
+
+	user, err := c.next.GetUserByEmail(ctx, email)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	c.store(user, generation)
+	return user, nil
+}
+
+func (c *Cache) GetUsers(ctx context.Context, query models.UsersQuery) ([]models.User, error) {
+	return c.next.GetUsers(ctx, query)
+}
+
+func (c *Cache) StreamUsers(ctx context.Context, query models.UsersQuery, fn func(models.User) error) error {
+	return c.next.StreamUsers(ctx, query, fn)
+}
+
+// The writes invalidate even when they fail, the outcome of a failed write,
+// e.g. on a lost connection, is not known.
+
+func (c *Cache) Insert(ctx context.Context, user models.User) error {
+	defer c.invalidate(user.Id, user.Email)
+
+	return c.next.Insert(ctx, user)
+}
+
+func (c *Cache) Update(ctx context.Context, uid uuid.UUID, user models.User) error {
+	// The entry found by id holds the old email as well.
+	defer c.invalidate(uid, user.Email)
+
+	return c.next.Update(ctx, uid, user)
+}
+
+func (c *Cache) Delete(ctx context.Context, uid uuid.UUID) (models.User, error) {
+	defer c.invalidate(uid, "")
+
+	return c.next.Delete(ctx, uid)
+}
+
+func (c *Cache) Restore(ctx context.Context, uid uuid.UUID) (models.User, error) {
+	defer c.invalidate(uid, "")
+
+	return c.next.Restore(ctx, uid)
+}
+
+func (c *Cache) InsertUsers(ctx context.Context, users []models.User) ([]models.BatchResult, error) {
+	defer func() {
+		for _, user := range users {
+			c.invalidate(user.Id, user.Email)
+		}
+	}()
+
+	return c.next.InsertUsers(ctx, users)
+}
+
+func (c *Cache) UpdateUsers(ctx context.Context, users []models.User) ([]models.BatchResult, error) {
+	defer func() {
+		for _, user := range users {
+			c.invalidate(user.Id, user.Email)
+		}
+	}()
+
+	return c.next.UpdateUsers(ctx, users)
+}
+
+func (c *Cache) DeleteUsers(ctx context.Context, uids []uuid.UUID) ([]models.BatchResult, error) {
+	defer func() {
+		for _, uid := range uids {
+			c.invalidate(uid, "")
+		}
+	}()
+
+	return c.next.DeleteUsers(ctx, uids)
+}
+
+// Purge needs no invalidation, it removes only deleted users and those are
+// never cached.
+func (c *Cache) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	return c.next.Purge(ctx, deletedBefore)
+}
+
+// WithTx runs fn on the transaction of the wrapped storage, uncached. The
+// users written in it are invalidated when it ends, whatever the outcome.
+func (c *Cache) WithTx(ctx context.Context, fn func(tx interfaces.Storage) error) error {
+	written := &written{}
+	defer func() {
+		written.mu.Lock()
+		defer written.mu.Unlock()
+
+		for _, user := range written.users {
+			c.invalidate(user.id, user.email)
+		}
+	}()
+
+	return c.next.WithTx(ctx, func(tx interfaces.Storage) error {
+		return fn(txStorage{Storage: tx, written: written})
+	})
+}
+
+// written records the users to invalidate once a transaction ends.
+type written struct {
+	mu    sync.Mutex
+	users []writtenUser
+}
+
+type writtenUser struct {
+	id    uuid.UUID
+	email string
+}
+
+func (w *written) add(id uuid.UUID, email string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.users = append(w.users, writtenUser{id: id, email: email})
+}
+
+// txStorage is the transaction of the wrapped storage recording its writes.
+type txStorage struct {
+	interfaces.Storage
+	written *written
+}
+
+func (t txStorage) Insert(ctx context.Context, user models.User) error {
+	t.written.add(user.Id, user.Email)
+	return t.Storage.Insert(ctx, user)
+}
+
+func (t txStorage) Update(ctx context.Context, uid uuid.UUID, user models.User) error {
+	t.written.add(uid, user.Email)
+	return t.Storage.Update(ctx, uid, user)
+}
+
+func (t txStorage) Delete(ctx context.Context, uid uuid.UUID) (models.User, error) {
+	t.written.add(uid, "")
+	return t.Storage.Delete(ctx, uid)
+}
+
+func (t txStorage) Restore(ctx context.Context, uid uuid.UUID) (models.User, error) {
+	t.written.add(uid, "")
+	return t.Storage.Restore(ctx, uid)
+}
+
+func (t txStorage) InsertUsers(ctx context.Context, users []models.User) ([]models.BatchResult, error) {
+	for _, user := range users {
+		t.written.add(user.Id, user.Email)
+	}
+	return t.Storage.InsertUsers(ctx, users)
+}
+
+func (t txStorage) UpdateUsers(ctx context.Context, users []models.User) ([]models.BatchResult, error) {
+	for _, user := range users {
+		t.written.add(user.Id, user.Email)
+	}
+	return t.Storage.UpdateUsers(ctx, users)
+}
+
+func (t txStorage) DeleteUsers(ctx context.Context, uids []uuid.UUID) ([]models.BatchResult, error) {
+	for _, uid := range uids {
+		t.written.add(uid, "")
+	}
+	return t.Storage.DeleteUsers(ctx, uids)
+}
+
+func (t txStorage) WithTx(ctx context.Context, fn func(tx interfaces.Storage) error) error {
+	return t.Storage.WithTx(ctx, func(tx interfaces.Storage) error {
+		return fn(txStorage{Storage: tx, written: t.written})
+	})
+}
+
+func (c *Cache) GetAuditEvents(ctx context.Context, query models.AuditQuery) ([]models.AuditEvent, error) {
+	return c.next.GetAuditEvents(ctx, query)
+}
+
+// Health reports the wrapped storage along with the cache counters.
+func (c *Cache) Health(ctx context.Context) models.StorageHealth {
+	health := c.next.Health(ctx)
+	stats := c.Stats()
+	health.Cache = &stats
+
+	return health
+}
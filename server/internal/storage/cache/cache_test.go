@@ -0,0 +1,116 @@
+package cache_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"server/internal/domain/models"
+	"server/internal/storage/cache"
+	"server/internal/storage/memory"
+
+	"github.com/google/uuid"
+)
+
+func TestCache(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx := context.Background()
+
+	backend := memory.New(log)
+	c := cache.New(backend, 2, time.Minute)
+
+	users := make([]models.User, 3)
+	for i := range users {
+		users[i] = models.User{Id: uuid.New(), Email: uuid.NewString() + "@mail.com", Role: "user", Version: 1}
+		if err := c.Insert(ctx, users[i]); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+
+	wantStats := func(hits uint64, misses uint64, size int) {
+		t.Helper()
+		if stats := c.Stats(); stats.Hits != hits || stats.Misses != misses || stats.Size != size {
+			t.Fatalf("Stats() = %+v, want hits %d, misses %d, size %d", stats, hits, misses, size)
+		}
+	}
+
+	// The lookup by email is served by the entry cached by id.
+	if _, err := c.GetUserById(ctx, users[0].Id); err != nil {
+		t.Fatalf("GetUserById() error = %v", err)
+	}
+	if _, err := c.GetUserByEmail(ctx, users[0].Email); err != nil {
+		t.Fatalf("GetUserByEmail() error = %v", err)
+	}
+	wantStats(1, 1, 1)
+
+	// Reading two more users evicts the least recently used one.
+	for _, user := range users[1:] {
+		if _, err := c.GetUserById(ctx, user.Id); err != nil {
+			t.Fatalf("GetUserById() error = %v", err)
+		}
+	}
+	if _, err := c.GetUserById(ctx, users[0].Id); err != nil {
+		t.Fatalf("GetUserById() error = %v", err)
+	}
+	wantStats(1, 4, 2)
+
+	// An update is seen at once.
+	updated := users[0]
+	updated.Nick = "renamed"
+	if err := c.Update(ctx, updated.Id, updated); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	got, err := c.GetUserById(ctx, updated.Id)
+	if err != nil {
+		t.Fatalf("GetUserById() error = %v", err)
+	}
+	if got.Nick != "renamed" {
+		t.Fatalf("GetUserById() after Update returned nick %q, want %q", got.Nick, "renamed")
+	}
+
+	// Expired entries are fetched again.
+	expiring := cache.New(backend, 2, time.Nanosecond)
+	for i := 0; i < 2; i++ {
+		if _, err := expiring.GetUserById(ctx, users[1].Id); err != nil {
+			t.Fatalf("GetUserById() error = %v", err)
+		}
+	}
+	if stats := expiring.Stats(); stats.Hits != 0 || stats.Misses != 2 {
+		t.Fatalf("Stats() = %+v, want no hits and 2 misses", stats)
+	}
+}
+
+func TestGetUsersByIds(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx := context.Background()
+
+	c := cache.New(memory.New(log), 10, time.Minute)
+	users := make([]models.User, 3)
+	for i := range users {
+		users[i] = models.User{Id: uuid.New(), Email: uuid.NewString() + "@mail.com", Role: "user", Version: 1}
+		if err := c.Insert(ctx, users[i]); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+	if _, err := c.GetUserById(ctx, users[0].Id); err != nil {
+		t.Fatalf("GetUserById() error = %v", err)
+	}
+
+	// Only the users not cached yet are fetched, the result keeps the order
+	// of the ids.
+	ids := []uuid.UUID{users[2].Id, uuid.New(), users[0].Id, users[1].Id}
+	for _, wantHits := range []uint64{1, 4} {
+		got, err := c.GetUsersByIds(ctx, ids)
+		if err != nil {
+			t.Fatalf("GetUsersByIds() error = %v", err)
+		}
+		if len(got) != 3 || got[0].Id != users[2].Id || got[1].Id != users[0].Id || got[2].Id != users[1].Id {
+			t.Fatalf("GetUsersByIds() = %+v, want users 2, 0 and 1", got)
+		}
+		if stats := c.Stats(); stats.Hits != wantHits || stats.Size != 3 {
+			t.Fatalf("Stats() = %+v, want %d hits and size 3", stats, wantHits)
+		}
+	}
+}
@@ -0,0 +1,440 @@
+// Package file persists users in a data directory for deployments without
+// Postgres. The users are served from memory. Every change is appended to a
+// write-ahead log before it is applied, and the log is compacted into a
+// snapshot from time to time. Open loads the snapshot and replays the log,
+// dropping a record torn by a crash.
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"server/internal/domain/models"
+	"server/internal/storage"
+	"server/internal/storage/memory"
+	"server/pkg/lib/logger/sl"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	snapshotFile = "snapshot.json"
+	walFile      = "wal.log"
+)
+
+// Fsync policies of the write-ahead log.
+const (
+	// FsyncAlways syncs every change before it is acknowledged.
+	FsyncAlways = "always"
+	// FsyncInterval syncs every FsyncInterval, a crash of the machine loses
+	// the changes made since the last sync.
+	FsyncInterval = "interval"
+	// FsyncNever leaves syncing to the operating system.
+	FsyncNever = "never"
+)
+
+type Options struct {
+	Dir           string
+	Fsync         string
+	FsyncInterval time.Duration
+	// SnapshotInterval is how often the log is compacted.
+	SnapshotInterval time.Duration
+	// SnapshotRecords compacts the log early once it holds that many records,
+	// zero disables it.
+	SnapshotRecords int
+}
+
+// record is a line of the write-ahead log, holding the changes of one
+// mutation or transaction. Seq grows by one with every record and goes on from
+// the snapshot, so records already in the snapshot are skipped on replay.
+type record struct {
+	Seq     uint64          `json:"seq"`
+	Changes []memory.Change `json:"changes"`
+}
+
+type snapshot struct {
+	Seq uint64 `json:"seq"`
+	memory.State
+}
+
+type FileStorage struct {
+	*memory.MemoryStorage
+	log  *slog.Logger
+	opts Options
+	wal  *os.File
+
+	// seq, size and records describe the log. They are only used by the
+	// journal and in Snapshot, which the memory storage runs one at a time.
+	seq     uint64
+	size    int64
+	records int
+	// failing is set while changes cannot be written to the log.
+	failing atomic.Bool
+
+	compact chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+
+	// running is set by Run, Stop waits for done only then. stopped keeps
+	// Run from starting after Stop and a second Stop from closing twice.
+	runMu   sync.Mutex
+	running bool
+	stopped bool
+}
+
+// Open loads the storage kept in opts.Dir, creating the directory if needed.
+func Open(log *slog.Logger, opts Options) (*FileStorage, error) {
+	const op = "storage.file.Open"
+
+	switch opts.Fsync {
+	case FsyncAlways, FsyncNever:
+	case FsyncInterval:
+		if opts.FsyncInterval <= 0 {
+			return nil, fmt.Errorf("%s: fsync interval must be positive", op)
+		}
+	default:
+		return nil, fmt.Errorf("%s: unknown fsync policy %q", op, opts.Fsync)
+	}
+	if opts.SnapshotInterval <= 0 {
+		return nil, fmt.Errorf("%s: snapshot interval must be positive", op)
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	s := &FileStorage{
+		log:     log,
+		opts:    opts,
+		compact: make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	s.MemoryStorage = memory.NewJournaled(log, s.append)
+
+	if err := s.loadSnapshot(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if err := s.replay(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("File storage opened", slog.String("op", op), slog.String("dir", opts.Dir), slog.Uint64("seq", s.seq), slog.Int("records", s.records))
+	return s, nil
+}
+
+func (s *FileStorage) loadSnapshot() error {
+	data, err := os.ReadFile(filepath.Join(s.opts.Dir, snapshotFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("invalid snapshot: %w", err)
+	}
+
+	s.MemoryStorage.Load(snap.State)
+	s.seq = snap.Seq
+	return nil
+}
+
+// replay applies the records of the log written after the snapshot. The log
+// is cut at the first record that is torn or out of sequence, nothing after
+// it can be trusted.
+func (s *FileStorage) replay() error {
+	const op = "storage.file.replay"
+
+	wal, err := os.OpenFile(filepath.Join(s.opts.Dir, walFile), os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(wal)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) && len(line) == 0 {
+			break
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			wal.Close()
+			return err
+		}
+
+		rec, ok := decode(line)
+		if !ok || rec.Seq > s.seq+1 {
+			s.log.Warn("Dropping torn or corrupt tail of the write-ahead log", slog.String("op", op), slog.Int64("offset", offset), slog.Uint64("seq", s.seq))
+			if err := wal.Truncate(offset); err != nil {
+				wal.Close()
+				return err
+			}
+			if err := wal.Sync(); err != nil {
+				wal.Close()
+				return err
+			}
+			break
+		}
+
+		if rec.Seq == s.seq+1 {
+			for _, change := range rec.Changes {
+				s.MemoryStorage.Apply(change)
+			}
+			s.seq = rec.Seq
+		}
+		offset += int64(len(line))
+		s.records++
+	}
+
+	s.wal = wal
+	s.size = offset
+	return nil
+}
+
+// encode returns the log line of the record: the hex CRC-32 of the JSON
+// encoded record, a space and the JSON.
+func encode(rec record) ([]byte, error) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	line := fmt.Appendf(nil, "%08x ", crc32.ChecksumIEEE(data))
+	line = append(line, data...)
+	return append(line, '\n'), nil
+}
+
+// decode parses a line written by encode, it fails on a torn line or a
+// checksum mismatch.
+func decode(line []byte) (record, bool) {
+	line, complete := bytes.CutSuffix(line, []byte("\n"))
+	sum, data, ok := bytes.Cut(line, []byte(" "))
+	if !complete || !ok {
+		return record{}, false
+	}
+
+	want, err := strconv.ParseUint(string(sum), 16, 32)
+	if err != nil || crc32.ChecksumIEEE(data) != uint32(want) {
+		return record{}, false
+	}
+
+	var rec record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return record{}, false
+	}
+
+	return rec, true
+}
+
+// append is the journal of the memory storage, the changes are applied only
+// when they are in the log. They share a record, so a crash keeps all or none
+// of them.
+func (s *FileStorage) append(changes []memory.Change) error {
+	const op = "storage.file.append"
+
+	line, err := encode(record{Seq: s.seq + 1, Changes: changes})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.write(line); err != nil {
+		// Drop what was written so the next record does not follow a torn one.
+		_ = s.wal.Truncate(s.size)
+		s.failing.Store(true)
+		return fmt.Errorf("%s: %w: %w", op, storage.ErrUnavailable, err)
+	}
+	s.failing.Store(false)
+
+	s.seq++
+	s.size += int64(len(line))
+	s.records++
+
+	if s.opts.SnapshotRecords > 0 && s.records >= s.opts.SnapshotRecords {
+		select {
+		case s.compact <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+func (s *FileStorage) write(line []byte) error {
+	if _, err := s.wal.WriteAt(line, s.size); err != nil {
+		return err
+	}
+
+	if s.opts.Fsync == FsyncAlways {
+		return s.wal.Sync()
+	}
+	return nil
+}
+
+// Compact writes a snapshot of the storage and empties the log. Changes wait
+// until it is done.
+func (s *FileStorage) Compact() error {
+	const op = "storage.file.Compact"
+	log := s.log.With(slog.String("op", op))
+
+	err := s.MemoryStorage.Snapshot(func(state memory.State) error {
+		if s.records == 0 {
+			return nil
+		}
+
+		if err := writeSnapshot(s.opts.Dir, snapshot{Seq: s.seq, State: state}); err != nil {
+			return err
+		}
+
+		// A crash before the log is emptied is harmless, its records are
+		// already in the snapshot and are skipped on replay.
+		if err := s.wal.Truncate(0); err != nil {
+			return err
+		}
+		if err := s.wal.Sync(); err != nil {
+			return err
+		}
+
+		log.Info("Write-ahead log compacted", slog.Int("records", s.records), slog.Uint64("seq", s.seq))
+		s.size, s.records = 0, 0
+		return nil
+	})
+	if err != nil {
+		log.Error("Failed to compact write-ahead log", sl.Err(err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// writeSnapshot replaces the snapshot atomically: a crash leaves either the
+// old or the new one.
+func writeSnapshot(dir string, snap snapshot) error {
+	tmp, err := os.CreateTemp(dir, snapshotFile+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	if err := json.NewEncoder(writer).Encode(snap); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, snapshotFile)); err != nil {
+		return err
+	}
+
+	// The rename itself is durable only once the directory is synced.
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// Run syncs the log as the fsync policy says and compacts it every
+// SnapshotInterval, or earlier once it holds SnapshotRecords records, until
+// Stop is called.
+func (s *FileStorage) Run() {
+	const op = "storage.file.Run"
+	log := s.log.With(slog.String("op", op))
+
+	s.runMu.Lock()
+	if s.stopped {
+		s.runMu.Unlock()
+		return
+	}
+	s.running = true
+	s.runMu.Unlock()
+	defer close(s.done)
+
+	log.Info("starting file storage", slog.String("fsync", s.opts.Fsync), slog.Duration("snapshotInterval", s.opts.SnapshotInterval))
+
+	var fsync <-chan time.Time
+	if s.opts.Fsync == FsyncInterval {
+		ticker := time.NewTicker(s.opts.FsyncInterval)
+		defer ticker.Stop()
+		fsync = ticker.C
+	}
+
+	snapshots := time.NewTicker(s.opts.SnapshotInterval)
+	defer snapshots.Stop()
+
+	for {
+		select {
+		case <-fsync:
+			if err := s.wal.Sync(); err != nil {
+				log.Error("Failed to sync write-ahead log", sl.Err(err))
+			}
+		case <-snapshots.C:
+			_ = s.Compact()
+		case <-s.compact:
+			_ = s.Compact()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Stop ends Run, if it was started, compacts the log and closes it. Calls
+// after the first do nothing.
+func (s *FileStorage) Stop() {
+	const op = "storage.file.Stop"
+	log := s.log.With(slog.String("op", op))
+
+	s.runMu.Lock()
+	if s.stopped {
+		s.runMu.Unlock()
+		return
+	}
+	s.stopped = true
+	running := s.running
+	s.runMu.Unlock()
+
+	log.Info("stopping file storage")
+
+	close(s.stop)
+	if running {
+		<-s.done
+	}
+
+	_ = s.Compact()
+	if err := s.wal.Close(); err != nil {
+		log.Error("Failed to close write-ahead log", sl.Err(err))
+	}
+}
+
+// Health reports the file backend, degraded while changes cannot be written.
+func (s *FileStorage) Health(ctx context.Context) models.StorageHealth {
+	return models.StorageHealth{
+		Backend:  "file",
+		Degraded: s.failing.Load(),
+	}
+}
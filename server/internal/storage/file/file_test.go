@@ -0,0 +1,198 @@
+package file_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"server/internal/domain/interfaces"
+	"server/internal/domain/models"
+	"server/internal/lib/audit"
+	"server/internal/storage"
+	"server/internal/storage/file"
+
+	"github.com/google/uuid"
+)
+
+func open(t *testing.T, dir string) *file.FileStorage {
+	t.Helper()
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s, err := file.Open(log, file.Options{Dir: dir, Fsync: file.FsyncAlways, SnapshotInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	return s
+}
+
+func TestRecovery(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// The first storage is never stopped, as if the process crashed.
+	s := open(t, dir)
+	kept := models.User{Id: uuid.New(), Email: "kept@mail.com", Role: "user", Version: 1}
+	gone := models.User{Id: uuid.New(), Email: "gone@mail.com", Role: "user", Version: 1}
+	for _, user := range []models.User{kept, gone} {
+		if err := s.Insert(audit.WithEvent(ctx, models.AuditEvent{Id: uuid.New(), TargetId: user.Id}), user); err != nil {
+			t.Fatalf("Insert() error = %v", err)
+		}
+	}
+	if err := s.Compact(); err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+	if _, err := s.Delete(ctx, gone.Id); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	// A record torn by the crash is dropped.
+	wal, err := os.OpenFile(filepath.Join(dir, "wal.log"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wal.WriteString(`00000000 {"seq":4,"us`); err != nil {
+		t.Fatal(err)
+	}
+	wal.Close()
+
+	s = open(t, dir)
+	if _, err := s.GetUserById(ctx, kept.Id); err != nil {
+		t.Fatalf("GetUserById() of a user from the snapshot error = %v", err)
+	}
+	if _, err := s.GetUserById(ctx, gone.Id); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Fatalf("GetUserById() of a user deleted in the log error = %v, want %v", err, storage.ErrUserNotFound)
+	}
+	events, err := s.GetAuditEvents(ctx, models.AuditQuery{})
+	if err != nil {
+		t.Fatalf("GetAuditEvents() error = %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("GetAuditEvents() returned %d events, want 2", len(events))
+	}
+
+	// Writes go on after the dropped record and survive a clean stop.
+	restored, err := s.Restore(ctx, gone.Id)
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	go s.Run()
+	s.Stop()
+
+	s = open(t, dir)
+	got, err := s.GetUserById(ctx, gone.Id)
+	if err != nil {
+		t.Fatalf("GetUserById() after reopening error = %v", err)
+	}
+	if got.Version != restored.Version {
+		t.Fatalf("GetUserById() after reopening returned version %d, want %d", got.Version, restored.Version)
+	}
+}
+
+func TestCompactionSkipsSnapshottedRecords(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := open(t, dir)
+	user := models.User{Id: uuid.New(), Email: "user@mail.com", Role: "user", Version: 1}
+	if err := s.Insert(audit.WithEvent(ctx, models.AuditEvent{Id: uuid.New(), TargetId: user.Id}), user); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+
+	// Keep the log as if the process crashed between writing the snapshot
+	// and emptying the log.
+	wal, err := os.ReadFile(filepath.Join(dir, "wal.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Compact(); err != nil {
+		t.Fatalf("Compact() error = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "wal.log"), wal, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s = open(t, dir)
+	events, err := s.GetAuditEvents(ctx, models.AuditQuery{})
+	if err != nil {
+		t.Fatalf("GetAuditEvents() error = %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("GetAuditEvents() returned %d events, want 1", len(events))
+	}
+}
+
+func TestTransactionRecovery(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := open(t, dir)
+	users := []models.User{
+		{Id: uuid.New(), Email: "first@mail.com", Role: "user", Version: 1},
+		{Id: uuid.New(), Email: "second@mail.com", Role: "user", Version: 1},
+	}
+	err := s.WithTx(ctx, func(tx interfaces.Storage) error {
+		for _, user := range users {
+			if err := tx.Insert(ctx, user); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithTx() error = %v", err)
+	}
+
+	// The transaction is a single record, found whole after a crash.
+	wal, err := os.ReadFile(filepath.Join(dir, "wal.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(wal, []byte("\n")); lines != 1 {
+		t.Fatalf("write-ahead log holds %d records, want 1", lines)
+	}
+
+	s = open(t, dir)
+	for _, user := range users {
+		if _, err := s.GetUserById(ctx, user.Id); err != nil {
+			t.Fatalf("GetUserById() after reopening error = %v", err)
+		}
+	}
+}
+
+func TestStopWithoutRun(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s := open(t, dir)
+	user := models.User{Id: uuid.New(), Email: "user@mail.com", Role: "user", Version: 1}
+	if err := s.Insert(ctx, user); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		s.Stop()
+		s.Stop()
+		// Run after Stop returns at once.
+		s.Run()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop() without Run() did not return")
+	}
+
+	s = open(t, dir)
+	if _, err := s.GetUserById(ctx, user.Id); err != nil {
+		t.Fatalf("GetUserById() after reopening error = %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"server/internal/domain/models"
+	"server/internal/lib/audit"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// batchItem checks the item i of a batch against the storage as changed by
+// the earlier items and returns the user before and after it, before is nil
+// for a new user.
+type batchItem func(i int) (before *models.User, after models.User, err error)
+
+// batch applies n items one by one under the lock and journals their changes
+// at once. When the journal fails the applied items are undone, so nothing of
+// the batch is kept.
+func (m *MemoryStorage) batch(ctx context.Context, op string, n int, item batchItem) ([]models.BatchResult, error) {
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	event, audited := audit.EventFromContext(ctx)
+	results := make([]models.BatchResult, n)
+	var changes, undo []Change
+	events := len(m.events)
+	for i := range n {
+		before, after, err := item(i)
+		if err != nil {
+			log.Warn("Batch item not applied", slog.Int("index", i), slog.String("error", err.Error()))
+			results[i].Err = fmt.Errorf("%s: %w", op, err)
+			continue
+		}
+
+		change := Change{User: &after}
+		if audited {
+			event := audit.ForTarget(event, after.Id)
+			event.Changes = audit.Diff(before, &after)
+			change.Event = &event
+		}
+
+		if before != nil {
+			undo = append(undo, Change{User: before})
+		} else {
+			undo = append(undo, Change{Purged: []uuid.UUID{after.Id}})
+		}
+		m.apply(change)
+		changes = append(changes, change)
+		results[i].User = clone(after)
+	}
+
+	if m.journal != nil && len(changes) > 0 {
+		if err := m.journal(changes); err != nil {
+			log.Error("Failed to journal batch", slog.String("error", err.Error()))
+			for _, change := range slices.Backward(undo) {
+				m.apply(change)
+			}
+			m.events = m.events[:events]
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	log.Info("Batch applied", slog.Int("count", n), slog.Int("applied", len(changes)))
+	return results, nil
+}
+
+// InsertUsers inserts the users that take no id or email in use.
+func (m *MemoryStorage) InsertUsers(ctx context.Context, users []models.User) ([]models.BatchResult, error) {
+	const op = "storage.memory.InsertUsers"
+
+	return m.batch(ctx, op, len(users), func(i int) (*models.User, models.User, error) {
+		if err := m.checkInsert(users[i]); err != nil {
+			return nil, models.User{}, err
+		}
+
+		return nil, users[i], nil
+	})
+}
+
+// UpdateUsers updates the users the way Update does, keeping their passwords.
+func (m *MemoryStorage) UpdateUsers(ctx context.Context, users []models.User) ([]models.BatchResult, error) {
+	const op = "storage.memory.UpdateUsers"
+
+	return m.batch(ctx, op, len(users), func(i int) (*models.User, models.User, error) {
+		before, after, err := m.update(users[i].Id, users[i])
+		if err != nil {
+			return nil, models.User{}, err
+		}
+		after.Password = before.Password
+
+		return &before, after, nil
+	})
+}
+
+// DeleteUsers deletes the users, all at the same time.
+func (m *MemoryStorage) DeleteUsers(ctx context.Context, uids []uuid.UUID) ([]models.BatchResult, error) {
+	const op = "storage.memory.DeleteUsers"
+
+	deletedAt := time.Now().UTC().Truncate(time.Microsecond)
+	return m.batch(ctx, op, len(uids), func(i int) (*models.User, models.User, error) {
+		before, after, err := m.delete(uids[i], deletedAt)
+		if err != nil {
+			return nil, models.User{}, err
+		}
+
+		return &before, after, nil
+	})
+}
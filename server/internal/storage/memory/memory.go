@@ -0,0 +1,671 @@
+// Package memory keeps users in process memory. It behaves like the Postgres
+// storage and is used when no database is configured; the data is lost on
+// restart.
+package memory
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"server/internal/domain/interfaces"
+	"server/internal/domain/models"
+	"server/internal/lib/audit"
+	"server/internal/storage"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStorage is safe for concurrent use. Users are copied in and out, so
+// callers never share memory with the stored ones.
+type MemoryStorage struct {
+	// writeMu is held by every mutation, and by WithTx until the transaction
+	// is committed, so writes never interleave with a transaction.
+	writeMu sync.Mutex
+	mu      sync.RWMutex
+	// users holds every user, deleted ones too.
+	users map[uuid.UUID]models.User
+	// emails maps the lowercased email of every not deleted user to its id.
+	emails  map[string]uuid.UUID
+	events  []models.AuditEvent
+	journal Journal
+	log     *slog.Logger
+	// inTx is set on the copy a transaction works on.
+	inTx bool
+}
+
+// Change is the outcome of a mutation: the user as stored after it or the
+// users removed by Purge, and the audit event recorded with it.
+type Change struct {
+	User   *models.User       `json:"user,omitempty"`
+	Purged []uuid.UUID        `json:"purged,omitempty"`
+	Event  *models.AuditEvent `json:"event,omitempty"`
+}
+
+// Journal is called with the changes of every mutation or transaction before
+// they are applied, no other change is made meanwhile. A failing journal
+// aborts all of them.
+type Journal func(changes []Change) error
+
+// State is the whole content of the storage.
+type State struct {
+	Users  []models.User       `json:"users"`
+	Events []models.AuditEvent `json:"events"`
+}
+
+func New(log *slog.Logger) *MemoryStorage {
+	return NewJournaled(log, nil)
+}
+
+// NewJournaled returns a storage that passes every change to journal, so that
+// it can be persisted and replayed with Load and Apply.
+func NewJournaled(log *slog.Logger, journal Journal) *MemoryStorage {
+	return &MemoryStorage{
+		users:   make(map[uuid.UUID]models.User),
+		emails:  make(map[string]uuid.UUID),
+		journal: journal,
+		log:     log,
+	}
+}
+
+// Load replaces the content of the storage with state, the journal is not
+// called.
+func (m *MemoryStorage) Load(state State) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	clear(m.users)
+	clear(m.emails)
+	m.events = nil
+	for _, user := range state.Users {
+		m.apply(Change{User: &user})
+	}
+	m.events = append(m.events, state.Events...)
+}
+
+// Apply makes a change passed to the journal again, e.g. when the journal is
+// replayed. The journal is not called.
+func (m *MemoryStorage) Apply(change Change) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.apply(change)
+}
+
+// Snapshot calls fn with the content of the storage, no change is made until
+// fn returns. The state shares memory with the storage and must not be kept.
+func (m *MemoryStorage) Snapshot(fn func(state State) error) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	state := State{
+		Users:  make([]models.User, 0, len(m.users)),
+		Events: m.events,
+	}
+	for _, user := range m.users {
+		state.Users = append(state.Users, user)
+	}
+
+	return fn(state)
+}
+
+// commit journals and applies the change of before into after, with the audit
+// event carried by ctx, if any. It must be called with the lock held.
+func (m *MemoryStorage) commit(ctx context.Context, before *models.User, after models.User) error {
+	change := Change{User: &after}
+	if event, ok := audit.EventFromContext(ctx); ok {
+		event.Changes = audit.Diff(before, &after)
+		change.Event = &event
+	}
+
+	if m.journal != nil {
+		if err := m.journal([]Change{change}); err != nil {
+			return err
+		}
+	}
+
+	m.apply(change)
+	return nil
+}
+
+// WithTx runs fn on a copy of the storage and applies the changes fn made only
+// if it succeeds, all at once. Other writes wait until the transaction ends,
+// reads see the storage as it was before it.
+func (m *MemoryStorage) WithTx(ctx context.Context, fn func(tx interfaces.Storage) error) error {
+	const op = "storage.memory.WithTx"
+
+	// A nested transaction is part of the outer one.
+	if m.inTx {
+		return fn(m)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+
+	var changes []Change
+	m.mu.RLock()
+	tx := &MemoryStorage{
+		users:  maps.Clone(m.users),
+		emails: maps.Clone(m.emails),
+		// Clipped, so that appends of the copy never write into m.events.
+		events: slices.Clip(m.events),
+		journal: func(c []Change) error {
+			changes = append(changes, c...)
+			return nil
+		},
+		log:  m.log,
+		inTx: true,
+	}
+	m.mu.RUnlock()
+
+	// Rolling back is dropping the copy.
+	if err := fn(tx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.journal != nil {
+		if err := m.journal(changes); err != nil {
+			m.log.Error("Failed to journal transaction", slog.String("op", op), slog.String("error", err.Error()))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	for _, change := range changes {
+		m.apply(change)
+	}
+
+	return nil
+}
+
+// apply makes the change, it must be called with the lock held.
+func (m *MemoryStorage) apply(change Change) {
+	if user := change.User; user != nil {
+		if old, ok := m.users[user.Id]; ok && m.emails[emailKey(old.Email)] == old.Id {
+			delete(m.emails, emailKey(old.Email))
+		}
+
+		m.users[user.Id] = clone(*user)
+		if user.DeletedAt == nil {
+			m.emails[emailKey(user.Email)] = user.Id
+		}
+	}
+
+	for _, uid := range change.Purged {
+		if old, ok := m.users[uid]; ok && m.emails[emailKey(old.Email)] == old.Id {
+			delete(m.emails, emailKey(old.Email))
+		}
+		delete(m.users, uid)
+	}
+
+	if change.Event != nil {
+		m.events = append(m.events, *change.Event)
+	}
+}
+
+// emailKey matches Postgres, which compares emails case-insensitively.
+func emailKey(email string) string {
+	return strings.ToLower(email)
+}
+
+// clone copies the user along with the memory it points to.
+func clone(user models.User) models.User {
+	if user.DeletedAt != nil {
+		deletedAt := *user.DeletedAt
+		user.DeletedAt = &deletedAt
+	}
+
+	return user
+}
+
+func (m *MemoryStorage) GetUsers(ctx context.Context, query models.UsersQuery) ([]models.User, error) {
+	const op = "storage.memory.GetUsers"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.RLock()
+	sorted := make([]models.User, 0, len(m.users))
+	for _, v := range m.users {
+		if matchesFilter(v, query.Filter) {
+			sorted = append(sorted, clone(v))
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return compareCursors(query.Sort, query.Sort.Cursor(sorted[i]), query.Sort.Cursor(sorted[j])) < 0
+	})
+
+	users := make([]models.User, 0, query.Limit)
+	for _, v := range sorted {
+		if query.After != nil && compareCursors(query.Sort, query.Sort.Cursor(v), *query.After) <= 0 {
+			continue
+		}
+		if query.Limit > 0 && len(users) == query.Limit {
+			break
+		}
+		users = append(users, v)
+	}
+
+	return users, nil
+}
+
+// StreamUsers calls fn on a snapshot taken before the first call, fn may use
+// the storage.
+func (m *MemoryStorage) StreamUsers(ctx context.Context, query models.UsersQuery, fn func(models.User) error) error {
+	const op = "storage.memory.StreamUsers"
+
+	query.Limit, query.After = 0, nil
+	users, err := m.GetUsers(ctx, query)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	for _, v := range users {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if err := fn(v); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+// matchesFilter evaluates the filter the same way the Postgres storage does.
+func matchesFilter(user models.User, filter models.UsersFilter) bool {
+	if filter.Role != "" && user.Role != filter.Role {
+		return false
+	}
+	if filter.EmailDomain != "" {
+		// split_part(email, '@', 2)
+		domain := ""
+		if parts := strings.Split(user.Email, "@"); len(parts) > 1 {
+			domain = parts[1]
+		}
+		if domain != filter.EmailDomain {
+			return false
+		}
+	}
+	if filter.NickPrefix != "" && !strings.HasPrefix(user.Nick, filter.NickPrefix) {
+		return false
+	}
+	if filter.NickContains != "" && !strings.Contains(user.Nick, filter.NickContains) {
+		return false
+	}
+	if !filter.CreatedAfter.IsZero() && user.CreatedAt.Before(filter.CreatedAfter) {
+		return false
+	}
+	if !filter.CreatedBefore.IsZero() && !user.CreatedAt.Before(filter.CreatedBefore) {
+		return false
+	}
+	if !filter.IncludeDeleted && user.DeletedAt != nil {
+		return false
+	}
+
+	return true
+}
+
+// compareCursors orders users by the sort field and then by id, the same way
+// Postgres does with the "C" collation.
+func compareCursors(order models.UsersSort, a models.UsersCursor, b models.UsersCursor) int {
+	var c int
+	switch order.Field {
+	case models.SortByEmail, models.SortByRole, models.SortByNick:
+		c = strings.Compare(a.Key, b.Key)
+	default:
+		c = a.CreatedAt.Compare(b.CreatedAt)
+	}
+	if c == 0 {
+		c = bytes.Compare(a.Id[:], b.Id[:])
+	}
+
+	if order.Desc {
+		return -c
+	}
+	return c
+}
+
+func (m *MemoryStorage) GetUserById(ctx context.Context, uid uuid.UUID) (models.User, error) {
+	const op = "storage.memory.GetUserById"
+
+	if err := ctx.Err(); err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[uid]
+	if !ok || user.DeletedAt != nil {
+		m.log.Warn("User not found", slog.String("op", op), slog.String("userId", uid.String()))
+		return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return clone(user), nil
+}
+
+// GetUsersByIds looks every id up in the index by id.
+func (m *MemoryStorage) GetUsersByIds(ctx context.Context, uids []uuid.UUID) ([]models.User, error) {
+	const op = "storage.memory.GetUsersByIds"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	users := make([]models.User, 0, len(uids))
+	seen := make(map[uuid.UUID]struct{}, len(uids))
+	for _, uid := range uids {
+		user, ok := m.users[uid]
+		if _, dup := seen[uid]; !ok || dup || user.DeletedAt != nil {
+			continue
+		}
+		seen[uid] = struct{}{}
+		users = append(users, clone(user))
+	}
+
+	return users, nil
+}
+
+func (m *MemoryStorage) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	const op = "storage.memory.GetUserByEmail"
+
+	if err := ctx.Err(); err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	uid, ok := m.emails[emailKey(email)]
+	if !ok {
+		m.log.Warn("User not found", slog.String("op", op), slog.String("email", email))
+		return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+
+	return clone(m.users[uid]), nil
+}
+
+func (m *MemoryStorage) Insert(ctx context.Context, user models.User) error {
+	const op = "storage.memory.Insert"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkInsert(user); err != nil {
+		log.Warn("User already exists", slog.String("userId", user.Id.String()), slog.String("email", user.Email))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := m.commit(ctx, nil, user); err != nil {
+		log.Error("Failed to journal user", slog.String("userId", user.Id.String()), slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("User inserted", slog.String("userId", user.Id.String()))
+	return nil
+}
+
+// checkInsert fails with storage.ErrUserExists when the id or the email of
+// the user is taken, the lock must be held.
+func (m *MemoryStorage) checkInsert(user models.User) error {
+	if _, ok := m.users[user.Id]; ok {
+		return storage.ErrUserExists
+	}
+	if _, ok := m.emails[emailKey(user.Email)]; ok {
+		return storage.ErrUserExists
+	}
+
+	return nil
+}
+
+// Update replaces the editable fields of the user, CreatedAt and DeletedAt
+// are kept as in Postgres.
+func (m *MemoryStorage) Update(ctx context.Context, uid uuid.UUID, user models.User) error {
+	const op = "storage.memory.Update"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before, after, err := m.update(uid, user)
+	if err != nil {
+		log.Warn("User cannot be updated", slog.String("userId", uid.String()), slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := m.commit(ctx, &before, after); err != nil {
+		log.Error("Failed to journal user", slog.String("userId", uid.String()), slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("User updated", slog.String("userId", uid.String()))
+	return nil
+}
+
+// update returns the user uid before and after the update, the lock must be
+// held. The checks follow the Postgres storage: a missing user is reported
+// first, then a stale version and only then a taken email.
+func (m *MemoryStorage) update(uid uuid.UUID, user models.User) (models.User, models.User, error) {
+	before, ok := m.users[uid]
+	if !ok || before.DeletedAt != nil {
+		return models.User{}, models.User{}, storage.ErrUserNotFound
+	}
+	if before.Version != user.Version {
+		return models.User{}, models.User{}, storage.ErrConflict
+	}
+	if id, ok := m.emails[emailKey(user.Email)]; ok && id != uid {
+		return models.User{}, models.User{}, storage.ErrUserExists
+	}
+
+	after := before
+	after.Email = user.Email
+	after.Password = user.Password
+	after.Role = user.Role
+	after.Nick = user.Nick
+	after.UpdatedAt = user.UpdatedAt
+	after.UpdatedBy = user.UpdatedBy
+	after.Version++
+
+	return before, after, nil
+}
+
+// Delete marks the user as deleted and bumps its version.
+func (m *MemoryStorage) Delete(ctx context.Context, uid uuid.UUID) (models.User, error) {
+	const op = "storage.memory.Delete"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before, after, err := m.delete(uid, time.Now().UTC().Truncate(time.Microsecond))
+	if err != nil {
+		log.Warn("User not found", slog.String("userId", uid.String()))
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := m.commit(ctx, &before, after); err != nil {
+		log.Error("Failed to journal user", slog.String("userId", uid.String()), slog.String("error", err.Error()))
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("User deleted", slog.String("userId", uid.String()))
+	return clone(after), nil
+}
+
+// delete returns the user uid before and after it is deleted at deletedAt,
+// the lock must be held.
+func (m *MemoryStorage) delete(uid uuid.UUID, deletedAt time.Time) (models.User, models.User, error) {
+	before, ok := m.users[uid]
+	if !ok || before.DeletedAt != nil {
+		return models.User{}, models.User{}, storage.ErrUserNotFound
+	}
+
+	after := before
+	after.DeletedAt = &deletedAt
+	after.Version++
+
+	return before, after, nil
+}
+
+// Restore clears the deletion mark of a deleted user and bumps its version.
+func (m *MemoryStorage) Restore(ctx context.Context, uid uuid.UUID) (models.User, error) {
+	const op = "storage.memory.Restore"
+	log := m.log.With(slog.String("op", op))
+
+	if err := ctx.Err(); err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before, ok := m.users[uid]
+	if !ok || before.DeletedAt == nil {
+		log.Warn("No deleted user to restore", slog.String("userId", uid.String()))
+		return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+	}
+	if _, ok := m.emails[emailKey(before.Email)]; ok {
+		log.Warn("Email is taken by another user", slog.String("email", before.Email))
+		return models.User{}, fmt.Errorf("%s: %w", op, storage.ErrUserExists)
+	}
+
+	after := before
+	after.DeletedAt = nil
+	after.Version++
+
+	if err := m.commit(ctx, &before, after); err != nil {
+		log.Error("Failed to journal user", slog.String("userId", uid.String()), slog.String("error", err.Error()))
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("User restored", slog.String("userId", uid.String()))
+	return clone(after), nil
+}
+
+// Purge removes the users deleted before deletedBefore for good.
+func (m *MemoryStorage) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	const op = "storage.memory.Purge"
+
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var purged []uuid.UUID
+	for uid, v := range m.users {
+		if v.DeletedAt != nil && v.DeletedAt.Before(deletedBefore) {
+			purged = append(purged, uid)
+		}
+	}
+	if len(purged) == 0 {
+		return 0, nil
+	}
+
+	change := Change{Purged: purged}
+	if m.journal != nil {
+		if err := m.journal([]Change{change}); err != nil {
+			m.log.Error("Failed to journal purge", slog.String("op", op), slog.String("error", err.Error()))
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+	m.apply(change)
+
+	m.log.Info("Deleted users purged", slog.String("op", op), slog.Int("count", len(purged)))
+	return int64(len(purged)), nil
+}
+
+// GetAuditEvents returns the events matching the query, newest first.
+func (m *MemoryStorage) GetAuditEvents(ctx context.Context, query models.AuditQuery) ([]models.AuditEvent, error) {
+	const op = "storage.memory.GetAuditEvents"
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	m.mu.RLock()
+	sorted := make([]models.AuditEvent, 0, len(m.events))
+	for _, v := range m.events {
+		if query.TargetId != uuid.Nil && v.TargetId != query.TargetId {
+			continue
+		}
+		if query.ActorId != uuid.Nil && v.ActorId != query.ActorId {
+			continue
+		}
+		if query.After != nil && compareAuditEvents(v, *query.After) >= 0 {
+			continue
+		}
+		v.Changes = slices.Clone(v.Changes)
+		sorted = append(sorted, v)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return compareAuditEvents(sorted[i], models.AuditCursor{OccurredAt: sorted[j].OccurredAt, Id: sorted[j].Id}) > 0
+	})
+
+	if query.Limit > 0 && len(sorted) > query.Limit {
+		sorted = sorted[:query.Limit]
+	}
+
+	return sorted, nil
+}
+
+// compareAuditEvents orders events by (OccurredAt, Id) ascending.
+func compareAuditEvents(event models.AuditEvent, cursor models.AuditCursor) int {
+	if c := event.OccurredAt.Compare(cursor.OccurredAt); c != 0 {
+		return c
+	}
+
+	return bytes.Compare(event.Id[:], cursor.Id[:])
+}
+
+// Health always reports a reachable memory backend.
+func (m *MemoryStorage) Health(ctx context.Context) models.StorageHealth {
+	return models.StorageHealth{Backend: "memory"}
+}
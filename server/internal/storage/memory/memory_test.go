@@ -0,0 +1,144 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"server/internal/domain/models"
+	"server/internal/storage"
+	"server/internal/storage/memory"
+
+	"github.com/google/uuid"
+)
+
+func TestConcurrentAccess(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx := context.Background()
+	m := memory.New(log)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 50; j++ {
+				user := models.User{Id: uuid.New(), Email: fmt.Sprintf("user%d-%d@mail.com", i, j), Role: "user", Version: 1}
+				if err := m.Insert(ctx, user); err != nil {
+					t.Errorf("Insert() error = %v", err)
+					return
+				}
+				user.Nick = "renamed"
+				if err := m.Update(ctx, user.Id, user); err != nil {
+					t.Errorf("Update() error = %v", err)
+					return
+				}
+				if _, err := m.GetUserByEmail(ctx, user.Email); err != nil {
+					t.Errorf("GetUserByEmail() error = %v", err)
+					return
+				}
+				if _, err := m.GetUsers(ctx, models.UsersQuery{Limit: 10}); err != nil {
+					t.Errorf("GetUsers() error = %v", err)
+					return
+				}
+				if _, err := m.Delete(ctx, user.Id); err != nil {
+					t.Errorf("Delete() error = %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	purged, err := m.Purge(ctx, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	if purged != 8*50 {
+		t.Fatalf("Purge() = %d, want %d", purged, 8*50)
+	}
+}
+
+func TestCopyOnRead(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx := context.Background()
+	m := memory.New(log)
+
+	user := models.User{Id: uuid.New(), Email: "user@mail.com", Role: "user", Nick: "nick", Version: 1}
+	if err := m.Insert(ctx, user); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+
+	deleted, err := m.Delete(ctx, user.Id)
+	if err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	*deleted.DeletedAt = time.Time{}
+
+	users, err := m.GetUsers(ctx, models.UsersQuery{Filter: models.UsersFilter{IncludeDeleted: true}})
+	if err != nil {
+		t.Fatalf("GetUsers() error = %v", err)
+	}
+	if len(users) != 1 || users[0].DeletedAt == nil || users[0].DeletedAt.IsZero() {
+		t.Fatalf("GetUsers() = %+v, the stored user was changed through a returned one", users)
+	}
+}
+
+func TestCanceledContext(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	m := memory.New(log)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := m.Insert(ctx, models.User{Id: uuid.New(), Email: "user@mail.com"}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Insert() error = %v, want %v", err, context.Canceled)
+	}
+	if _, err := m.GetUserById(context.Background(), uuid.New()); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Fatalf("GetUserById() error = %v, want %v", err, storage.ErrUserNotFound)
+	}
+}
+
+func TestBatchUndoneWhenJournalFails(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx := context.Background()
+
+	failing := errors.New("disk full")
+	var fail bool
+	m := memory.NewJournaled(log, func([]memory.Change) error {
+		if fail {
+			return failing
+		}
+		return nil
+	})
+
+	user := models.User{Id: uuid.New(), Email: "user@mail.com", Role: "user", Nick: "nick", Version: 1}
+	if err := m.Insert(ctx, user); err != nil {
+		t.Fatalf("Insert() error = %v", err)
+	}
+
+	fail = true
+	renamed := user
+	renamed.Email = "renamed@mail.com"
+	added := models.User{Id: uuid.New(), Email: "added@mail.com", Role: "user", Nick: "added", Version: 1}
+	if _, err := m.UpdateUsers(ctx, []models.User{renamed}); !errors.Is(err, failing) {
+		t.Fatalf("UpdateUsers() error = %v, want %v", err, failing)
+	}
+	if _, err := m.InsertUsers(ctx, []models.User{added}); !errors.Is(err, failing) {
+		t.Fatalf("InsertUsers() error = %v, want %v", err, failing)
+	}
+
+	got, err := m.GetUserByEmail(ctx, user.Email)
+	if err != nil || got != user {
+		t.Fatalf("GetUserByEmail() = %+v, %v, want the user as before the batches", got, err)
+	}
+	if _, err := m.GetUserById(ctx, added.Id); !errors.Is(err, storage.ErrUserNotFound) {
+		t.Fatalf("GetUserById() error = %v, want %v", err, storage.ErrUserNotFound)
+	}
+}
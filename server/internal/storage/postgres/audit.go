@@ -0,0 +1,117 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"server/internal/domain/models"
+	"server/internal/lib/audit"
+)
+
+// querier is implemented by both *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// inTx runs fn in a transaction that is committed when fn succeeds and rolled
+// back otherwise. Inside WithTx fn joins the transaction of the storage.
+func (p *PostgresDB) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	if p.tx != nil {
+		return fn(p.tx)
+	}
+
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// appendAudit writes the audit event carried by ctx, if any, with the diff
+// between before and after. It must run in the transaction of the change.
+func (p *PostgresDB) appendAudit(ctx context.Context, tx *sql.Tx, before *models.User, after *models.User) error {
+	event, ok := audit.EventFromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	row, err := auditRow(event, before, after)
+	if err != nil {
+		return err
+	}
+
+	stmt, err := p.stmt(ctx, tx, p.queries.insertAuditEvent)
+	if err != nil {
+		return err
+	}
+
+	_, err = stmt.ExecContext(ctx, row...)
+	return err
+}
+
+// auditRow returns the values of auditColumns for the event with the diff
+// between before and after.
+func auditRow(event models.AuditEvent, before *models.User, after *models.User) ([]any, error) {
+	changes, err := json.Marshal(audit.Diff(before, after))
+	if err != nil {
+		return nil, err
+	}
+
+	return []any{event.Id, event.OccurredAt, event.RequestId, nullableId(event.ActorId), event.Operation, event.TargetId, string(changes)}, nil
+}
+
+// scanAuditEvent reads a row of auditColumns.
+func scanAuditEvent(row scanner) (models.AuditEvent, error) {
+	var event models.AuditEvent
+	var changes []byte
+	if err := row.Scan(&event.Id, &event.OccurredAt, &event.RequestId, &event.ActorId, &event.Operation, &event.TargetId, &changes); err != nil {
+		return models.AuditEvent{}, err
+	}
+
+	if err := json.Unmarshal(changes, &event.Changes); err != nil {
+		return models.AuditEvent{}, fmt.Errorf("invalid changes of audit event %s: %w", event.Id, err)
+	}
+
+	return event, nil
+}
+
+// GetAuditEvents returns the events matching the query, newest first.
+func (p *PostgresDB) GetAuditEvents(ctx context.Context, query models.AuditQuery) ([]models.AuditEvent, error) {
+	const op = "storage.postgres.GetAuditEvents"
+	log := p.log.With(slog.String("op", op))
+
+	stmt, args := buildAuditQuery(p.auditTable, query)
+	rows, err := p.conn().QueryContext(ctx, stmt, args...)
+	if err != nil {
+		log.Warn("Error querying audit events", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+	defer rows.Close()
+
+	var events []models.AuditEvent
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			log.Warn("Error scanning audit event row", slog.String("error", err.Error()))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Warn("Error iterating audit event rows", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	return events, nil
+}
@@ -0,0 +1,556 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"server/internal/domain/models"
+	"server/internal/lib/audit"
+	"server/internal/storage"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/lib/pq"
+)
+
+// The batches read the rows their items touch in one query, check the items
+// against them in memory and then write the items that pass in bulk. The
+// writes cannot fail on a checked item unless a concurrent transaction takes
+// one of the emails meanwhile, the batch then fails with storage.ErrUserExists.
+
+// insertColumns are the columns written by Insert, the database fills in
+// deleted_at.
+var insertColumns = []string{"id", "email", "password", "role", "nick", "created_at", "version", "updated_at", "updated_by"}
+
+// insertRow returns the values of insertColumns for the user.
+func insertRow(user models.User) []any {
+	return []any{user.Id, user.Email, user.Password, user.Role, user.Nick, user.CreatedAt, user.Version, user.UpdatedAt, nullableId(user.UpdatedBy)}
+}
+
+// batchPlan replays the items of a batch on the rows they touch, so every
+// item is checked as if the earlier ones had been applied.
+type batchPlan struct {
+	// ids holds the ids of every row, deleted ones too. users and emails hold
+	// the users that are not deleted, emails by their lowercased email.
+	ids    map[uuid.UUID]struct{}
+	users  map[uuid.UUID]models.User
+	emails map[string]uuid.UUID
+}
+
+func newBatchPlan(rows []models.User) *batchPlan {
+	plan := &batchPlan{
+		ids:    make(map[uuid.UUID]struct{}, len(rows)),
+		users:  make(map[uuid.UUID]models.User, len(rows)),
+		emails: make(map[string]uuid.UUID, len(rows)),
+	}
+	for _, row := range rows {
+		plan.ids[row.Id] = struct{}{}
+		if row.DeletedAt == nil {
+			plan.users[row.Id] = row
+			plan.emails[strings.ToLower(row.Email)] = row.Id
+		}
+	}
+
+	return plan
+}
+
+// batchKeys returns the ids and the lowercased emails of the users, the
+// parameters of takenUsers and lockUsers.
+func batchKeys(users []models.User) ([]uuid.UUID, []string) {
+	ids := make([]uuid.UUID, len(users))
+	emails := make([]string, len(users))
+	for i, user := range users {
+		ids[i] = user.Id
+		emails[i] = strings.ToLower(user.Email)
+	}
+
+	return ids, emails
+}
+
+// insert checks that the id and the email of the user are free and records
+// the user.
+func (b *batchPlan) insert(user models.User) error {
+	if _, ok := b.ids[user.Id]; ok {
+		return storage.ErrUserExists
+	}
+	if _, ok := b.emails[strings.ToLower(user.Email)]; ok {
+		return storage.ErrUserExists
+	}
+
+	b.ids[user.Id] = struct{}{}
+	b.users[user.Id] = user
+	b.emails[strings.ToLower(user.Email)] = user.Id
+	return nil
+}
+
+// update checks the update of the user the way Update does, records it and
+// returns the user before and after it. The stored password is kept.
+func (b *batchPlan) update(user models.User) (models.User, models.User, error) {
+	before, ok := b.users[user.Id]
+	if !ok {
+		return models.User{}, models.User{}, storage.ErrUserNotFound
+	}
+	if before.Version != user.Version {
+		return models.User{}, models.User{}, storage.ErrConflict
+	}
+	if id, ok := b.emails[strings.ToLower(user.Email)]; ok && id != user.Id {
+		return models.User{}, models.User{}, storage.ErrUserExists
+	}
+
+	after := before
+	after.Email = user.Email
+	after.Role = user.Role
+	after.Nick = user.Nick
+	after.UpdatedAt = user.UpdatedAt
+	after.UpdatedBy = user.UpdatedBy
+	after.Version++
+
+	delete(b.emails, strings.ToLower(before.Email))
+	b.emails[strings.ToLower(after.Email)] = after.Id
+	b.users[after.Id] = after
+	return before, after, nil
+}
+
+// deletedUsers matches the rows returned by deleteUsers with the ids of the
+// batch. An id given twice is deleted once, its second item finds no user.
+func deletedUsers(op string, uids []uuid.UUID, rows []models.User) []models.BatchResult {
+	deleted := make(map[uuid.UUID]models.User, len(rows))
+	for _, row := range rows {
+		deleted[row.Id] = row
+	}
+
+	results := make([]models.BatchResult, len(uids))
+	for i, uid := range uids {
+		user, ok := deleted[uid]
+		if !ok {
+			results[i].Err = fmt.Errorf("%s: %w", op, storage.ErrUserNotFound)
+			continue
+		}
+		delete(deleted, uid)
+		results[i].User = user
+	}
+
+	return results
+}
+
+// beforeDelete returns the user as it was before deleteUsers, which changed
+// nothing else.
+func beforeDelete(user models.User) models.User {
+	user.DeletedAt = nil
+	user.Version--
+
+	return user
+}
+
+// batchAudit collects the audit rows of the applied items of a batch when ctx
+// carries an audit event.
+type batchAudit struct {
+	event   models.AuditEvent
+	audited bool
+	rows    [][]any
+}
+
+func newBatchAudit(ctx context.Context) *batchAudit {
+	event, ok := audit.EventFromContext(ctx)
+	return &batchAudit{event: event, audited: ok}
+}
+
+func (a *batchAudit) add(before *models.User, after *models.User) error {
+	if !a.audited {
+		return nil
+	}
+
+	row, err := auditRow(audit.ForTarget(a.event, after.Id), before, after)
+	if err != nil {
+		return err
+	}
+	a.rows = append(a.rows, row)
+
+	return nil
+}
+
+// insertQuery returns a single INSERT of the rows into columns of table.
+func insertQuery(table string, columns []string, rows [][]any) (string, []any) {
+	var b strings.Builder
+	b.WriteString("INSERT INTO " + table + " (" + strings.Join(columns, ", ") + ") VALUES ")
+
+	args := make([]any, 0, len(rows)*len(columns))
+	for i, row := range rows {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("(")
+		for j, value := range row {
+			if j > 0 {
+				b.WriteString(", ")
+			}
+			args = append(args, value)
+			b.WriteString("$" + strconv.Itoa(len(args)))
+		}
+		b.WriteString(")")
+	}
+
+	return b.String(), args
+}
+
+// inIdsOrder orders the users found by ids as the ids, each once.
+func inIdsOrder(uids []uuid.UUID, found []models.User) []models.User {
+	byId := make(map[uuid.UUID]models.User, len(found))
+	for _, user := range found {
+		byId[user.Id] = user
+	}
+
+	users := make([]models.User, 0, len(found))
+	for _, uid := range uids {
+		if user, ok := byId[uid]; ok {
+			users = append(users, user)
+			delete(byId, uid)
+		}
+	}
+
+	return users
+}
+
+// idArray passes the ids to lib/pq, which takes uuid[] parameters as text.
+func idArray(uids []uuid.UUID) any {
+	ids := make([]string, len(uids))
+	for i, uid := range uids {
+		ids[i] = uid.String()
+	}
+
+	return pq.Array(ids)
+}
+
+// queryUsers runs a cached statement returning rows of userColumns in tx.
+func (p *PostgresDB) queryUsers(ctx context.Context, tx *sql.Tx, query string, args ...any) ([]models.User, error) {
+	stmt, err := p.stmt(ctx, tx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// insertRows writes the rows with a single INSERT, if there are any.
+func insertRows(ctx context.Context, tx *sql.Tx, table string, columns []string, rows [][]any) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	query, args := insertQuery(table, columns, rows)
+	_, err := tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// InsertUsers checks the users and inserts those that pass with a single
+// INSERT, their audit events with another one.
+func (p *PostgresDB) InsertUsers(ctx context.Context, users []models.User) ([]models.BatchResult, error) {
+	const op = "storage.postgres.InsertUsers"
+	log := p.log.With(slog.String("op", op))
+
+	var results []models.BatchResult
+	err := p.inTx(ctx, func(tx *sql.Tx) error {
+		ids, emails := batchKeys(users)
+		taken, err := p.queryUsers(ctx, tx, p.queries.takenUsers, idArray(ids), pq.Array(emails))
+		if err != nil {
+			return err
+		}
+
+		plan := newBatchPlan(taken)
+		events := newBatchAudit(ctx)
+		results = make([]models.BatchResult, len(users))
+		var rows [][]any
+		for i, user := range users {
+			if err := plan.insert(user); err != nil {
+				results[i].Err = fmt.Errorf("%s: %w", op, err)
+				continue
+			}
+			if err := events.add(nil, &user); err != nil {
+				return err
+			}
+			rows = append(rows, insertRow(user))
+			results[i].User = user
+		}
+
+		if err := insertRows(ctx, tx, p.table, insertColumns, rows); err != nil {
+			return err
+		}
+		return insertRows(ctx, tx, p.auditTable, strings.Split(auditColumns, ", "), events.rows)
+	})
+	if err != nil {
+		log.Warn("Error inserting users", slog.Int("count", len(users)), slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	log.Info("Users inserted successfully", slog.Int("count", len(users)))
+	return results, nil
+}
+
+// UpdateUsers locks the users and those owning the new emails in one query
+// and updates the users that pass the checks one after the other with a
+// prepared statement: an email freed by an item may be taken by a later one,
+// which a single UPDATE of all the rows would reject.
+func (p *PostgresDB) UpdateUsers(ctx context.Context, users []models.User) ([]models.BatchResult, error) {
+	const op = "storage.postgres.UpdateUsers"
+	log := p.log.With(slog.String("op", op))
+
+	var results []models.BatchResult
+	err := p.inTx(ctx, func(tx *sql.Tx) error {
+		ids, emails := batchKeys(users)
+		locked, err := p.queryUsers(ctx, tx, p.queries.lockUsers, idArray(ids), pq.Array(emails))
+		if err != nil {
+			return err
+		}
+
+		update, err := p.stmt(ctx, tx, p.queries.updateUser)
+		if err != nil {
+			return err
+		}
+
+		plan := newBatchPlan(locked)
+		events := newBatchAudit(ctx)
+		results = make([]models.BatchResult, len(users))
+		for i, user := range users {
+			before, after, err := plan.update(user)
+			if err != nil {
+				results[i].Err = fmt.Errorf("%s: %w", op, err)
+				continue
+			}
+
+			_, err = update.ExecContext(ctx,
+				after.Email, after.Password, after.Role, after.Nick, after.UpdatedAt, nullableId(after.UpdatedBy), after.Id,
+			)
+			if err != nil {
+				return err
+			}
+			if err := events.add(&before, &after); err != nil {
+				return err
+			}
+			results[i].User = after
+		}
+
+		return insertRows(ctx, tx, p.auditTable, strings.Split(auditColumns, ", "), events.rows)
+	})
+	if err != nil {
+		log.Warn("Error updating users", slog.Int("count", len(users)), slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	log.Info("Users updated successfully", slog.Int("count", len(users)))
+	return results, nil
+}
+
+// DeleteUsers deletes the users with a single statement, see Delete.
+func (p *PostgresDB) DeleteUsers(ctx context.Context, uids []uuid.UUID) ([]models.BatchResult, error) {
+	const op = "storage.postgres.DeleteUsers"
+	log := p.log.With(slog.String("op", op))
+
+	var results []models.BatchResult
+	err := p.inTx(ctx, func(tx *sql.Tx) error {
+		deletedAt := time.Now().UTC().Truncate(time.Microsecond)
+		deleted, err := p.queryUsers(ctx, tx, p.queries.deleteUsers, deletedAt, idArray(uids))
+		if err != nil {
+			return err
+		}
+
+		events := newBatchAudit(ctx)
+		results = deletedUsers(op, uids, deleted)
+		for _, result := range results {
+			if result.Err != nil {
+				continue
+			}
+			before := beforeDelete(result.User)
+			if err := events.add(&before, &result.User); err != nil {
+				return err
+			}
+		}
+
+		return insertRows(ctx, tx, p.auditTable, strings.Split(auditColumns, ", "), events.rows)
+	})
+	if err != nil {
+		log.Warn("Error deleting users", slog.Int("count", len(uids)), slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	log.Info("Users deleted successfully", slog.Int("count", len(uids)))
+	return results, nil
+}
+
+// copyRows writes the rows with COPY, if there are any.
+func copyRows(ctx context.Context, tx pgx.Tx, table pgx.Identifier, columns []string, rows [][]any) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	_, err := tx.CopyFrom(ctx, table, columns, pgx.CopyFromRows(rows))
+	return err
+}
+
+// queryUsers runs a query returning rows of userColumns on tx or the pool.
+func (p *PgxDB) queryUsers(ctx context.Context, tx pgxQuerier, query string, args ...any) ([]models.User, error) {
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// InsertUsers checks the users and inserts those that pass with COPY, their
+// audit events too.
+func (p *PgxDB) InsertUsers(ctx context.Context, users []models.User) ([]models.BatchResult, error) {
+	const op = "storage.postgres.pgx.InsertUsers"
+	log := p.log.With(slog.String("op", op))
+
+	var results []models.BatchResult
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		ids, emails := batchKeys(users)
+		taken, err := p.queryUsers(ctx, tx, p.queries.takenUsers, ids, emails)
+		if err != nil {
+			return err
+		}
+
+		plan := newBatchPlan(taken)
+		events := newBatchAudit(ctx)
+		results = make([]models.BatchResult, len(users))
+		var rows [][]any
+		for i, user := range users {
+			if err := plan.insert(user); err != nil {
+				results[i].Err = fmt.Errorf("%s: %w", op, err)
+				continue
+			}
+			if err := events.add(nil, &user); err != nil {
+				return err
+			}
+			rows = append(rows, insertRow(user))
+			results[i].User = user
+		}
+
+		if err := copyRows(ctx, tx, p.copyTable, insertColumns, rows); err != nil {
+			return err
+		}
+		return copyRows(ctx, tx, p.auditCopy, strings.Split(auditColumns, ", "), events.rows)
+	})
+	if err != nil {
+		log.Warn("Error inserting users", slog.Int("count", len(users)), slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	log.Info("Users inserted successfully", slog.Int("count", len(users)))
+	return results, nil
+}
+
+// UpdateUsers locks the rows as PostgresDB.UpdateUsers does and pipelines
+// the updates, in order, in a single round trip.
+func (p *PgxDB) UpdateUsers(ctx context.Context, users []models.User) ([]models.BatchResult, error) {
+	const op = "storage.postgres.pgx.UpdateUsers"
+	log := p.log.With(slog.String("op", op))
+
+	var results []models.BatchResult
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		ids, emails := batchKeys(users)
+		locked, err := p.queryUsers(ctx, tx, p.queries.lockUsers, ids, emails)
+		if err != nil {
+			return err
+		}
+
+		plan := newBatchPlan(locked)
+		events := newBatchAudit(ctx)
+		results = make([]models.BatchResult, len(users))
+		batch := &pgx.Batch{}
+		for i, user := range users {
+			before, after, err := plan.update(user)
+			if err != nil {
+				results[i].Err = fmt.Errorf("%s: %w", op, err)
+				continue
+			}
+
+			batch.Queue(p.queries.updateUser,
+				after.Email, after.Password, after.Role, after.Nick, after.UpdatedAt, nullableId(after.UpdatedBy), after.Id,
+			)
+			if err := events.add(&before, &after); err != nil {
+				return err
+			}
+			results[i].User = after
+		}
+
+		if batch.Len() > 0 {
+			if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+				return err
+			}
+		}
+		return copyRows(ctx, tx, p.auditCopy, strings.Split(auditColumns, ", "), events.rows)
+	})
+	if err != nil {
+		log.Warn("Error updating users", slog.Int("count", len(users)), slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	log.Info("Users updated successfully", slog.Int("count", len(users)))
+	return results, nil
+}
+
+// DeleteUsers deletes the users with a single statement, see Delete.
+func (p *PgxDB) DeleteUsers(ctx context.Context, uids []uuid.UUID) ([]models.BatchResult, error) {
+	const op = "storage.postgres.pgx.DeleteUsers"
+	log := p.log.With(slog.String("op", op))
+
+	var results []models.BatchResult
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		deletedAt := time.Now().UTC().Truncate(time.Microsecond)
+		deleted, err := p.queryUsers(ctx, tx, p.queries.deleteUsers, deletedAt, uids)
+		if err != nil {
+			return err
+		}
+
+		events := newBatchAudit(ctx)
+		results = deletedUsers(op, uids, deleted)
+		for _, result := range results {
+			if result.Err != nil {
+				continue
+			}
+			before := beforeDelete(result.User)
+			if err := events.add(&before, &result.User); err != nil {
+				return err
+			}
+		}
+
+		return copyRows(ctx, tx, p.auditCopy, strings.Split(auditColumns, ", "), events.rows)
+	})
+	if err != nil {
+		log.Warn("Error deleting users", slog.Int("count", len(uids)), slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	log.Info("Users deleted successfully", slog.Int("count", len(uids)))
+	return results, nil
+}
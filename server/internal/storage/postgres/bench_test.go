@@ -0,0 +1,182 @@
+package psql_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strconv"
+	"testing"
+	"time"
+
+	"server/internal/domain/interfaces"
+	"server/internal/domain/models"
+	"server/internal/lib/batch"
+	psql "server/internal/storage/postgres"
+	"server/internal/storage/postgres/pgtest"
+
+	"github.com/google/uuid"
+)
+
+// seeded is the number of users in the tables of the benchmarks.
+const seeded = 1000
+
+type benchStorages struct {
+	pq  *psql.PostgresDB
+	pgx *psql.PgxDB
+	ids []uuid.UUID
+}
+
+// openBenchStorages opens the database/sql and the pgx storage, compared by
+// the benchmarks, on the database of pgtest.URLEnv. The benchmarks are
+// skipped when it is unset.
+func openBenchStorages(b *testing.B) benchStorages {
+	b.Helper()
+
+	cfg, ok := pgtest.Config(b)
+	if !ok {
+		b.Skipf("%s is not set", pgtest.URLEnv)
+	}
+
+	// Both storages work on the same tables.
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg = pgtest.Migrate(b, cfg, log)
+	pq, err := psql.New(cfg, pgtest.Table, log)
+	if err != nil {
+		b.Fatalf("failed to connect to postgres: %v", err)
+	}
+	b.Cleanup(func() { pq.Stop() })
+	if err := pq.Prepare(context.Background()); err != nil {
+		b.Fatalf("failed to prepare statements: %v", err)
+	}
+
+	pgx, err := psql.NewPgx(cfg, pgtest.Table, log)
+	if err != nil {
+		b.Fatalf("failed to connect to postgres with pgx: %v", err)
+	}
+	b.Cleanup(func() { pgx.Stop() })
+
+	users := newUsers(seeded)
+	results, err := pgx.InsertUsers(context.Background(), users)
+	if err != nil || batch.Failed(results) {
+		b.Fatalf("failed to seed users: %v", err)
+	}
+
+	ids := make([]uuid.UUID, len(users))
+	for i, user := range users {
+		ids[i] = user.Id
+	}
+
+	return benchStorages{pq: pq, pgx: pgx, ids: ids}
+}
+
+func newUsers(n int) []models.User {
+	now := time.Now().UTC().Truncate(time.Microsecond)
+
+	users := make([]models.User, n)
+	for i := range users {
+		id := uuid.New()
+		users[i] = models.User{
+			Id:        id,
+			Email:     id.String()[:8] + "@mail.com",
+			Password:  "password",
+			Role:      "user",
+			Nick:      "nick" + strconv.Itoa(i),
+			Version:   1,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+	}
+
+	return users
+}
+
+func (s benchStorages) each(b *testing.B, fn func(b *testing.B, storage interfaces.Storage)) {
+	b.Run("pq", func(b *testing.B) { fn(b, s.pq) })
+	b.Run("pgx", func(b *testing.B) { fn(b, s.pgx) })
+}
+
+func BenchmarkGetUsers(b *testing.B) {
+	ctx := context.Background()
+
+	openBenchStorages(b).each(b, func(b *testing.B, storage interfaces.Storage) {
+		for i := 0; i < b.N; i++ {
+			if _, err := storage.GetUsers(ctx, models.UsersQuery{Limit: 100}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkGetUserById(b *testing.B) {
+	ctx := context.Background()
+	s := openBenchStorages(b)
+
+	s.each(b, func(b *testing.B, storage interfaces.Storage) {
+		for i := 0; i < b.N; i++ {
+			if _, err := storage.GetUserById(ctx, s.ids[i%len(s.ids)]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkGetUsersByIds looks up 100 users, one by one and with
+// GetUsersByIds, which takes a single = ANY query.
+func BenchmarkGetUsersByIds(b *testing.B) {
+	ctx := context.Background()
+	s := openBenchStorages(b)
+	ids := s.ids[:100]
+
+	s.each(b, func(b *testing.B, storage interfaces.Storage) {
+		b.Run("loop", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for _, id := range ids {
+					if _, err := storage.GetUserById(ctx, id); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+		b.Run("batch", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := storage.GetUsersByIds(ctx, ids); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	})
+}
+
+// BenchmarkBulkInsert inserts 100 users, one by one in a transaction and
+// with InsertUsers, which takes a multi-row INSERT with database/sql and COPY
+// with pgx.
+func BenchmarkBulkInsert(b *testing.B) {
+	ctx := context.Background()
+
+	openBenchStorages(b).each(b, func(b *testing.B, storage interfaces.Storage) {
+		b.Run("loop", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				users := newUsers(100)
+				err := storage.WithTx(ctx, func(tx interfaces.Storage) error {
+					for _, user := range users {
+						if err := tx.Insert(ctx, user); err != nil {
+							return err
+						}
+					}
+					return nil
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run("batch", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				results, err := storage.InsertUsers(ctx, newUsers(100))
+				if err != nil || batch.Failed(results) {
+					b.Fatal(err, results)
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,64 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"server/internal/storage"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+)
+
+// mapError translates errors of both drivers into the storage error taxonomy.
+// Errors that have no storage equivalent are returned unchanged.
+func mapError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w: %v", storage.ErrUserNotFound, err)
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return mapCode(string(pqErr.Code), err)
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return mapCode(pgErr.Code, err)
+	}
+
+	var netErr net.Error
+	var connectErr *pgconn.ConnectError
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) || errors.As(err, &netErr) || errors.As(err, &connectErr) {
+		return fmt.Errorf("%w: %v", storage.ErrUnavailable, err)
+	}
+
+	return err
+}
+
+// mapCode maps the SQLSTATE code of a server error.
+func mapCode(code string, err error) error {
+	switch {
+	case code == "23505": // unique_violation
+		return fmt.Errorf("%w: %v", storage.ErrUserExists, err)
+	case code == "40001", code == "40P01": // serialization_failure, deadlock_detected
+		return fmt.Errorf("%w: %v", storage.ErrConflict, err)
+	case strings.HasPrefix(code, "08"), strings.HasPrefix(code, "57"): // connection_exception, operator_intervention
+		return fmt.Errorf("%w: %v", storage.ErrUnavailable, err)
+	}
+
+	return err
+}
@@ -0,0 +1,123 @@
+package psql
+
+import (
+	"server/internal/domain/models"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// sortColumns maps sort fields to SQL expressions. Text columns use the "C"
+// collation so that the order is byte-wise and does not depend on the locale
+// of the database.
+var sortColumns = map[models.SortField]string{
+	models.SortByCreatedAt: "created_at",
+	models.SortByEmail:     `email COLLATE "C"`,
+	models.SortByRole:      `role COLLATE "C"`,
+	models.SortByNick:      `nick COLLATE "C"`,
+}
+
+// buildUsersQuery translates the query into a SELECT of userColumns with
+// positional parameters, table must be quoted. The statement depends on the
+// filter, so it is not prepared.
+func buildUsersQuery(table string, query models.UsersQuery) (string, []any) {
+	var conditions []string
+	var args []any
+	arg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	filter := query.Filter
+	if filter.Role != "" {
+		conditions = append(conditions, "role = "+arg(filter.Role))
+	}
+	if filter.EmailDomain != "" {
+		conditions = append(conditions, "split_part(email, '@', 2) = "+arg(filter.EmailDomain))
+	}
+	if filter.NickPrefix != "" {
+		conditions = append(conditions, "starts_with(nick, "+arg(filter.NickPrefix)+")")
+	}
+	if filter.NickContains != "" {
+		conditions = append(conditions, "strpos(nick, "+arg(filter.NickContains)+") > 0")
+	}
+	if !filter.CreatedAfter.IsZero() {
+		conditions = append(conditions, "created_at >= "+arg(filter.CreatedAfter))
+	}
+	if !filter.CreatedBefore.IsZero() {
+		conditions = append(conditions, "created_at < "+arg(filter.CreatedBefore))
+	}
+	if !filter.IncludeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+
+	column, ok := sortColumns[query.Sort.Field]
+	if !ok {
+		column = sortColumns[models.SortByCreatedAt]
+	}
+
+	direction, comparison := "ASC", ">"
+	if query.Sort.Desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	if query.After != nil {
+		var key any = query.After.Key
+		if column == sortColumns[models.SortByCreatedAt] {
+			key = query.After.CreatedAt
+		}
+		conditions = append(conditions, "("+column+", id) "+comparison+" ("+arg(key)+", "+arg(query.After.Id)+")")
+	}
+
+	var sql strings.Builder
+	sql.WriteString("SELECT " + userColumns + " FROM " + table)
+	if len(conditions) > 0 {
+		sql.WriteString(" WHERE " + strings.Join(conditions, " AND "))
+	}
+	sql.WriteString(" ORDER BY " + column + " " + direction + ", id " + direction)
+
+	var limit any
+	if query.Limit > 0 {
+		limit = query.Limit
+	}
+	sql.WriteString(" LIMIT " + arg(limit))
+
+	return sql.String(), args
+}
+
+// buildAuditQuery translates the query into a SELECT of auditColumns with
+// positional parameters, table must be quoted.
+func buildAuditQuery(table string, query models.AuditQuery) (string, []any) {
+	var conditions []string
+	var args []any
+	arg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if query.TargetId != uuid.Nil {
+		conditions = append(conditions, "target_id = "+arg(query.TargetId))
+	}
+	if query.ActorId != uuid.Nil {
+		conditions = append(conditions, "actor_id = "+arg(query.ActorId))
+	}
+	if query.After != nil {
+		conditions = append(conditions, "(occurred_at, id) < ("+arg(query.After.OccurredAt)+", "+arg(query.After.Id)+")")
+	}
+
+	var stmt strings.Builder
+	stmt.WriteString("SELECT " + auditColumns + " FROM " + table)
+	if len(conditions) > 0 {
+		stmt.WriteString(" WHERE " + strings.Join(conditions, " AND "))
+	}
+	stmt.WriteString(" ORDER BY occurred_at DESC, id DESC")
+
+	var limit any
+	if query.Limit > 0 {
+		limit = query.Limit
+	}
+	stmt.WriteString(" LIMIT " + arg(limit))
+
+	return stmt.String(), args
+}
@@ -0,0 +1,13 @@
+-- Baseline: the table of the original init.sql. Every step is idempotent so
+-- databases created by init.sql are adopted as is, with the accounts they
+-- hold. New databases start empty, see fixtures/dev.sql for local accounts.
+CREATE TABLE IF NOT EXISTS Users (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    email VARCHAR(50) NOT NULL,
+    password VARCHAR(255) NOT NULL,
+    role VARCHAR(20) NOT NULL,
+    nick VARCHAR(50) NOT NULL
+);
+
+-- The first init.sql limited passwords to 50 characters, too short for hashes.
+ALTER TABLE Users ALTER COLUMN password TYPE VARCHAR(255);
@@ -0,0 +1,9 @@
+-- Deleted users may share an email with live ones, so the down step cannot
+-- bring back the unconditional unique index.
+DROP INDEX IF EXISTS users_email_key;
+DROP INDEX IF EXISTS users_deleted_at_idx;
+DROP INDEX IF EXISTS users_created_at_id_idx;
+
+ALTER TABLE Users DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE Users DROP COLUMN IF EXISTS version;
+ALTER TABLE Users DROP COLUMN IF EXISTS created_at;
@@ -0,0 +1,32 @@
+ALTER TABLE Users ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+-- Incremented on every update, guards against lost updates.
+ALTER TABLE Users ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 1;
+-- Set by Delete, rows are purged once it is older than the retention.
+ALTER TABLE Users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+-- Emails are unique regardless of case among users that are not deleted,
+-- the server stores them lowercased.
+DROP INDEX IF EXISTS users_email_key;
+
+-- Databases created by init.sql may hold emails differing only in case. The
+-- oldest user of each such email is kept and the others are soft-deleted, so
+-- the index can be built. The rows given created_at by this migration share
+-- it, the id breaks the tie.
+UPDATE Users SET deleted_at = now()
+WHERE id IN (
+    SELECT id FROM (
+        SELECT id, row_number() OVER (PARTITION BY lower(email) ORDER BY created_at, id) AS n
+        FROM Users
+        WHERE deleted_at IS NULL
+    ) AS ranked
+    WHERE n > 1
+);
+UPDATE Users SET email = lower(email) WHERE email <> lower(email);
+
+CREATE UNIQUE INDEX users_email_key ON Users (lower(email)) WHERE deleted_at IS NULL;
+
+-- Supports the purge of soft-deleted users.
+CREATE INDEX IF NOT EXISTS users_deleted_at_idx ON Users (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Supports keyset pagination of GetUsers.
+CREATE INDEX IF NOT EXISTS users_created_at_id_idx ON Users (created_at, id);
@@ -0,0 +1,15 @@
+-- Append-only log of user changes, written in the transaction of the change.
+-- actor_id is NULL for changes made without an authenticated caller.
+CREATE TABLE IF NOT EXISTS Users_audit (
+    id UUID PRIMARY KEY,
+    occurred_at TIMESTAMPTZ NOT NULL,
+    request_id TEXT NOT NULL,
+    actor_id UUID,
+    operation VARCHAR(20) NOT NULL,
+    target_id UUID NOT NULL,
+    -- Changed fields as [{"field", "before", "after"}], secrets are redacted.
+    changes JSONB NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS users_audit_target_idx ON Users_audit (target_id, occurred_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS users_audit_actor_idx ON Users_audit (actor_id, occurred_at DESC, id DESC);
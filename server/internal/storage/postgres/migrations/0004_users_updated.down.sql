@@ -0,0 +1,2 @@
+ALTER TABLE Users DROP COLUMN IF EXISTS updated_by;
+ALTER TABLE Users DROP COLUMN IF EXISTS updated_at;
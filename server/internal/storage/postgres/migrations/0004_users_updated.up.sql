@@ -0,0 +1,9 @@
+-- Last insert or update, updated_by is NULL for changes made by the server.
+-- Existing users are treated as last updated when they were created.
+ALTER TABLE Users ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ;
+ALTER TABLE Users ADD COLUMN IF NOT EXISTS updated_by UUID;
+
+UPDATE Users SET updated_at = created_at WHERE updated_at IS NULL;
+
+ALTER TABLE Users ALTER COLUMN updated_at SET DEFAULT now();
+ALTER TABLE Users ALTER COLUMN updated_at SET NOT NULL;
@@ -0,0 +1,9 @@
+-- Development accounts, applied only with migrations.dev_fixtures in the
+-- local and dev environments. Plaintext passwords are hashed on the first
+-- successful login.
+INSERT INTO Users (email, password, role, nick)
+SELECT email, password, role, nick FROM (VALUES
+    ('test@test.com', '123', 'user', 'nicK'),
+    ('admin@admin.com', 'qwerty', 'admin', 'qaz')
+) AS seed (email, password, role, nick)
+WHERE NOT EXISTS (SELECT 1 FROM Users);
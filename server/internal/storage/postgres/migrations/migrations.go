@@ -0,0 +1,342 @@
+// Package migrations keeps the Postgres schema in ordered SQL files embedded
+// into the binary. A migration is a pair NNNN_name.up.sql and, optionally,
+// NNNN_name.down.sql. Applied versions are recorded in schema_migrations.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"server/pkg/lib/logger/sl"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// devFixtures adds the development accounts to an empty users table. It is
+// not a migration, so production databases never get them.
+//
+//go:embed fixtures/dev.sql
+var devFixtures string
+
+// lockKey identifies the advisory lock held while migrating, so replicas
+// started together apply the migrations one after another.
+const lockKey int64 = 0x75736572736d6967 // "usersmig"
+
+var (
+	ErrNoDownStep = errors.New("migration has no down step")
+	ErrUnknown    = errors.New("applied migration is unknown to this binary")
+)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	// Down is empty when the migration cannot be rolled back.
+	Down string
+}
+
+// Status is a known or applied migration, AppliedAt is nil for pending ones.
+type Status struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	log        *slog.Logger
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New loads the embedded migrations, it fails on malformed file names.
+func New(log *slog.Logger, db *sql.DB) (*Migrator, error) {
+	const op = "storage.postgres.migrations.New"
+
+	migrations, err := load(files)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Migrator{
+		log:        log,
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
+
+func load(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, file := range names {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(file, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("%s: want NNNN_name.up.sql or NNNN_name.down.sql", file)
+		}
+
+		prefix, name, ok := strings.Cut(base, "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("%s: name must start with a positive version", file)
+		}
+
+		body, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("%s: version %d is also named %q", file, version, m.Name)
+		}
+
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up step", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Up applies every pending migration in version order, each in its own
+// transaction, and returns how many were applied.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	const op = "storage.postgres.migrations.Up"
+	log := m.log.With(slog.String("op", op))
+
+	applied := 0
+	err := m.locked(ctx, func(conn *sql.Conn, done map[int64]appliedMigration) error {
+		for _, migration := range m.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+
+			err := inTx(ctx, conn, func(tx *sql.Tx) error {
+				if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+					return err
+				}
+
+				_, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.Version, migration.Name)
+				return err
+			})
+			if err != nil {
+				log.Error("Failed to apply migration", slog.Int64("version", migration.Version), slog.String("name", migration.Name), sl.Err(err))
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			log.Info("Migration applied", slog.Int64("version", migration.Version), slog.String("name", migration.Name))
+			applied++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return applied, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return applied, nil
+}
+
+// Down rolls back the last steps applied migrations, newest first. It stops
+// at a migration without a down step or one unknown to this binary.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	const op = "storage.postgres.migrations.Down"
+	log := m.log.With(slog.String("op", op))
+
+	known := make(map[int64]Migration, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = migration
+	}
+
+	reverted := 0
+	err := m.locked(ctx, func(conn *sql.Conn, done map[int64]appliedMigration) error {
+		versions := make([]int64, 0, len(done))
+		for version := range done {
+			versions = append(versions, version)
+		}
+		sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+
+		for _, version := range versions {
+			if reverted == steps {
+				break
+			}
+
+			migration, ok := known[version]
+			if !ok {
+				return fmt.Errorf("migration %d: %w", version, ErrUnknown)
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, ErrNoDownStep)
+			}
+
+			err := inTx(ctx, conn, func(tx *sql.Tx) error {
+				if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+					return err
+				}
+
+				_, err := tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+				return err
+			})
+			if err != nil {
+				log.Error("Failed to revert migration", slog.Int64("version", migration.Version), slog.String("name", migration.Name), sl.Err(err))
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			log.Info("Migration reverted", slog.Int64("version", migration.Version), slog.String("name", migration.Name))
+			reverted++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return reverted, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return reverted, nil
+}
+
+// SeedDevFixtures adds the development accounts if the users table is
+// empty. It expects the migrations to be applied.
+func (m *Migrator) SeedDevFixtures(ctx context.Context) error {
+	const op = "storage.postgres.migrations.SeedDevFixtures"
+
+	res, err := m.db.ExecContext(ctx, devFixtures)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	seeded, _ := res.RowsAffected()
+	m.log.Info("Development fixtures applied", slog.String("op", op), slog.Int64("users", seeded))
+	return nil
+}
+
+// Status lists the known migrations and the applied ones unknown to this
+// binary, in version order.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	const op = "storage.postgres.migrations.Status"
+
+	var statuses []Status
+	err := m.locked(ctx, func(conn *sql.Conn, done map[int64]appliedMigration) error {
+		names := make(map[int64]string, len(m.migrations)+len(done))
+		for version, a := range done {
+			names[version] = a.name
+		}
+		for _, migration := range m.migrations {
+			names[migration.Version] = migration.Name
+		}
+
+		for version, name := range names {
+			status := Status{Version: version, Name: name}
+			if a, ok := done[version]; ok {
+				status.AppliedAt = &a.at
+			}
+			statuses = append(statuses, status)
+		}
+		sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return statuses, nil
+}
+
+// appliedMigration is a row of schema_migrations.
+type appliedMigration struct {
+	name string
+	at   time.Time
+}
+
+// locked runs fn on a dedicated connection holding the advisory lock. fn gets
+// the applied migrations by version.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn, done map[int64]appliedMigration) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// The lock belongs to the session, so it is taken and released on conn.
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return err
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", lockKey); err != nil {
+			m.log.Warn("Failed to release migration lock", sl.Err(err))
+		}
+	}()
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return err
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, applied_at FROM schema_migrations")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	done := make(map[int64]appliedMigration)
+	for rows.Next() {
+		var version int64
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.name, &a.at); err != nil {
+			return err
+		}
+		done[version] = a
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	return fn(conn, done)
+}
+
+func inTx(ctx context.Context, conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
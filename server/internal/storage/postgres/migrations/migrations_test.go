@@ -0,0 +1,50 @@
+package migrations
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := load(files)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	for i, m := range migrations {
+		if m.Version != int64(i+1) {
+			t.Errorf("migration %d_%s: versions must be contiguous from 1", m.Version, m.Name)
+		}
+		if m.Down == "" {
+			t.Errorf("migration %d_%s has no down step", m.Version, m.Name)
+		}
+	}
+}
+
+func TestLoadRejectsMalformedNames(t *testing.T) {
+	for _, name := range []string{
+		"0001_users.sql",
+		"0001_users.sideways.sql",
+		"users.up.sql",
+		"0000_users.up.sql",
+		"x001_users.up.sql",
+	} {
+		fsys := fstest.MapFS{name: {Data: []byte("SELECT 1;")}}
+		if _, err := load(fsys); err == nil {
+			t.Errorf("load accepted %q", name)
+		}
+	}
+
+	fsys := fstest.MapFS{"0001_users.down.sql": {Data: []byte("SELECT 1;")}}
+	if _, err := load(fsys); err == nil {
+		t.Error("load accepted a migration without an up step")
+	}
+
+	fsys = fstest.MapFS{
+		"0001_users.up.sql":  {Data: []byte("SELECT 1;")},
+		"0001_people.up.sql": {Data: []byte("SELECT 1;")},
+	}
+	if _, err := load(fsys); err == nil {
+		t.Error("load accepted two names for one version")
+	}
+}
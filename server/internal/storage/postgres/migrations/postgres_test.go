@@ -0,0 +1,96 @@
+package migrations_test
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"testing"
+
+	"server/internal/storage/postgres/migrations"
+	"server/internal/storage/postgres/pgtest"
+
+	_ "github.com/lib/pq"
+)
+
+// initSQL is the table created by the original database/psql/init.sql.
+const initSQL = `CREATE TABLE Users (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    email VARCHAR(50) NOT NULL,
+    password VARCHAR(50) NOT NULL,
+    role VARCHAR(20) NOT NULL,
+    nick VARCHAR(50) NOT NULL
+)`
+
+func TestUpResolvesEmailCaseDuplicates(t *testing.T) {
+	cfg, ok := pgtest.Config(t)
+	if !ok {
+		t.Skipf("%s is not set", pgtest.URLEnv)
+	}
+
+	db, err := sql.Open("postgres", pgtest.Schema(t, cfg).DSN())
+	if err != nil {
+		t.Fatalf("failed to connect to postgres: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	if _, err := db.ExecContext(ctx, initSQL); err != nil {
+		t.Fatalf("failed to create the init.sql table: %v", err)
+	}
+	_, err = db.ExecContext(ctx, `INSERT INTO Users (id, email, password, role, nick) VALUES
+		('00000000-0000-0000-0000-000000000001', 'A@x.com', '123', 'user', 'first'),
+		('00000000-0000-0000-0000-000000000002', 'a@x.com', '123', 'user', 'second'),
+		('00000000-0000-0000-0000-000000000003', 'B@x.com', '123', 'user', 'third')`)
+	if err != nil {
+		t.Fatalf("failed to insert users: %v", err)
+	}
+
+	migrator, err := migrations.New(slog.New(slog.NewTextHandler(io.Discard, nil)), db)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT nick, email, deleted_at IS NOT NULL FROM Users ORDER BY nick")
+	if err != nil {
+		t.Fatalf("failed to read users: %v", err)
+	}
+	defer rows.Close()
+
+	type row struct {
+		email   string
+		deleted bool
+	}
+	got := make(map[string]row)
+	for rows.Next() {
+		var nick string
+		var r row
+		if err := rows.Scan(&nick, &r.email, &r.deleted); err != nil {
+			t.Fatalf("failed to scan user: %v", err)
+		}
+		got[nick] = r
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("failed to read users: %v", err)
+	}
+
+	// The rows share created_at, so the lowest id is the oldest one.
+	want := map[string]row{
+		"first":  {email: "a@x.com"},
+		"second": {email: "a@x.com", deleted: true},
+		"third":  {email: "b@x.com"},
+	}
+	for nick, w := range want {
+		if got[nick] != w {
+			t.Errorf("user %s = %+v, want %+v", nick, got[nick], w)
+		}
+	}
+
+	_, err = db.ExecContext(ctx, "INSERT INTO Users (email, password, role, nick) VALUES ('A@X.COM', '123', 'user', 'fourth')")
+	if err == nil {
+		t.Error("insert of a live duplicate email succeeded, want a unique violation")
+	}
+}
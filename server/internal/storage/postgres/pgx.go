@@ -0,0 +1,495 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"server/internal/domain/interfaces"
+	"server/internal/domain/models"
+	"server/internal/lib/audit"
+	"server/internal/storage"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// PgxDB is the storage of PostgresDB built on the native interface of pgx.
+// Every connection of the pool prepares the statements it runs and keeps them
+// in a cache, and values are sent and received in the binary format.
+type PgxDB struct {
+	TableName      string
+	AuditTableName string
+	Pool           *pgxpool.Pool
+	log            *slog.Logger
+	// table and auditTable are the quoted table names, copyTable is the name
+	// of the table as CopyFrom takes it.
+	table      string
+	auditTable string
+	copyTable  pgx.Identifier
+	auditCopy  pgx.Identifier
+	queries    queries
+	// tx is set on the storage passed to the function of WithTx, all its
+	// queries run in that transaction.
+	tx pgx.Tx
+}
+
+// pgxQuerier is implemented by both *pgxpool.Pool and pgx.Tx.
+type pgxQuerier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+	CopyFrom(ctx context.Context, tableName pgx.Identifier, columnNames []string, rowSrc pgx.CopyFromSource) (int64, error)
+}
+
+// NewPgx connects a pool to the database. MaxOpenConns bounds the pool,
+// MaxIdleConns has no pgx equivalent and is ignored.
+func NewPgx(cfg Config, tablename string, log *slog.Logger) (*PgxDB, error) {
+	const op = "storage.postgres.NewPgx"
+
+	table, err := quoteIdentifier(tablename)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	auditTable, err := quoteIdentifier(tablename + "_audit")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	poolConfig, err := pgxpool.ParseConfig(cfg.DSN())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if cfg.MaxOpenConns > 0 {
+		poolConfig.MaxConns = int32(cfg.MaxOpenConns)
+	}
+	if cfg.ConnMaxLifetime > 0 {
+		poolConfig.MaxConnLifetime = cfg.ConnMaxLifetime
+	}
+	poolConfig.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeCacheStatement
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+	if err != nil {
+		log.Error("Failed to create connection pool", slog.String("operation", op), slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// The pool connects lazily, the ping makes an unreachable database fail
+	// here as it does with database/sql.
+	ctx, cancel := context.WithTimeout(context.Background(), max(cfg.ConnectTimeout, time.Second))
+	defer cancel()
+	if err := pool.Ping(ctx); err != nil {
+		log.Warn("Failed to ping database", slog.String("operation", op), slog.String("error", err.Error()))
+		pool.Close()
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("Database connected successfully", slog.String("operation", op), slog.String("host", cfg.Host), slog.String("dbname", cfg.DBName))
+	return &PgxDB{
+		TableName:      tablename,
+		AuditTableName: tablename + "_audit",
+		Pool:           pool,
+		log:            log,
+		table:          table,
+		auditTable:     auditTable,
+		copyTable:      pgx.Identifier{strings.ToLower(tablename)},
+		auditCopy:      pgx.Identifier{strings.ToLower(tablename + "_audit")},
+		queries:        newQueries(table, auditTable),
+	}, nil
+}
+
+func (p *PgxDB) Stop() error {
+	log := p.log.With(slog.String("operation", "storage.postgres.pgx.Stop"))
+	p.Pool.Close()
+	log.Info("Database connection closed successfully")
+	return nil
+}
+
+// OpenDB returns a database/sql handle sharing the pool, e.g. for the
+// migrations. Closing it leaves the pool open.
+func (p *PgxDB) OpenDB() *sql.DB {
+	return stdlib.OpenDBFromPool(p.Pool)
+}
+
+// Ping checks that the database can be reached.
+func (p *PgxDB) Ping(ctx context.Context) error {
+	const op = "storage.postgres.pgx.Ping"
+
+	if err := p.Pool.Ping(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	return nil
+}
+
+// Health pings the database, Degraded is set when it cannot be reached.
+func (p *PgxDB) Health(ctx context.Context) models.StorageHealth {
+	return models.StorageHealth{
+		Backend:  "postgres",
+		Degraded: p.Ping(ctx) != nil,
+	}
+}
+
+// conn returns the transaction of the storage, if any, or the pool.
+func (p *PgxDB) conn() pgxQuerier {
+	if p.tx != nil {
+		return p.tx
+	}
+
+	return p.Pool
+}
+
+// inTx runs fn in a transaction that is committed when fn succeeds and rolled
+// back otherwise. Inside WithTx fn joins the transaction of the storage.
+func (p *PgxDB) inTx(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	if p.tx != nil {
+		return fn(p.tx)
+	}
+
+	tx, err := p.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		// The context may be done already, the rollback must still happen.
+		_ = tx.Rollback(context.WithoutCancel(ctx))
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// WithTx runs fn in a transaction, the storage passed to fn runs all its
+// queries in it.
+func (p *PgxDB) WithTx(ctx context.Context, fn func(tx interfaces.Storage) error) error {
+	const op = "storage.postgres.pgx.WithTx"
+
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		bound := *p
+		bound.tx = tx
+		return fn(&bound)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	return nil
+}
+
+// appendAudit writes the audit event carried by ctx, if any, with the diff
+// between before and after. It must run in the transaction of the change.
+func (p *PgxDB) appendAudit(ctx context.Context, tx pgx.Tx, before *models.User, after *models.User) error {
+	event, ok := audit.EventFromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	row, err := auditRow(event, before, after)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, p.queries.insertAuditEvent, row...)
+	return err
+}
+
+func (p *PgxDB) GetUsers(ctx context.Context, query models.UsersQuery) ([]models.User, error) {
+	const op = "storage.postgres.pgx.GetUsers"
+	log := p.log.With(slog.String("op", op))
+
+	stmt, args := buildUsersQuery(p.table, query)
+	rows, err := p.conn().Query(ctx, stmt, args...)
+	if err != nil {
+		log.Warn("Error querying users", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+	defer rows.Close()
+
+	users := make([]models.User, 0, query.Limit)
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			log.Warn("Error scanning user row", slog.String("error", err.Error()))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Warn("Error iterating user rows", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	log.Info("Fetched users successfully", slog.Int("count", len(users)))
+	return users, nil
+}
+
+// StreamUsers scans the result row by row, pgx reads rows from the connection
+// as they are scanned.
+func (p *PgxDB) StreamUsers(ctx context.Context, query models.UsersQuery, fn func(models.User) error) error {
+	const op = "storage.postgres.pgx.StreamUsers"
+	log := p.log.With(slog.String("op", op))
+
+	query.Limit, query.After = 0, nil
+	stmt, args := buildUsersQuery(p.table, query)
+	rows, err := p.conn().Query(ctx, stmt, args...)
+	if err != nil {
+		log.Warn("Error querying users", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, mapError(err))
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			log.Warn("Error scanning user row", slog.String("error", err.Error()))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := fn(user); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		count++
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Warn("Error iterating user rows", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	log.Info("Streamed users successfully", slog.Int("count", count))
+	return nil
+}
+
+func (p *PgxDB) GetUserById(ctx context.Context, uid uuid.UUID) (models.User, error) {
+	const op = "storage.postgres.pgx.GetUserById"
+	log := p.log.With(slog.String("op", op))
+
+	user, err := scanUser(p.conn().QueryRow(ctx, p.queries.userById, uid))
+	if err != nil {
+		log.Warn("Error retrieving user by ID", slog.String("userId", uid.String()), slog.String("error", err.Error()))
+		return models.User{}, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	log.Info("User retrieved successfully", slog.String("userId", uid.String()))
+	return user, nil
+}
+
+// GetUsersByIds finds the users with a single = ANY query.
+func (p *PgxDB) GetUsersByIds(ctx context.Context, uids []uuid.UUID) ([]models.User, error) {
+	const op = "storage.postgres.pgx.GetUsersByIds"
+	log := p.log.With(slog.String("op", op))
+
+	found, err := p.queryUsers(ctx, p.conn(), p.queries.usersByIds, uids)
+	if err != nil {
+		log.Warn("Error retrieving users by ID", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	users := inIdsOrder(uids, found)
+	log.Info("Users retrieved successfully", slog.Int("requested", len(uids)), slog.Int("count", len(users)))
+	return users, nil
+}
+
+func (p *PgxDB) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	const op = "storage.postgres.pgx.GetUserByEmail"
+	log := p.log.With(slog.String("op", op))
+
+	user, err := scanUser(p.conn().QueryRow(ctx, p.queries.userByEmail, email))
+	if err != nil {
+		log.Warn("Error retrieving user by email", slog.String("email", email), slog.String("error", err.Error()))
+		return models.User{}, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	log.Info("User retrieved successfully", slog.String("email", email))
+	return user, nil
+}
+
+// Insert adds the user and its audit event in one transaction.
+func (p *PgxDB) Insert(ctx context.Context, user models.User) error {
+	const op = "storage.postgres.pgx.Insert"
+	log := p.log.With(slog.String("op", op))
+
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, p.queries.insertUser,
+			user.Id, user.Email, user.Password, user.Role, user.Nick, user.CreatedAt, user.Version, user.UpdatedAt, nullableId(user.UpdatedBy),
+		)
+		if err != nil {
+			return err
+		}
+
+		if tag.RowsAffected() == 0 {
+			return errors.New("no rows affected")
+		}
+
+		return p.appendAudit(ctx, tx, nil, &user)
+	})
+	if err != nil {
+		log.Warn("Error inserting user", slog.String("userId", user.Id.String()), slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	log.Info("User inserted successfully", slog.String("userId", user.Id.String()))
+	return nil
+}
+
+// Update changes the user only if its stored version equals user.Version and
+// increments the version. A version mismatch is reported as storage.ErrConflict.
+// The row is locked while the change and its audit event are written.
+func (p *PgxDB) Update(ctx context.Context, uid uuid.UUID, user models.User) error {
+	const op = "storage.postgres.pgx.Update"
+	log := p.log.With(slog.String("op", op))
+
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		current, err := scanUser(tx.QueryRow(ctx, p.queries.lockUser, uid))
+		if err != nil {
+			return err
+		}
+
+		if current.Version != user.Version {
+			return storage.ErrConflict
+		}
+
+		_, err = tx.Exec(ctx, p.queries.updateUser,
+			user.Email, user.Password, user.Role, user.Nick, user.UpdatedAt, nullableId(user.UpdatedBy), uid,
+		)
+		if err != nil {
+			return err
+		}
+
+		return p.appendAudit(ctx, tx, &current, &user)
+	})
+	if err != nil {
+		log.Warn("Error updating user", slog.String("userId", uid.String()), slog.Int64("version", user.Version), slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	log.Info("User updated successfully", slog.String("userId", uid.String()))
+	return nil
+}
+
+// Delete marks the user as deleted and bumps its version in a single
+// statement, see PostgresDB.Delete.
+func (p *PgxDB) Delete(ctx context.Context, uid uuid.UUID) (models.User, error) {
+	const op = "storage.postgres.pgx.Delete"
+	log := p.log.With(slog.String("op", op))
+
+	var user models.User
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		deletedAt := time.Now().UTC().Truncate(time.Microsecond)
+		user, err = scanUser(tx.QueryRow(ctx, p.queries.deleteUser, deletedAt, uid))
+		if err != nil {
+			return err
+		}
+
+		before := user
+		before.DeletedAt = nil
+		before.Version--
+
+		return p.appendAudit(ctx, tx, &before, &user)
+	})
+	if err != nil {
+		log.Warn("Error deleting user", slog.String("userId", uid.String()), slog.String("error", err.Error()))
+		return models.User{}, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	log.Info("User deleted successfully", slog.String("userId", uid.String()))
+	return user, nil
+}
+
+// Restore clears the deletion mark of a deleted user and bumps its version.
+func (p *PgxDB) Restore(ctx context.Context, uid uuid.UUID) (models.User, error) {
+	const op = "storage.postgres.pgx.Restore"
+	log := p.log.With(slog.String("op", op))
+
+	var user models.User
+	err := p.inTx(ctx, func(tx pgx.Tx) error {
+		var err error
+		user, err = scanUser(tx.QueryRow(ctx, p.queries.lockDeletedUser, uid))
+		if err != nil {
+			return err
+		}
+		before := user
+
+		// The email may have been taken since the delete. The unique index on
+		// emails still guards against a concurrent insert.
+		_, err = scanUser(tx.QueryRow(ctx, p.queries.userByEmail, user.Email))
+		if err == nil {
+			return storage.ErrUserExists
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, p.queries.restoreUser, uid); err != nil {
+			return err
+		}
+
+		user.DeletedAt = nil
+		user.Version++
+
+		return p.appendAudit(ctx, tx, &before, &user)
+	})
+	if err != nil {
+		log.Warn("Error restoring user", slog.String("userId", uid.String()), slog.String("error", err.Error()))
+		return models.User{}, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	log.Info("User restored successfully", slog.String("userId", uid.String()))
+	return user, nil
+}
+
+// Purge removes the users deleted before deletedBefore for good.
+func (p *PgxDB) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	const op = "storage.postgres.pgx.Purge"
+	log := p.log.With(slog.String("op", op))
+
+	tag, err := p.conn().Exec(ctx, p.queries.purgeUsers, deletedBefore)
+	if err != nil {
+		log.Warn("Error purging deleted users", slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// GetAuditEvents returns the events matching the query, newest first.
+func (p *PgxDB) GetAuditEvents(ctx context.Context, query models.AuditQuery) ([]models.AuditEvent, error) {
+	const op = "storage.postgres.pgx.GetAuditEvents"
+	log := p.log.With(slog.String("op", op))
+
+	stmt, args := buildAuditQuery(p.auditTable, query)
+	rows, err := p.conn().Query(ctx, stmt, args...)
+	if err != nil {
+		log.Warn("Error querying audit events", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+	defer rows.Close()
+
+	var events []models.AuditEvent
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			log.Warn("Error scanning audit event row", slog.String("error", err.Error()))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Warn("Error iterating audit event rows", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	return events, nil
+}
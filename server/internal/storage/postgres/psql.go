@@ -6,7 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net"
+	"net/url"
+	"server/internal/domain/interfaces"
 	"server/internal/domain/models"
+	"server/internal/storage"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,44 +20,105 @@ import (
 
 type PostgresDB struct {
 	TableName string
-	DB        *sql.DB
-	log       *slog.Logger
+	// AuditTableName holds the audit log of TableName, see GetAuditEvents.
+	AuditTableName string
+	DB             *sql.DB
+	log            *slog.Logger
+	// table and auditTable are the quoted table names.
+	table      string
+	auditTable string
+	queries    queries
+	stmts      *statements
+	// tx is set on the storage passed to the function of WithTx, all its
+	// queries run in that transaction.
+	tx *sql.Tx
+}
+
+// Config describes the database connection. Zero pool limits keep the
+// database/sql defaults, a zero ConnectTimeout waits for the driver. A
+// non-empty Schema is the search_path of the connections.
+type Config struct {
+	Host            string
+	Port            int
+	User            string
+	Password        string
+	DBName          string
+	SSLMode         string
+	Schema          string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnectTimeout  time.Duration
+}
+
+// DSN returns the connection URL, credentials are escaped.
+func (c Config) DSN() string {
+	query := url.Values{"sslmode": {c.SSLMode}}
+	if c.ConnectTimeout > 0 {
+		// The driver takes whole seconds and treats zero as no timeout.
+		query.Set("connect_timeout", strconv.Itoa(max(int(c.ConnectTimeout/time.Second), 1)))
+	}
+	if c.Schema != "" {
+		// Both drivers pass unknown parameters on as run-time settings.
+		query.Set("search_path", c.Schema)
+	}
+
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.User, c.Password),
+		Host:     net.JoinHostPort(c.Host, strconv.Itoa(c.Port)),
+		Path:     "/" + c.DBName,
+		RawQuery: query.Encode(),
+	}
+
+	return dsn.String()
 }
 
 // Создание нового подключения к базе данных
-func New(host string, user string, password string, port int, dbname string, tablename string, log *slog.Logger) (*PostgresDB, error) {
+func New(cfg Config, tablename string, log *slog.Logger) (*PostgresDB, error) {
 	const op = "storage.postgres.New"
-	connStr := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable",
-		user,
-		password,
-		host,
-		port,
-		dbname,
-	)
 
-	db, err := sql.Open("postgres", connStr)
+	table, err := quoteIdentifier(tablename)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	auditTable, err := quoteIdentifier(tablename + "_audit")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	db, err := sql.Open("postgres", cfg.DSN())
 	if err != nil {
 		log.Error("Failed to open database connection", slog.String("operation", op), slog.String("error", err.Error()))
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
-	time.Sleep(100 * time.Millisecond)
 	err = db.Ping()
 	if err != nil {
 		log.Warn("Failed to ping database", slog.String("operation", op), slog.String("error", err.Error()))
+		db.Close()
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	log.Info("Database connected successfully", slog.String("operation", op))
+	log.Info("Database connected successfully", slog.String("operation", op), slog.String("host", cfg.Host), slog.String("dbname", cfg.DBName))
 	return &PostgresDB{
-		TableName: tablename,
-		DB:        db,
-		log:       log,
+		TableName:      tablename,
+		AuditTableName: tablename + "_audit",
+		DB:             db,
+		log:            log,
+		table:          table,
+		auditTable:     auditTable,
+		queries:        newQueries(table, auditTable),
+		stmts:          newStatements(db),
 	}, nil
 }
 
 func (p *PostgresDB) Stop() error {
 	log := p.log.With(slog.String("operation", "storage.postgres.Stop"))
+	p.stmts.close()
 	if err := p.DB.Close(); err != nil {
 		log.Warn("Failed to close database connection", slog.String("error", err.Error()))
 		return err
@@ -61,127 +127,367 @@ func (p *PostgresDB) Stop() error {
 	return nil
 }
 
-func (p *PostgresDB) GetUsers(ctx context.Context) ([]models.User, error) {
+// conn returns the transaction of the storage, if any, or the database.
+func (p *PostgresDB) conn() querier {
+	if p.tx != nil {
+		return p.tx
+	}
+
+	return p.DB
+}
+
+// WithTx runs fn in a transaction, the storage passed to fn runs all its
+// queries in it.
+func (p *PostgresDB) WithTx(ctx context.Context, fn func(tx interfaces.Storage) error) error {
+	const op = "storage.postgres.WithTx"
+
+	err := p.inTx(ctx, func(tx *sql.Tx) error {
+		bound := *p
+		bound.tx = tx
+		return fn(&bound)
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	return nil
+}
+
+// Ping checks that the database can be reached.
+func (p *PostgresDB) Ping(ctx context.Context) error {
+	const op = "storage.postgres.Ping"
+
+	if err := p.DB.PingContext(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	return nil
+}
+
+// Health pings the database, Degraded is set when it cannot be reached.
+func (p *PostgresDB) Health(ctx context.Context) models.StorageHealth {
+	return models.StorageHealth{
+		Backend:  "postgres",
+		Degraded: p.Ping(ctx) != nil,
+	}
+}
+
+func (p *PostgresDB) GetUsers(ctx context.Context, query models.UsersQuery) ([]models.User, error) {
 	const op = "storage.postgres.GetUsers"
 	log := p.log.With(slog.String("op", op))
 
-	rows, err := p.DB.QueryContext(ctx, "SELECT * FROM "+p.TableName+";")
+	stmt, args := buildUsersQuery(p.table, query)
+	rows, err := p.conn().QueryContext(ctx, stmt, args...)
 	if err != nil {
 		log.Warn("Error querying users", slog.String("error", err.Error()))
-		return nil, fmt.Errorf("%s: %w", op, err)
+		return nil, fmt.Errorf("%s: %w", op, mapError(err))
 	}
 	defer rows.Close()
 
 	var users_from_db []models.User
 	for rows.Next() {
-		var user models.User
-		if err := rows.Scan(&user.Id, &user.Email, &user.Password, &user.Role, &user.Nick); err != nil {
+		user, err := scanUser(rows)
+		if err != nil {
 			log.Warn("Error scanning user row", slog.String("error", err.Error()))
 			continue
 		}
 		users_from_db = append(users_from_db, user)
 	}
 
+	if err := rows.Err(); err != nil {
+		log.Warn("Error iterating user rows", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
 	log.Info("Fetched users successfully", slog.Int("count", len(users_from_db)))
 	return users_from_db, nil
 }
 
+// StreamUsers scans the result row by row. The driver reads rows from the
+// connection as they are scanned, so a slow fn holds the query back instead of
+// buffering the table in memory.
+func (p *PostgresDB) StreamUsers(ctx context.Context, query models.UsersQuery, fn func(models.User) error) error {
+	const op = "storage.postgres.StreamUsers"
+	log := p.log.With(slog.String("op", op))
+
+	query.Limit, query.After = 0, nil
+	stmt, args := buildUsersQuery(p.table, query)
+	rows, err := p.conn().QueryContext(ctx, stmt, args...)
+	if err != nil {
+		log.Warn("Error querying users", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, mapError(err))
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			log.Warn("Error scanning user row", slog.String("error", err.Error()))
+			return fmt.Errorf("%s: %w", op, err)
+		}
+
+		if err := fn(user); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		count++
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Warn("Error iterating user rows", slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	log.Info("Streamed users successfully", slog.Int("count", count))
+	return nil
+}
+
 func (p *PostgresDB) GetUserById(ctx context.Context, uid uuid.UUID) (models.User, error) {
 	const op = "storage.postgres.GetUserById"
 	log := p.log.With(slog.String("op", op))
 
-	row := p.DB.QueryRowContext(ctx, "SELECT * FROM "+p.TableName+" WHERE id=$1", uid)
-	var user models.User
-	if err := row.Scan(&user.Id, &user.Email, &user.Password, &user.Role, &user.Nick); err != nil {
+	user, err := p.queryUser(ctx, p.queries.userById, uid)
+	if err != nil {
 		log.Warn("Error retrieving user by ID", slog.String("userId", uid.String()), slog.String("error", err.Error()))
-		return models.User{}, fmt.Errorf("%s: %w", op, err)
+		return models.User{}, fmt.Errorf("%s: %w", op, mapError(err))
 	}
 
 	log.Info("User retrieved successfully", slog.String("userId", uid.String()))
 	return user, nil
 }
 
+// GetUsersByIds finds the users with a single = ANY query.
+func (p *PostgresDB) GetUsersByIds(ctx context.Context, uids []uuid.UUID) ([]models.User, error) {
+	const op = "storage.postgres.GetUsersByIds"
+	log := p.log.With(slog.String("op", op))
+
+	found, err := p.queryUsers(ctx, nil, p.queries.usersByIds, idArray(uids))
+	if err != nil {
+		log.Warn("Error retrieving users by ID", slog.String("error", err.Error()))
+		return nil, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	users := inIdsOrder(uids, found)
+	log.Info("Users retrieved successfully", slog.Int("requested", len(uids)), slog.Int("count", len(users)))
+	return users, nil
+}
+
 func (p *PostgresDB) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
 	const op = "storage.postgres.GetUserByEmail"
 	log := p.log.With(slog.String("op", op))
 
-	row := p.DB.QueryRowContext(ctx, "SELECT * FROM "+p.TableName+" WHERE email=$1", email)
-	var user models.User
-	if err := row.Scan(&user.Id, &user.Email, &user.Password, &user.Role, &user.Nick); err != nil {
+	user, err := p.queryUser(ctx, p.queries.userByEmail, email)
+	if err != nil {
 		log.Warn("Error retrieving user by email", slog.String("email", email), slog.String("error", err.Error()))
-		return models.User{}, fmt.Errorf("%s: %w", op, err)
+		return models.User{}, fmt.Errorf("%s: %w", op, mapError(err))
 	}
 
 	log.Info("User retrieved successfully", slog.String("email", email))
 	return user, nil
 }
 
+// queryUser runs a cached statement returning a single row of userColumns.
+func (p *PostgresDB) queryUser(ctx context.Context, query string, args ...any) (models.User, error) {
+	stmt, err := p.stmt(ctx, nil, query)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return scanUser(stmt.QueryRowContext(ctx, args...))
+}
+
+// Insert adds the user and its audit event in one transaction.
 func (p *PostgresDB) Insert(ctx context.Context, user models.User) error {
 	const op = "storage.postgres.Insert"
 	log := p.log.With(slog.String("op", op))
 
-	result, err := p.DB.ExecContext(ctx,
-		"INSERT INTO "+p.TableName+" VALUES($1, $2, $3, $4, $5)",
-		user.Id, user.Email, user.Password, user.Role, user.Nick,
-	)
-	if err != nil {
-		log.Warn("Error inserting user", slog.Any("user", user), slog.String("error", err.Error()))
-		return fmt.Errorf("%s: %w", op, err)
-	}
+	err := p.inTx(ctx, func(tx *sql.Tx) error {
+		stmt, err := p.stmt(ctx, tx, p.queries.insertUser)
+		if err != nil {
+			return err
+		}
+
+		result, err := stmt.ExecContext(ctx,
+			user.Id, user.Email, user.Password, user.Role, user.Nick, user.CreatedAt, user.Version, user.UpdatedAt, nullableId(user.UpdatedBy),
+		)
+		if err != nil {
+			return err
+		}
+
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			return errors.New("no rows affected")
+		}
 
-	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
-		log.Warn("No rows affected during insert operation", slog.Any("user", user))
-		return fmt.Errorf("%s: %w", op, errors.New("no rows affected"))
+		return p.appendAudit(ctx, tx, nil, &user)
+	})
+	if err != nil {
+		log.Warn("Error inserting user", slog.String("userId", user.Id.String()), slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, mapError(err))
 	}
 
-	log.Info("User inserted successfully", slog.Any("user", user))
+	log.Info("User inserted successfully", slog.String("userId", user.Id.String()))
 	return nil
 }
 
+// Update changes the user only if its stored version equals user.Version and
+// increments the version. A version mismatch is reported as storage.ErrConflict.
+// The row is locked while the change and its audit event are written.
 func (p *PostgresDB) Update(ctx context.Context, uid uuid.UUID, user models.User) error {
 	const op = "storage.postgres.Update"
 	log := p.log.With(slog.String("op", op))
 
-	result, err := p.DB.ExecContext(ctx,
-		"UPDATE "+p.TableName+" SET email=$1, password=$2, role=$3, nick=$4 WHERE id=$5",
-		user.Email, user.Password, user.Role, user.Nick, uid,
-	)
-	if err != nil {
-		log.Warn("Error updating user", slog.String("userId", uid.String()), slog.Any("user", user), slog.String("error", err.Error()))
-		return fmt.Errorf("%s: %w", op, err)
-	}
+	err := p.inTx(ctx, func(tx *sql.Tx) error {
+		lock, err := p.stmt(ctx, tx, p.queries.lockUser)
+		if err != nil {
+			return err
+		}
+		current, err := scanUser(lock.QueryRowContext(ctx, uid))
+		if err != nil {
+			return err
+		}
+
+		if current.Version != user.Version {
+			return storage.ErrConflict
+		}
+
+		update, err := p.stmt(ctx, tx, p.queries.updateUser)
+		if err != nil {
+			return err
+		}
+		_, err = update.ExecContext(ctx,
+			user.Email, user.Password, user.Role, user.Nick, user.UpdatedAt, nullableId(user.UpdatedBy), uid,
+		)
+		if err != nil {
+			return err
+		}
 
-	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
-		log.Warn("No rows affected during update operation", slog.String("userId", uid.String()))
-		return fmt.Errorf("%s: %w", op, errors.New("no rows affected"))
+		return p.appendAudit(ctx, tx, &current, &user)
+	})
+	if err != nil {
+		log.Warn("Error updating user", slog.String("userId", uid.String()), slog.Int64("version", user.Version), slog.String("error", err.Error()))
+		return fmt.Errorf("%s: %w", op, mapError(err))
 	}
 
-	log.Info("User updated successfully", slog.String("userId", uid.String()), slog.Any("user", user))
+	log.Info("User updated successfully", slog.String("userId", uid.String()))
 	return nil
 }
 
+// Delete marks the user as deleted and bumps its version in a single
+// statement, so the returned user is the one that was deleted even when it is
+// updated concurrently.
 func (p *PostgresDB) Delete(ctx context.Context, uid uuid.UUID) (models.User, error) {
 	const op = "storage.postgres.Delete"
 	log := p.log.With(slog.String("op", op))
 
 	var user models.User
-	row := p.DB.QueryRowContext(ctx, "SELECT * FROM "+p.TableName+" WHERE id=$1", uid)
-	if err := row.Scan(&user.Id, &user.Email, &user.Password, &user.Role, &user.Nick); err != nil {
-		log.Warn("Error retrieving user for deletion", slog.String("userId", uid.String()), slog.String("error", err.Error()))
-		return models.User{}, fmt.Errorf("%s: %w", op, err)
-	}
+	err := p.inTx(ctx, func(tx *sql.Tx) error {
+		stmt, err := p.stmt(ctx, tx, p.queries.deleteUser)
+		if err != nil {
+			return err
+		}
+
+		deletedAt := time.Now().UTC().Truncate(time.Microsecond)
+		user, err = scanUser(stmt.QueryRowContext(ctx, deletedAt, uid))
+		if err != nil {
+			return err
+		}
+
+		// The statement changed nothing else, so the user before it follows
+		// from the returned one.
+		before := user
+		before.DeletedAt = nil
+		before.Version--
 
-	result, err := p.DB.ExecContext(ctx, "DELETE FROM "+p.TableName+" WHERE id=$1", uid)
+		return p.appendAudit(ctx, tx, &before, &user)
+	})
 	if err != nil {
 		log.Warn("Error deleting user", slog.String("userId", uid.String()), slog.String("error", err.Error()))
-		return models.User{}, fmt.Errorf("%s: %w", op, err)
+		return models.User{}, fmt.Errorf("%s: %w", op, mapError(err))
 	}
 
-	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
-		log.Warn("No rows affected during delete operation", slog.String("userId", uid.String()))
-		return models.User{}, fmt.Errorf("%s: %w", op, errors.New("no rows affected"))
+	log.Info("User deleted successfully", slog.String("userId", uid.String()))
+	return user, nil
+}
+
+// Restore clears the deletion mark of a deleted user and bumps its version.
+func (p *PostgresDB) Restore(ctx context.Context, uid uuid.UUID) (models.User, error) {
+	const op = "storage.postgres.Restore"
+	log := p.log.With(slog.String("op", op))
+
+	var user models.User
+	err := p.inTx(ctx, func(tx *sql.Tx) error {
+		lock, err := p.stmt(ctx, tx, p.queries.lockDeletedUser)
+		if err != nil {
+			return err
+		}
+		user, err = scanUser(lock.QueryRowContext(ctx, uid))
+		if err != nil {
+			return err
+		}
+		before := user
+
+		// The email may have been taken since the delete. The unique index on
+		// emails still guards against a concurrent insert.
+		taken, err := p.stmt(ctx, tx, p.queries.userByEmail)
+		if err != nil {
+			return err
+		}
+		_, err = scanUser(taken.QueryRowContext(ctx, user.Email))
+		if err == nil {
+			return storage.ErrUserExists
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		restore, err := p.stmt(ctx, tx, p.queries.restoreUser)
+		if err != nil {
+			return err
+		}
+		if _, err := restore.ExecContext(ctx, uid); err != nil {
+			return err
+		}
+
+		user.DeletedAt = nil
+		user.Version++
+
+		return p.appendAudit(ctx, tx, &before, &user)
+	})
+	if err != nil {
+		log.Warn("Error restoring user", slog.String("userId", uid.String()), slog.String("error", err.Error()))
+		return models.User{}, fmt.Errorf("%s: %w", op, mapError(err))
 	}
 
-	log.Info("User deleted successfully", slog.String("userId", uid.String()), slog.Any("user", user))
+	log.Info("User restored successfully", slog.String("userId", uid.String()))
 	return user, nil
 }
+
+// nullableId stores uuid.Nil as NULL. Scanning NULL into a uuid.UUID gives uuid.Nil back.
+func nullableId(id uuid.UUID) any {
+	if id == uuid.Nil {
+		return nil
+	}
+
+	return id
+}
+
+// Purge removes the users deleted before deletedBefore for good.
+func (p *PostgresDB) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	const op = "storage.postgres.Purge"
+	log := p.log.With(slog.String("op", op))
+
+	stmt, err := p.stmt(ctx, nil, p.queries.purgeUsers)
+	if err != nil {
+		log.Warn("Error purging deleted users", slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	result, err := stmt.ExecContext(ctx, deletedBefore)
+	if err != nil {
+		log.Warn("Error purging deleted users", slog.String("error", err.Error()))
+		return 0, fmt.Errorf("%s: %w", op, mapError(err))
+	}
+
+	purged, _ := result.RowsAffected()
+	return purged, nil
+}
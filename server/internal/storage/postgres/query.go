@@ -0,0 +1,195 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"server/internal/domain/models"
+	"strings"
+	"sync"
+
+	"github.com/lib/pq"
+)
+
+// userColumns lists the columns of the users table in the order scanUser
+// reads them. Queries never use SELECT *, so a new column does not shift the
+// scan.
+const userColumns = "id, email, password, role, nick, created_at, version, deleted_at, updated_at, updated_by"
+
+// auditColumns lists the columns of the audit table in the order
+// scanAuditEvent reads them.
+const auditColumns = "id, occurred_at, request_id, actor_id, operation, target_id, changes"
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// quoteIdentifier checks that name is a plain SQL identifier and quotes it.
+// The name is folded to lower case first, as Postgres does with unquoted
+// names, so "Users" still refers to the table created as CREATE TABLE Users.
+func quoteIdentifier(name string) (string, error) {
+	// Postgres truncates identifiers longer than 63 bytes.
+	if len(name) > 63 || !identifierPattern.MatchString(name) {
+		return "", fmt.Errorf("invalid identifier %q", name)
+	}
+
+	return pq.QuoteIdentifier(strings.ToLower(name)), nil
+}
+
+// scanner is implemented by *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanUser reads a row of userColumns.
+func scanUser(row scanner) (models.User, error) {
+	var user models.User
+	err := row.Scan(&user.Id, &user.Email, &user.Password, &user.Role, &user.Nick, &user.CreatedAt, &user.Version, &user.DeletedAt, &user.UpdatedAt, &user.UpdatedBy)
+
+	return user, err
+}
+
+// queries holds the fixed statements of a storage, built once from the quoted
+// table names.
+type queries struct {
+	userById         string
+	userByEmail      string
+	insertUser       string
+	lockUser         string
+	updateUser       string
+	deleteUser       string
+	lockDeletedUser  string
+	restoreUser      string
+	purgeUsers       string
+	insertAuditEvent string
+	// usersByIds, takenUsers, lockUsers and deleteUsers serve the batches,
+	// their parameters are arrays of ids and of lowercased emails.
+	usersByIds  string
+	takenUsers  string
+	lockUsers   string
+	deleteUsers string
+}
+
+func newQueries(users string, audit string) queries {
+	return queries{
+		userById:    "SELECT " + userColumns + " FROM " + users + " WHERE id=$1 AND deleted_at IS NULL",
+		userByEmail: "SELECT " + userColumns + " FROM " + users + " WHERE lower(email)=lower($1) AND deleted_at IS NULL",
+		insertUser: "INSERT INTO " + users + " (id, email, password, role, nick, created_at, version, updated_at, updated_by)" +
+			" VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)",
+		lockUser: "SELECT " + userColumns + " FROM " + users + " WHERE id=$1 AND deleted_at IS NULL FOR UPDATE",
+		updateUser: "UPDATE " + users + " SET email=$1, password=$2, role=$3, nick=$4, updated_at=$5, updated_by=$6, version=version+1" +
+			" WHERE id=$7",
+		deleteUser: "UPDATE " + users + " SET deleted_at=$1, version=version+1 WHERE id=$2 AND deleted_at IS NULL" +
+			" RETURNING " + userColumns,
+		lockDeletedUser:  "SELECT " + userColumns + " FROM " + users + " WHERE id=$1 AND deleted_at IS NOT NULL FOR UPDATE",
+		restoreUser:      "UPDATE " + users + " SET deleted_at=NULL, version=version+1 WHERE id=$1",
+		purgeUsers:       "DELETE FROM " + users + " WHERE deleted_at < $1",
+		insertAuditEvent: "INSERT INTO " + audit + " (" + auditColumns + ") VALUES($1, $2, $3, $4, $5, $6, $7)",
+		usersByIds:       "SELECT " + userColumns + " FROM " + users + " WHERE id = ANY($1::uuid[]) AND deleted_at IS NULL",
+		takenUsers: "SELECT " + userColumns + " FROM " + users +
+			" WHERE id = ANY($1::uuid[]) OR (lower(email) = ANY($2::text[]) AND deleted_at IS NULL)",
+		lockUsers: "SELECT " + userColumns + " FROM " + users +
+			" WHERE (id = ANY($1::uuid[]) OR lower(email) = ANY($2::text[])) AND deleted_at IS NULL FOR UPDATE",
+		deleteUsers: "UPDATE " + users + " SET deleted_at=$1, version=version+1 WHERE id = ANY($2::uuid[]) AND deleted_at IS NULL" +
+			" RETURNING " + userColumns,
+	}
+}
+
+// statements caches prepared statements by query. database/sql prepares a
+// statement again on each connection it runs on and keeps it there, so every
+// query is prepared once per connection.
+type statements struct {
+	db    *sql.DB
+	mu    sync.Mutex
+	stmts map[string]*sql.Stmt
+}
+
+func newStatements(db *sql.DB) *statements {
+	return &statements{
+		db:    db,
+		stmts: make(map[string]*sql.Stmt),
+	}
+}
+
+// get returns the cached statement of query, if any.
+func (s *statements) get(query string) (*sql.Stmt, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stmt, ok := s.stmts[query]
+	return stmt, ok
+}
+
+// prepare returns the cached statement of query, preparing it on first use.
+// A failed prepare is not cached.
+func (s *statements) prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	if stmt, ok := s.get(query); ok {
+		return stmt, nil
+	}
+
+	// Prepared without the lock, it waits for the database.
+	stmt, err := s.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cached, ok := s.stmts[query]; ok {
+		stmt.Close()
+		return cached, nil
+	}
+	s.stmts[query] = stmt
+
+	return stmt, nil
+}
+
+// close closes the cached statements.
+func (s *statements) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for query, stmt := range s.stmts {
+		stmt.Close()
+		delete(s.stmts, query)
+	}
+}
+
+// Prepare prepares the fixed statements of the storage. It is called once the
+// tables exist, statements not prepared yet are prepared on first use.
+func (p *PostgresDB) Prepare(ctx context.Context) error {
+	const op = "storage.postgres.Prepare"
+
+	q := p.queries
+	for _, query := range []string{
+		q.userById, q.userByEmail, q.insertUser, q.lockUser, q.updateUser,
+		q.deleteUser, q.lockDeletedUser, q.restoreUser, q.purgeUsers, q.insertAuditEvent,
+		q.usersByIds, q.takenUsers, q.lockUsers, q.deleteUsers,
+	} {
+		if _, err := p.stmts.prepare(ctx, query); err != nil {
+			return fmt.Errorf("%s: %w", op, mapError(err))
+		}
+	}
+
+	return nil
+}
+
+// stmt returns the prepared statement of query, bound to tx or else to the
+// transaction of the storage, if any. The statements bound to a transaction
+// are closed by database/sql when it ends.
+func (p *PostgresDB) stmt(ctx context.Context, tx *sql.Tx, query string) (*sql.Stmt, error) {
+	if tx == nil {
+		tx = p.tx
+	}
+	if tx == nil {
+		return p.stmts.prepare(ctx, query)
+	}
+
+	if stmt, ok := p.stmts.get(query); ok {
+		return tx.StmtContext(ctx, stmt), nil
+	}
+
+	// Preparing it for the cache would take a second connection while the
+	// transaction holds one, and could exhaust the pool.
+	return tx.PrepareContext(ctx, query)
+}
@@ -0,0 +1,31 @@
+package psql
+
+import "testing"
+
+func TestQuoteIdentifier(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{name: "Users", want: `"users"`, ok: true},
+		{name: "users_audit", want: `"users_audit"`, ok: true},
+		{name: "_t1", want: `"_t1"`, ok: true},
+		{name: "", ok: false},
+		{name: "1users", ok: false},
+		{name: "users; DROP TABLE users", ok: false},
+		{name: `users"`, ok: false},
+		{name: "public.users", ok: false},
+		{name: "u" + string(make([]byte, 63)), ok: false},
+	}
+
+	for _, tt := range tests {
+		got, err := quoteIdentifier(tt.name)
+		if tt.ok && (err != nil || got != tt.want) {
+			t.Errorf("quoteIdentifier(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("quoteIdentifier(%q) = %q, want an error", tt.name, got)
+		}
+	}
+}
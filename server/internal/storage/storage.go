@@ -5,5 +5,8 @@ import "errors"
 var (
 	ErrUserNotFound = errors.New("user not found")
 	ErrUserExists   = errors.New("user already exists")
-	ErrNotFound     = errors.New("user not found")
+	// ErrConflict means the operation lost a race with a concurrent change and may be retried.
+	ErrConflict = errors.New("conflict")
+	// ErrUnavailable means the backend cannot be reached at the moment.
+	ErrUnavailable = errors.New("storage unavailable")
 )
@@ -0,0 +1,596 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"server/internal/domain/interfaces"
+	"server/internal/domain/models"
+	"server/internal/lib/audit"
+	"server/internal/storage"
+	"server/internal/storage/cache"
+	"server/internal/storage/file"
+	"server/internal/storage/memory"
+	psql "server/internal/storage/postgres"
+	"server/internal/storage/postgres/pgtest"
+
+	"github.com/google/uuid"
+)
+
+var (
+	roles   = []string{"admin", "user", "guest"}
+	domains = []string{"mail.com", "test.org", "example.net"}
+	nicks   = []string{"alpha", "Alpha", "al.pha", "alphabet", "beta_1", "beta_2", "b-x", "gamma", "zeta-9", "Zed"}
+)
+
+func seedUsers() []models.User {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	users := make([]models.User, 0, 60)
+	for i := 0; i < 60; i++ {
+		users = append(users, models.User{
+			Id:       uuid.NewSHA1(uuid.NameSpaceOID, []byte(strconv.Itoa(i))),
+			Email:    fmt.Sprintf("user%d@%s", i, domains[i%len(domains)]),
+			Password: "password",
+			Role:     roles[i%len(roles)],
+			Nick:     fmt.Sprintf("%s%d", nicks[i%len(nicks)], i%4),
+			Version:  1,
+			// Every third user shares the creation time with the previous one
+			// to exercise the id tie-break.
+			CreatedAt: base.Add(time.Duration(i-i/3) * time.Hour),
+		})
+		users[i].UpdatedAt = users[i].CreatedAt
+	}
+
+	return users
+}
+
+func newBackends(t *testing.T) map[string]interfaces.Storage {
+	t.Helper()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	fileStorage, err := file.Open(log, file.Options{Dir: t.TempDir(), Fsync: file.FsyncNever, SnapshotInterval: time.Hour, SnapshotRecords: 50})
+	if err != nil {
+		t.Fatalf("failed to open file storage: %v", err)
+	}
+	go fileStorage.Run()
+	t.Cleanup(fileStorage.Stop)
+
+	backends := map[string]interfaces.Storage{
+		"memory": memory.New(log),
+		"cache":  cache.New(memory.New(log), 100, time.Minute),
+		"file":   fileStorage,
+	}
+
+	cfg, ok := pgtest.Config(t)
+	if !ok {
+		return backends
+	}
+
+	// Each driver gets a schema of its own, the tests insert the same users.
+	db, err := psql.New(pgtest.Migrate(t, cfg, log), pgtest.Table, log)
+	if err != nil {
+		t.Fatalf("failed to connect to postgres: %v", err)
+	}
+	t.Cleanup(func() { db.Stop() })
+	if err := db.Prepare(context.Background()); err != nil {
+		t.Fatalf("failed to prepare statements: %v", err)
+	}
+
+	pgxDB, err := psql.NewPgx(pgtest.Migrate(t, cfg, log), pgtest.Table, log)
+	if err != nil {
+		t.Fatalf("failed to connect to postgres with pgx: %v", err)
+	}
+	t.Cleanup(func() { pgxDB.Stop() })
+
+	backends["postgres"] = db
+	backends["pgx"] = pgxDB
+	return backends
+}
+
+// collect reads every user matching the query, pageSize at a time.
+func collect(t *testing.T, s interfaces.Storage, query models.UsersQuery, pageSize int) []uuid.UUID {
+	t.Helper()
+
+	var ids []uuid.UUID
+	query.Limit = pageSize
+	for {
+		users, err := s.GetUsers(context.Background(), query)
+		if err != nil {
+			t.Fatalf("GetUsers: %v", err)
+		}
+		for _, u := range users {
+			ids = append(ids, u.Id)
+		}
+		if pageSize == 0 || len(users) < pageSize {
+			return ids
+		}
+
+		cursor := query.Sort.Cursor(users[len(users)-1])
+		query.After = &cursor
+	}
+}
+
+func TestGetUsersBackendsAgree(t *testing.T) {
+	backends := newBackends(t)
+	if _, ok := backends["postgres"]; !ok {
+		t.Logf("%s is not set, checking the memory storage only", pgtest.URLEnv)
+	}
+
+	for name, s := range backends {
+		for i, u := range seedUsers() {
+			if err := s.Insert(context.Background(), u); err != nil {
+				t.Fatalf("%s: Insert: %v", name, err)
+			}
+			if i%7 == 0 {
+				if _, err := s.Delete(context.Background(), u.Id); err != nil {
+					t.Fatalf("%s: Delete: %v", name, err)
+				}
+			}
+		}
+	}
+
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	queries := map[string]models.UsersQuery{
+		"default":          {},
+		"created desc":     {Sort: models.UsersSort{Field: models.SortByCreatedAt, Desc: true}},
+		"email asc":        {Sort: models.UsersSort{Field: models.SortByEmail}},
+		"nick desc":        {Sort: models.UsersSort{Field: models.SortByNick, Desc: true}},
+		"role asc":         {Sort: models.UsersSort{Field: models.SortByRole}},
+		"role filter":      {Filter: models.UsersFilter{Role: "admin"}, Sort: models.UsersSort{Field: models.SortByNick}},
+		"domain filter":    {Filter: models.UsersFilter{EmailDomain: "test.org"}, Sort: models.UsersSort{Field: models.SortByEmail, Desc: true}},
+		"nick prefix":      {Filter: models.UsersFilter{NickPrefix: "alpha"}},
+		"nick prefix case": {Filter: models.UsersFilter{NickPrefix: "A"}, Sort: models.UsersSort{Field: models.SortByNick}},
+		"nick contains":    {Filter: models.UsersFilter{NickContains: "ta"}, Sort: models.UsersSort{Field: models.SortByRole, Desc: true}},
+		"created range": {Filter: models.UsersFilter{
+			CreatedAfter:  base.Add(5 * time.Hour),
+			CreatedBefore: base.Add(20 * time.Hour),
+		}},
+		"combined": {Filter: models.UsersFilter{
+			Role:         "user",
+			EmailDomain:  "mail.com",
+			NickContains: "a",
+			CreatedAfter: base.Add(3 * time.Hour),
+		}, Sort: models.UsersSort{Field: models.SortByEmail}},
+		"no match":         {Filter: models.UsersFilter{Role: "nobody"}},
+		"include deleted":  {Filter: models.UsersFilter{IncludeDeleted: true}, Sort: models.UsersSort{Field: models.SortByNick}},
+		"deleted filtered": {Filter: models.UsersFilter{Role: "guest", IncludeDeleted: true}, Sort: models.UsersSort{Desc: true}},
+	}
+
+	for qname, query := range queries {
+		t.Run(qname, func(t *testing.T) {
+			results := make(map[string][]uuid.UUID, len(backends))
+			for name, s := range backends {
+				all := collect(t, s, query, 0)
+				for _, pageSize := range []int{1, 4, 7} {
+					if paged := collect(t, s, query, pageSize); !slices.Equal(paged, all) {
+						t.Errorf("%s: pages of %d differ from the full result:\n got %v\nwant %v", name, pageSize, paged, all)
+					}
+				}
+				results[name] = all
+			}
+
+			for name, got := range results {
+				if !slices.Equal(got, results["memory"]) {
+					t.Errorf("backends disagree:\n%8s %v\n  memory %v", name, got, results["memory"])
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateChecksVersion(t *testing.T) {
+	for name, s := range newBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			user := seedUsers()[0]
+			if err := s.Insert(ctx, user); err != nil {
+				t.Fatalf("Insert: %v", err)
+			}
+
+			first, second := user, user
+			first.Nick, second.Nick = "first", "second"
+			first.UpdatedAt, first.UpdatedBy = user.UpdatedAt.Add(time.Minute), uuid.New()
+
+			if err := s.Update(ctx, user.Id, first); err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+			if err := s.Update(ctx, user.Id, second); !errors.Is(err, storage.ErrConflict) {
+				t.Fatalf("stale Update: got %v, want %v", err, storage.ErrConflict)
+			}
+
+			stored, err := s.GetUserById(ctx, user.Id)
+			if err != nil {
+				t.Fatalf("GetUserById: %v", err)
+			}
+			if stored.Nick != first.Nick || stored.Version != user.Version+1 {
+				t.Fatalf("stored nick %q version %d, want %q version %d", stored.Nick, stored.Version, first.Nick, user.Version+1)
+			}
+			if !stored.UpdatedAt.Equal(first.UpdatedAt) || stored.UpdatedBy != first.UpdatedBy || !stored.CreatedAt.Equal(user.CreatedAt) {
+				t.Fatalf("stored created_at %v updated_at %v by %v", stored.CreatedAt, stored.UpdatedAt, stored.UpdatedBy)
+			}
+
+			if err := s.Update(ctx, uuid.New(), first); !errors.Is(err, storage.ErrUserNotFound) {
+				t.Fatalf("Update of missing user: got %v, want %v", err, storage.ErrUserNotFound)
+			}
+		})
+	}
+}
+
+func TestWithTx(t *testing.T) {
+	for name, s := range newBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			users := seedUsers()
+			user, added := users[0], users[1]
+			if err := s.Insert(ctx, user); err != nil {
+				t.Fatalf("Insert: %v", err)
+			}
+			// Cached by the cache backend, the commit must drop it.
+			if _, err := s.GetUserById(ctx, user.Id); err != nil {
+				t.Fatalf("GetUserById: %v", err)
+			}
+
+			changed := user
+			changed.Nick = "renamed"
+			changes := func(tx interfaces.Storage) error {
+				if err := tx.Insert(audit.WithEvent(ctx, models.AuditEvent{Id: uuid.New(), TargetId: added.Id}), added); err != nil {
+					return err
+				}
+				if err := tx.Update(ctx, user.Id, changed); err != nil {
+					return err
+				}
+				// The transaction sees its own changes, also when joined.
+				return tx.WithTx(ctx, func(tx interfaces.Storage) error {
+					got, err := tx.GetUserById(ctx, user.Id)
+					if err != nil {
+						return err
+					}
+					if got.Nick != changed.Nick {
+						return fmt.Errorf("nick %q in the transaction, want %q", got.Nick, changed.Nick)
+					}
+					return nil
+				})
+			}
+
+			rollback := errors.New("rollback")
+			err := s.WithTx(ctx, func(tx interfaces.Storage) error {
+				if err := changes(tx); err != nil {
+					return err
+				}
+				return rollback
+			})
+			if !errors.Is(err, rollback) {
+				t.Fatalf("WithTx: got %v, want %v", err, rollback)
+			}
+			if _, err := s.GetUserById(ctx, added.Id); !errors.Is(err, storage.ErrUserNotFound) {
+				t.Errorf("GetUserById of a user inserted in a rolled back transaction: got %v, want %v", err, storage.ErrUserNotFound)
+			}
+			if got, err := s.GetUserById(ctx, user.Id); err != nil || got.Nick != user.Nick {
+				t.Errorf("GetUserById after rollback: nick %q, err %v, want %q", got.Nick, err, user.Nick)
+			}
+			if events, err := s.GetAuditEvents(ctx, models.AuditQuery{TargetId: added.Id}); err != nil || len(events) != 0 {
+				t.Errorf("GetAuditEvents after rollback: %d events, err %v, want none", len(events), err)
+			}
+
+			if err := s.WithTx(ctx, changes); err != nil {
+				t.Fatalf("WithTx: %v", err)
+			}
+			if _, err := s.GetUserById(ctx, added.Id); err != nil {
+				t.Errorf("GetUserById of a user inserted in a committed transaction: %v", err)
+			}
+			if got, err := s.GetUserById(ctx, user.Id); err != nil || got.Nick != changed.Nick {
+				t.Errorf("GetUserById after commit: nick %q, err %v, want %q", got.Nick, err, changed.Nick)
+			}
+			if events, err := s.GetAuditEvents(ctx, models.AuditQuery{TargetId: added.Id}); err != nil || len(events) != 1 {
+				t.Errorf("GetAuditEvents after commit: %d events, err %v, want 1", len(events), err)
+			}
+		})
+	}
+}
+
+func TestSoftDelete(t *testing.T) {
+	for name, s := range newBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			users := seedUsers()
+			user, other := users[0], users[1]
+			for _, u := range []models.User{user, other} {
+				if err := s.Insert(ctx, u); err != nil {
+					t.Fatalf("Insert: %v", err)
+				}
+			}
+
+			deleted, err := s.Delete(ctx, user.Id)
+			if err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+			if deleted.DeletedAt == nil || deleted.Version != user.Version+1 {
+				t.Fatalf("deleted user has deleted_at %v version %d", deleted.DeletedAt, deleted.Version)
+			}
+
+			if _, err := s.GetUserById(ctx, user.Id); !errors.Is(err, storage.ErrUserNotFound) {
+				t.Errorf("GetUserById of deleted user: got %v, want %v", err, storage.ErrUserNotFound)
+			}
+			if _, err := s.GetUserByEmail(ctx, user.Email); !errors.Is(err, storage.ErrUserNotFound) {
+				t.Errorf("GetUserByEmail of deleted user: got %v, want %v", err, storage.ErrUserNotFound)
+			}
+			if err := s.Update(ctx, user.Id, deleted); !errors.Is(err, storage.ErrUserNotFound) {
+				t.Errorf("Update of deleted user: got %v, want %v", err, storage.ErrUserNotFound)
+			}
+			if _, err := s.Delete(ctx, user.Id); !errors.Is(err, storage.ErrUserNotFound) {
+				t.Errorf("second Delete: got %v, want %v", err, storage.ErrUserNotFound)
+			}
+			if ids := collect(t, s, models.UsersQuery{}, 0); !slices.Equal(ids, []uuid.UUID{other.Id}) {
+				t.Errorf("GetUsers returned %v, want only %v", ids, other.Id)
+			}
+			if ids := collect(t, s, models.UsersQuery{Filter: models.UsersFilter{IncludeDeleted: true}}, 0); len(ids) != 2 {
+				t.Errorf("GetUsers with deleted returned %v, want both users", ids)
+			}
+			if _, err := s.Restore(ctx, other.Id); !errors.Is(err, storage.ErrUserNotFound) {
+				t.Errorf("Restore of a live user: got %v, want %v", err, storage.ErrUserNotFound)
+			}
+
+			// The email of a deleted user is free until the user is restored.
+			reuse := users[2]
+			reuse.Email = user.Email
+			if err := s.Insert(ctx, reuse); err != nil {
+				t.Fatalf("Insert with the email of a deleted user: %v", err)
+			}
+			if _, err := s.Restore(ctx, user.Id); !errors.Is(err, storage.ErrUserExists) {
+				t.Errorf("Restore with a taken email: got %v, want %v", err, storage.ErrUserExists)
+			}
+			if _, err := s.Delete(ctx, reuse.Id); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+
+			restored, err := s.Restore(ctx, user.Id)
+			if err != nil {
+				t.Fatalf("Restore: %v", err)
+			}
+			if restored.DeletedAt != nil || restored.Version != deleted.Version+1 {
+				t.Errorf("restored user has deleted_at %v version %d", restored.DeletedAt, restored.Version)
+			}
+			if _, err := s.GetUserById(ctx, user.Id); err != nil {
+				t.Errorf("GetUserById of restored user: %v", err)
+			}
+
+			if purged, err := s.Purge(ctx, time.Now().Add(-time.Hour)); err != nil || purged != 0 {
+				t.Errorf("Purge of recent deletions: purged %d, err %v", purged, err)
+			}
+			if purged, err := s.Purge(ctx, time.Now().Add(time.Hour)); err != nil || purged != 1 {
+				t.Errorf("Purge: purged %d, err %v, want 1", purged, err)
+			}
+			if ids := collect(t, s, models.UsersQuery{Filter: models.UsersFilter{IncludeDeleted: true}}, 0); len(ids) != 2 {
+				t.Errorf("GetUsers after purge returned %v, want the two live users", ids)
+			}
+		})
+	}
+}
+
+func TestGetUsersByIds(t *testing.T) {
+	for name, s := range newBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			users := seedUsers()[:5]
+			for _, u := range users {
+				if err := s.Insert(ctx, u); err != nil {
+					t.Fatalf("Insert: %v", err)
+				}
+			}
+			if _, err := s.Delete(ctx, users[3].Id); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+
+			got, err := s.GetUsersByIds(ctx, []uuid.UUID{users[4].Id, uuid.New(), users[0].Id, users[3].Id, users[4].Id, users[1].Id})
+			if err != nil {
+				t.Fatalf("GetUsersByIds: %v", err)
+			}
+			want := []uuid.UUID{users[4].Id, users[0].Id, users[1].Id}
+			ids := make([]uuid.UUID, len(got))
+			for i, u := range got {
+				ids[i] = u.Id
+			}
+			if !slices.Equal(ids, want) {
+				t.Errorf("GetUsersByIds returned %v, want %v", ids, want)
+			}
+			if got[0].Email != users[4].Email || got[0].Version != users[4].Version {
+				t.Errorf("GetUsersByIds returned %+v, want %+v", got[0], users[4])
+			}
+
+			if got, err := s.GetUsersByIds(ctx, nil); err != nil || len(got) != 0 {
+				t.Errorf("GetUsersByIds with no ids returned %v, err %v", got, err)
+			}
+		})
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	for name, s := range newBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			base := time.Now().UTC().Truncate(time.Microsecond)
+			actor := uuid.New()
+			step := 0
+			audited := func(operation string, target uuid.UUID) context.Context {
+				step++
+				return audit.WithEvent(context.Background(), models.AuditEvent{
+					Id:         uuid.New(),
+					OccurredAt: base.Add(time.Duration(step) * time.Second),
+					RequestId:  "request-" + strconv.Itoa(step),
+					ActorId:    actor,
+					Operation:  operation,
+					TargetId:   target,
+				})
+			}
+
+			users := seedUsers()
+			user, other := users[0], users[1]
+			if err := s.Insert(audited(models.AuditInsert, user.Id), user); err != nil {
+				t.Fatalf("Insert: %v", err)
+			}
+			// Mutations without an event in the context are not audited.
+			if err := s.Insert(context.Background(), other); err != nil {
+				t.Fatalf("Insert: %v", err)
+			}
+
+			changed := user
+			changed.Nick, changed.Password = "renamed", "secret"
+			if err := s.Update(audited(models.AuditUpdate, user.Id), user.Id, changed); err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+			// A failed mutation leaves no event behind.
+			if err := s.Update(audited(models.AuditUpdate, user.Id), user.Id, changed); !errors.Is(err, storage.ErrConflict) {
+				t.Fatalf("stale Update: got %v, want %v", err, storage.ErrConflict)
+			}
+			if _, err := s.Delete(audited(models.AuditDelete, user.Id), user.Id); err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+
+			events, err := s.GetAuditEvents(context.Background(), models.AuditQuery{TargetId: user.Id})
+			if err != nil {
+				t.Fatalf("GetAuditEvents: %v", err)
+			}
+			var operations []string
+			for _, e := range events {
+				operations = append(operations, e.Operation)
+			}
+			if want := []string{models.AuditDelete, models.AuditUpdate, models.AuditInsert}; !slices.Equal(operations, want) {
+				t.Fatalf("operations %v, want %v", operations, want)
+			}
+
+			update := events[1]
+			if update.ActorId != actor || update.RequestId != "request-2" || !update.OccurredAt.Equal(base.Add(2*time.Second)) {
+				t.Errorf("update event has actor %v request %q time %v", update.ActorId, update.RequestId, update.OccurredAt)
+			}
+			wantChanges := []models.FieldChange{
+				{Field: "nick", Before: user.Nick, After: "renamed"},
+				{Field: "password", Before: audit.Redacted, After: audit.Redacted},
+			}
+			if !slices.Equal(update.Changes, wantChanges) {
+				t.Errorf("update changes %v, want %v", update.Changes, wantChanges)
+			}
+			if len(events[2].Changes) == 0 || len(events[0].Changes) != 1 || events[0].Changes[0].Field != "deleted_at" {
+				t.Errorf("insert changes %v, delete changes %v", events[2].Changes, events[0].Changes)
+			}
+
+			page, err := s.GetAuditEvents(context.Background(), models.AuditQuery{
+				ActorId: actor,
+				Limit:   2,
+				After:   &models.AuditCursor{OccurredAt: events[0].OccurredAt, Id: events[0].Id},
+			})
+			if err != nil {
+				t.Fatalf("GetAuditEvents after cursor: %v", err)
+			}
+			if len(page) != 2 || page[0].Id != events[1].Id || page[1].Id != events[2].Id {
+				t.Errorf("page after the newest event is %v", page)
+			}
+
+			if events, err := s.GetAuditEvents(context.Background(), models.AuditQuery{TargetId: other.Id}); err != nil || len(events) != 0 {
+				t.Errorf("events of an unaudited user: %v, err %v", events, err)
+			}
+		})
+	}
+}
+
+func TestBatch(t *testing.T) {
+	for name, s := range newBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			users := seedUsers()
+			first, second := users[0], users[1]
+			if err := s.Insert(ctx, first); err != nil {
+				t.Fatalf("Insert: %v", err)
+			}
+
+			wantErrs := func(op string, results []models.BatchResult, want ...error) {
+				t.Helper()
+				if len(results) != len(want) {
+					t.Fatalf("%s: %d results, want %d", op, len(results), len(want))
+				}
+				for i, result := range results {
+					if !errors.Is(result.Err, want[i]) || (want[i] == nil) != (result.Err == nil) {
+						t.Errorf("%s: item %d: got %v, want %v", op, i, result.Err, want[i])
+					}
+				}
+			}
+
+			// A failed item leaves the others to be rolled back by the caller.
+			rollback := errors.New("rollback")
+			err := s.WithTx(ctx, func(tx interfaces.Storage) error {
+				results, err := tx.InsertUsers(ctx, []models.User{second, first})
+				if err != nil {
+					return err
+				}
+				wantErrs("InsertUsers in a transaction", results, nil, storage.ErrUserExists)
+				return rollback
+			})
+			if !errors.Is(err, rollback) {
+				t.Fatalf("WithTx: got %v, want %v", err, rollback)
+			}
+			if _, err := s.GetUserById(ctx, second.Id); !errors.Is(err, storage.ErrUserNotFound) {
+				t.Errorf("GetUserById after rollback: got %v, want %v", err, storage.ErrUserNotFound)
+			}
+
+			// The third user takes the email of the second, the fourth the id of the first.
+			third, fourth := users[2], users[3]
+			third.Email = strings.ToUpper(second.Email)
+			fourth.Id = first.Id
+			event := models.AuditEvent{Id: uuid.New(), OccurredAt: time.Now().UTC().Truncate(time.Microsecond), Operation: models.AuditInsert}
+			results, err := s.InsertUsers(audit.WithEvent(ctx, event), []models.User{second, users[4], third, fourth})
+			if err != nil {
+				t.Fatalf("InsertUsers: %v", err)
+			}
+			wantErrs("InsertUsers", results, nil, nil, storage.ErrUserExists, storage.ErrUserExists)
+			for _, user := range []models.User{second, users[4]} {
+				if _, err := s.GetUserById(ctx, user.Id); err != nil {
+					t.Errorf("GetUserById of an inserted user: %v", err)
+				}
+				events, err := s.GetAuditEvents(ctx, models.AuditQuery{TargetId: user.Id})
+				if err != nil || len(events) != 1 || events[0].Id == event.Id {
+					t.Errorf("GetAuditEvents of an inserted user: %v, err %v, want one event with its own id", events, err)
+				}
+			}
+
+			// The first user frees its email for the second, then repeats the
+			// update with the version it has just replaced.
+			renamed, taker := first, second
+			renamed.Email = "renamed@mail.com"
+			renamed.Password = "ignored"
+			taker.Email = first.Email
+			results, err = s.UpdateUsers(ctx, []models.User{renamed, taker, users[5], renamed})
+			if err != nil {
+				t.Fatalf("UpdateUsers: %v", err)
+			}
+			wantErrs("UpdateUsers", results, nil, nil, storage.ErrUserNotFound, storage.ErrConflict)
+			if results[0].User.Version != 2 || results[0].User.Password != first.Password {
+				t.Errorf("UpdateUsers: version %d, password %q, want 2 and the stored password", results[0].User.Version, results[0].User.Password)
+			}
+			if got, err := s.GetUserByEmail(ctx, first.Email); err != nil || got.Id != second.Id {
+				t.Errorf("GetUserByEmail of the taken email: %v, err %v, want %v", got.Id, err, second.Id)
+			}
+			if got, err := s.GetUserById(ctx, first.Id); err != nil || got.Email != renamed.Email || got.Password != first.Password {
+				t.Errorf("GetUserById of the updated user: %+v, err %v", got, err)
+			}
+
+			results, err = s.DeleteUsers(ctx, []uuid.UUID{first.Id, first.Id, users[5].Id})
+			if err != nil {
+				t.Fatalf("DeleteUsers: %v", err)
+			}
+			wantErrs("DeleteUsers", results, nil, storage.ErrUserNotFound, storage.ErrUserNotFound)
+			if deleted := results[0].User; deleted.DeletedAt == nil || deleted.Version != 3 {
+				t.Errorf("DeleteUsers: deleted at %v, version %d, want set and 3", deleted.DeletedAt, deleted.Version)
+			}
+			if _, err := s.GetUserById(ctx, first.Id); !errors.Is(err, storage.ErrUserNotFound) {
+				t.Errorf("GetUserById of a deleted user: got %v, want %v", err, storage.ErrUserNotFound)
+			}
+		})
+	}
+}
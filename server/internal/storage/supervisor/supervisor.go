@@ -0,0 +1,489 @@
+// Package supervisor keeps a storage backend that may be unreachable, e.g.
+// Postgres starting after the server, connected. While the backend is down the
+// supervisor is degraded: writes fail with storage.ErrUnavailable without
+// reaching it and reads are tried as usual.
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"server/internal/domain/interfaces"
+	"server/internal/domain/models"
+	"server/internal/storage"
+	"server/pkg/lib/backoff"
+	"server/pkg/lib/logger/sl"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Backend is a storage the supervisor can probe and close.
+type Backend interface {
+	interfaces.Storage
+	Ping(ctx context.Context) error
+	Stop() error
+}
+
+// ConnectFunc opens the backend, it fails when the backend cannot be used yet.
+type ConnectFunc func(ctx context.Context) (Backend, error)
+
+type Options struct {
+	// Attempts bounds the connection attempts made by Connect.
+	Attempts int
+	// Backoff spaces out connection attempts and checks of a degraded backend.
+	Backoff backoff.Backoff
+	// CheckInterval is how often a healthy backend is pinged.
+	CheckInterval time.Duration
+	// PingTimeout bounds a ping, ConnectFunc bounds its own work.
+	PingTimeout time.Duration
+}
+
+type Supervisor struct {
+	log     *slog.Logger
+	name    string
+	connect ConnectFunc
+	opts    Options
+
+	mu       sync.RWMutex
+	backend  Backend
+	degraded bool
+	since    time.Time
+	// failures counts the connection attempts or pings failed in a row.
+	failures int
+
+	// running is set by Run, Stop waits for done only then. stopped keeps
+	// Run from starting after Stop and a second Stop from closing twice.
+	running bool
+	stopped bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// New returns a degraded supervisor of the backend called name, Connect or Run
+// connect it.
+func New(log *slog.Logger, name string, connect ConnectFunc, opts Options) *Supervisor {
+	return &Supervisor{
+		log:      log,
+		name:     name,
+		connect:  connect,
+		opts:     opts,
+		degraded: true,
+		since:    time.Now(),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Connect tries to connect up to Attempts times, waiting between attempts as
+// the backoff says. It returns the last error when every attempt failed, the
+// supervisor then stays degraded until Run connects it.
+func (s *Supervisor) Connect(ctx context.Context) error {
+	const op = "storage.supervisor.Connect"
+
+	attempts := max(s.opts.Attempts, 1)
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = s.check(ctx); err == nil {
+			return nil
+		}
+
+		if attempt == attempts {
+			break
+		}
+
+		select {
+		case <-time.After(s.opts.Backoff.Delay(attempt)):
+		case <-ctx.Done():
+			return fmt.Errorf("%s: %w", op, ctx.Err())
+		}
+	}
+
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+// Run keeps the backend connected until Stop is called: a healthy backend is
+// pinged every CheckInterval, a degraded one is reconnected or pinged as the
+// backoff says. It returns at once after Stop.
+func (s *Supervisor) Run() {
+	const op = "storage.supervisor.Run"
+
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	s.running = true
+	s.mu.Unlock()
+	defer close(s.done)
+
+	s.log.With(slog.String("op", op)).Info("starting storage supervisor", slog.String("backend", s.name), slog.Duration("checkInterval", s.opts.CheckInterval))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-s.stop
+		cancel()
+	}()
+
+	for {
+		s.mu.RLock()
+		wait := s.opts.CheckInterval
+		if s.degraded {
+			wait = s.opts.Backoff.Delay(s.failures)
+		}
+		s.mu.RUnlock()
+
+		select {
+		case <-time.After(wait):
+		case <-s.stop:
+			return
+		}
+
+		_ = s.check(ctx)
+	}
+}
+
+// Stop ends Run, if it was started, and closes the backend. Calls after the
+// first do nothing.
+func (s *Supervisor) Stop() {
+	const op = "storage.supervisor.Stop"
+
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	s.stopped = true
+	running := s.running
+	s.mu.Unlock()
+
+	s.log.With(slog.String("op", op)).Info("stopping storage supervisor", slog.String("backend", s.name))
+
+	close(s.stop)
+	if running {
+		<-s.done
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.backend != nil {
+		_ = s.backend.Stop()
+		s.backend = nil
+	}
+}
+
+// check connects the backend or pings it and records the outcome.
+func (s *Supervisor) check(ctx context.Context) error {
+	s.mu.RLock()
+	backend := s.backend
+	s.mu.RUnlock()
+
+	if backend != nil {
+		ctx, cancel := context.WithTimeout(ctx, s.opts.PingTimeout)
+		defer cancel()
+
+		err := backend.Ping(ctx)
+		s.setState(err)
+		return err
+	}
+
+	backend, err := s.connect(ctx)
+	if err != nil {
+		s.setState(err)
+		return err
+	}
+
+	s.mu.Lock()
+	s.backend = backend
+	s.mu.Unlock()
+
+	s.setState(nil)
+	return nil
+}
+
+// setState marks the supervisor degraded when err is not nil and healthy
+// otherwise, logging the transitions.
+func (s *Supervisor) setState(err error) {
+	const op = "storage.supervisor.setState"
+	log := s.log.With(slog.String("op", op), slog.String("backend", s.name))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	degraded := err != nil
+	if degraded {
+		s.failures++
+	} else {
+		s.failures = 0
+	}
+
+	if degraded == s.degraded {
+		if degraded {
+			log.Warn("Storage backend is still unavailable", slog.Int("failures", s.failures), sl.Err(err))
+		}
+		return
+	}
+
+	s.degraded = degraded
+	s.since = time.Now()
+
+	if degraded {
+		log.Error("Storage backend became unavailable, refusing writes", sl.Err(err))
+	} else {
+		log.Info("Storage backend is active")
+	}
+}
+
+// observe marks the supervisor degraded when a call failed because the
+// backend could not be reached, Run notices when it is back.
+func (s *Supervisor) observe(err error) {
+	if !errors.Is(err, storage.ErrUnavailable) {
+		return
+	}
+
+	s.mu.RLock()
+	degraded := s.degraded
+	s.mu.RUnlock()
+
+	if !degraded {
+		s.setState(err)
+	}
+}
+
+// readable returns the backend for a read, which is tried even when degraded.
+func (s *Supervisor) readable() (Backend, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.backend == nil {
+		return nil, storage.ErrUnavailable
+	}
+
+	return s.backend, nil
+}
+
+// writable returns the backend for a write, which is refused when degraded.
+func (s *Supervisor) writable() (Backend, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.backend == nil || s.degraded {
+		return nil, storage.ErrUnavailable
+	}
+
+	return s.backend, nil
+}
+
+// WithTx runs fn in a transaction of the backend, it is refused like a write
+// while degraded.
+func (s *Supervisor) WithTx(ctx context.Context, fn func(tx interfaces.Storage) error) error {
+	const op = "storage.supervisor.WithTx"
+
+	backend, err := s.writable()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = backend.WithTx(ctx, fn)
+	s.observe(err)
+	return err
+}
+
+// Health reports the state seen by the last check without pinging the backend.
+func (s *Supervisor) Health(ctx context.Context) models.StorageHealth {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return models.StorageHealth{
+		Backend:  s.name,
+		Degraded: s.degraded,
+		Since:    s.since,
+	}
+}
+
+func (s *Supervisor) GetUsers(ctx context.Context, query models.UsersQuery) ([]models.User, error) {
+	const op = "storage.supervisor.GetUsers"
+
+	backend, err := s.readable()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	users, err := backend.GetUsers(ctx, query)
+	s.observe(err)
+	return users, err
+}
+
+func (s *Supervisor) StreamUsers(ctx context.Context, query models.UsersQuery, fn func(models.User) error) error {
+	const op = "storage.supervisor.StreamUsers"
+
+	backend, err := s.readable()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = backend.StreamUsers(ctx, query, fn)
+	s.observe(err)
+	return err
+}
+
+func (s *Supervisor) GetUserById(ctx context.Context, uid uuid.UUID) (models.User, error) {
+	const op = "storage.supervisor.GetUserById"
+
+	backend, err := s.readable()
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := backend.GetUserById(ctx, uid)
+	s.observe(err)
+	return user, err
+}
+
+func (s *Supervisor) GetUsersByIds(ctx context.Context, uids []uuid.UUID) ([]models.User, error) {
+	const op = "storage.supervisor.GetUsersByIds"
+
+	backend, err := s.readable()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	users, err := backend.GetUsersByIds(ctx, uids)
+	s.observe(err)
+	return users, err
+}
+
+func (s *Supervisor) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	const op = "storage.supervisor.GetUserByEmail"
+
+	backend, err := s.readable()
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := backend.GetUserByEmail(ctx, email)
+	s.observe(err)
+	return user, err
+}
+
+func (s *Supervisor) Insert(ctx context.Context, user models.User) error {
+	const op = "storage.supervisor.Insert"
+
+	backend, err := s.writable()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = backend.Insert(ctx, user)
+	s.observe(err)
+	return err
+}
+
+func (s *Supervisor) Update(ctx context.Context, uid uuid.UUID, user models.User) error {
+	const op = "storage.supervisor.Update"
+
+	backend, err := s.writable()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = backend.Update(ctx, uid, user)
+	s.observe(err)
+	return err
+}
+
+func (s *Supervisor) Delete(ctx context.Context, uid uuid.UUID) (models.User, error) {
+	const op = "storage.supervisor.Delete"
+
+	backend, err := s.writable()
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := backend.Delete(ctx, uid)
+	s.observe(err)
+	return user, err
+}
+
+func (s *Supervisor) Restore(ctx context.Context, uid uuid.UUID) (models.User, error) {
+	const op = "storage.supervisor.Restore"
+
+	backend, err := s.writable()
+	if err != nil {
+		return models.User{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := backend.Restore(ctx, uid)
+	s.observe(err)
+	return user, err
+}
+
+func (s *Supervisor) InsertUsers(ctx context.Context, users []models.User) ([]models.BatchResult, error) {
+	const op = "storage.supervisor.InsertUsers"
+
+	backend, err := s.writable()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	results, err := backend.InsertUsers(ctx, users)
+	s.observe(err)
+	return results, err
+}
+
+func (s *Supervisor) UpdateUsers(ctx context.Context, users []models.User) ([]models.BatchResult, error) {
+	const op = "storage.supervisor.UpdateUsers"
+
+	backend, err := s.writable()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	results, err := backend.UpdateUsers(ctx, users)
+	s.observe(err)
+	return results, err
+}
+
+func (s *Supervisor) DeleteUsers(ctx context.Context, uids []uuid.UUID) ([]models.BatchResult, error) {
+	const op = "storage.supervisor.DeleteUsers"
+
+	backend, err := s.writable()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	results, err := backend.DeleteUsers(ctx, uids)
+	s.observe(err)
+	return results, err
+}
+
+func (s *Supervisor) Purge(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	const op = "storage.supervisor.Purge"
+
+	backend, err := s.writable()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	purged, err := backend.Purge(ctx, deletedBefore)
+	s.observe(err)
+	return purged, err
+}
+
+func (s *Supervisor) GetAuditEvents(ctx context.Context, query models.AuditQuery) ([]models.AuditEvent, error) {
+	const op = "storage.supervisor.GetAuditEvents"
+
+	backend, err := s.readable()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	events, err := backend.GetAuditEvents(ctx, query)
+	s.observe(err)
+	return events, err
+}
@@ -0,0 +1,138 @@
+package supervisor_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"server/internal/domain/models"
+	"server/internal/storage"
+	"server/internal/storage/memory"
+	"server/internal/storage/supervisor"
+	"server/pkg/lib/backoff"
+
+	"github.com/google/uuid"
+)
+
+// flakyBackend is a memory storage whose reachability the test switches.
+type flakyBackend struct {
+	*memory.MemoryStorage
+	down *atomic.Bool
+}
+
+func (b flakyBackend) Ping(ctx context.Context) error {
+	if b.down.Load() {
+		return storage.ErrUnavailable
+	}
+	return nil
+}
+
+func (b flakyBackend) Stop() error {
+	return nil
+}
+
+func TestSupervisorRecovers(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx := context.Background()
+
+	var down atomic.Bool
+	down.Store(true)
+	backend := flakyBackend{MemoryStorage: memory.New(log), down: &down}
+	connect := func(ctx context.Context) (supervisor.Backend, error) {
+		if err := backend.Ping(ctx); err != nil {
+			return nil, err
+		}
+		return backend, nil
+	}
+
+	s := supervisor.New(log, "test", connect, supervisor.Options{
+		Attempts:      2,
+		Backoff:       backoff.New(time.Millisecond, 5*time.Millisecond),
+		CheckInterval: time.Millisecond,
+		PingTimeout:   time.Second,
+	})
+
+	if err := s.Connect(ctx); !errors.Is(err, storage.ErrUnavailable) {
+		t.Fatalf("Connect() error = %v, want %v", err, storage.ErrUnavailable)
+	}
+	if !s.Health(ctx).Degraded {
+		t.Fatal("Health().Degraded = false before the backend is reachable")
+	}
+
+	user := models.User{Id: uuid.New(), Email: "user@mail.com", Role: "user", Version: 1}
+	if err := s.Insert(ctx, user); !errors.Is(err, storage.ErrUnavailable) {
+		t.Fatalf("Insert() while degraded error = %v, want %v", err, storage.ErrUnavailable)
+	}
+
+	go s.Run()
+	defer s.Stop()
+
+	down.Store(false)
+	waitFor(t, func() bool { return !s.Health(ctx).Degraded })
+
+	if err := s.Insert(ctx, user); err != nil {
+		t.Fatalf("Insert() after recovery error = %v", err)
+	}
+
+	down.Store(true)
+	waitFor(t, func() bool { return s.Health(ctx).Degraded })
+
+	if _, err := s.Delete(ctx, user.Id); !errors.Is(err, storage.ErrUnavailable) {
+		t.Fatalf("Delete() while degraded error = %v, want %v", err, storage.ErrUnavailable)
+	}
+	if _, err := s.GetUserById(ctx, user.Id); err != nil {
+		t.Fatalf("GetUserById() while degraded error = %v, reads must be tried", err)
+	}
+}
+
+func TestStopWithoutRun(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx := context.Background()
+
+	var down atomic.Bool
+	backend := flakyBackend{MemoryStorage: memory.New(log), down: &down}
+	connect := func(ctx context.Context) (supervisor.Backend, error) {
+		return backend, nil
+	}
+
+	s := supervisor.New(log, "test", connect, supervisor.Options{
+		Attempts:      1,
+		Backoff:       backoff.New(time.Millisecond, 5*time.Millisecond),
+		CheckInterval: time.Millisecond,
+		PingTimeout:   time.Second,
+	})
+	if err := s.Connect(ctx); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		s.Stop()
+		s.Stop()
+		// Run after Stop returns at once.
+		s.Run()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop() without Run() did not return")
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -1,17 +1,28 @@
 package config
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
 type Config struct {
-	Env  string     `yaml:"env" env-default:"local"`
-	Grpc GrpcConfig `yaml:"grpc"`
+	Env        string           `yaml:"env" env-default:"local"`
+	Grpc       GrpcConfig       `yaml:"grpc"`
+	Password   PasswordConfig   `yaml:"password"`
+	Auth       AuthConfig       `yaml:"auth"`
+	Authz      AuthzConfig      `yaml:"authz"`
+	Email      EmailConfig      `yaml:"email"`
+	SoftDelete SoftDeleteConfig `yaml:"soft_delete"`
+	Migrations MigrationsConfig `yaml:"migrations"`
+	Storage    StorageConfig    `yaml:"storage"`
 }
 
 type GrpcConfig struct {
@@ -19,6 +30,133 @@ type GrpcConfig struct {
 	Timeout time.Duration `yaml:"timeout"`
 }
 
+// PasswordConfig holds argon2id parameters used to hash user passwords.
+type PasswordConfig struct {
+	Memory      uint32 `yaml:"memory" env-default:"65536"`
+	Iterations  uint32 `yaml:"iterations" env-default:"3"`
+	Parallelism uint8  `yaml:"parallelism" env-default:"2"`
+	SaltLength  uint32 `yaml:"salt_length" env-default:"16"`
+	KeyLength   uint32 `yaml:"key_length" env-default:"32"`
+}
+
+// AuthConfig holds the key and lifetime of issued access tokens. The key is
+// never read from the config file: it comes from AUTH_TOKEN_SECRET or the file
+// in AUTH_TOKEN_SECRET_FILE, which takes precedence, and must hold at least
+// MinTokenSecretLength bytes. TokenSecret is excluded from JSON so the config
+// can be logged safely.
+type AuthConfig struct {
+	TokenSecret     string        `yaml:"-" env:"AUTH_TOKEN_SECRET" json:"-"`
+	TokenSecretFile string        `yaml:"-" env:"AUTH_TOKEN_SECRET_FILE"`
+	TokenTTL        time.Duration `yaml:"token_ttl" env:"AUTH_TOKEN_TTL" env-default:"1h"`
+}
+
+// MinTokenSecretLength is the size of an HS256 key, shorter keys can be
+// guessed.
+const MinTokenSecretLength = 32
+
+// placeholderMarkers are found in sample keys of configs and examples.
+var placeholderMarkers = []string{"changeme", "change-me", "change_me"}
+
+// AuthzConfig is the permission matrix: role -> operation -> scope ("any" or "own").
+type AuthzConfig struct {
+	Roles map[string]map[string]string `yaml:"roles"`
+}
+
+// EmailConfig controls how email addresses are normalized before they are stored or looked up.
+type EmailConfig struct {
+	FoldPlusAddress bool `yaml:"fold_plus_address" env:"EMAIL_FOLD_PLUS_ADDRESS" env-default:"false"`
+}
+
+// SoftDeleteConfig controls how long deleted users are kept before they are purged.
+// A zero Retention keeps them forever.
+type SoftDeleteConfig struct {
+	Retention     time.Duration `yaml:"retention" env:"SOFT_DELETE_RETENTION" env-default:"720h"`
+	PurgeInterval time.Duration `yaml:"purge_interval" env:"SOFT_DELETE_PURGE_INTERVAL" env-default:"1h"`
+}
+
+// MigrationsConfig controls the schema migrations applied at startup. Timeout
+// also bounds the wait for another replica that is migrating. DevFixtures adds
+// development accounts with known passwords to an empty database after
+// migrating, it is refused outside the local and dev environments.
+type MigrationsConfig struct {
+	AutoApply   bool          `yaml:"auto_apply" env:"MIGRATIONS_AUTO_APPLY" env-default:"true"`
+	Timeout     time.Duration `yaml:"timeout" env:"MIGRATIONS_TIMEOUT" env-default:"1m"`
+	DevFixtures bool          `yaml:"dev_fixtures" env:"MIGRATIONS_DEV_FIXTURES" env-default:"false"`
+}
+
+// Postgres drivers accepted by PostgresConfig.Driver.
+const (
+	DriverPgx = "pgx"
+	// DriverPq is the database/sql driver used before pgx, kept as a fallback.
+	DriverPq = "pq"
+)
+
+// Storage backends accepted by StorageConfig.Backend.
+const (
+	BackendPostgres = "postgres"
+	BackendMemory   = "memory"
+	BackendFile     = "file"
+)
+
+// StorageConfig selects where users are stored. Postgres is used only by the
+// postgres backend and File only by the file backend.
+type StorageConfig struct {
+	Backend  string         `yaml:"backend" env:"STORAGE_BACKEND" env-default:"postgres"`
+	Postgres PostgresConfig `yaml:"postgres"`
+	File     FileConfig     `yaml:"file"`
+	Cache    CacheConfig    `yaml:"cache"`
+}
+
+// FileConfig controls the file backend, which keeps a write-ahead log and
+// snapshots in Dir. Fsync is "always", "interval" (every FsyncInterval) or
+// "never". The log is compacted into a snapshot every SnapshotInterval or once
+// it holds SnapshotRecords records.
+type FileConfig struct {
+	Dir              string        `yaml:"dir" env:"STORAGE_FILE_DIR" env-default:"./data"`
+	Fsync            string        `yaml:"fsync" env:"STORAGE_FILE_FSYNC" env-default:"always"`
+	FsyncInterval    time.Duration `yaml:"fsync_interval" env:"STORAGE_FILE_FSYNC_INTERVAL" env-default:"1s"`
+	SnapshotInterval time.Duration `yaml:"snapshot_interval" env:"STORAGE_FILE_SNAPSHOT_INTERVAL" env-default:"5m"`
+	SnapshotRecords  int           `yaml:"snapshot_records" env:"STORAGE_FILE_SNAPSHOT_RECORDS" env-default:"10000"`
+}
+
+// CacheConfig controls the cache of users looked up by id or email. Writes of
+// other replicas are seen once the cached users expire after TTL.
+type CacheConfig struct {
+	Enabled bool          `yaml:"enabled" env:"STORAGE_CACHE_ENABLED" env-default:"false"`
+	Size    int           `yaml:"size" env:"STORAGE_CACHE_SIZE" env-default:"10000"`
+	TTL     time.Duration `yaml:"ttl" env:"STORAGE_CACHE_TTL" env-default:"30s"`
+}
+
+// PostgresConfig holds the connection and pool settings. PasswordFile, when set,
+// takes precedence over Password so the password can be mounted as a secret.
+// Zero pool limits keep the driver defaults, MaxIdleConns applies to the pq
+// driver only. Schema, when set, is where the tables are created and looked up.
+//
+// At startup the server makes up to ConnectAttempts attempts to connect, the
+// delay between them doubles from ConnectBackoff up to ConnectMaxBackoff. If
+// all fail it starts degraded, refusing writes, and keeps reconnecting with
+// the same backoff. A connected database is pinged every HealthCheckInterval.
+type PostgresConfig struct {
+	Driver          string        `yaml:"driver" env:"POSTGRES_DRIVER" env-default:"pgx"`
+	Host            string        `yaml:"host" env:"POSTGRES_HOST" env-default:"localhost"`
+	Port            int           `yaml:"port" env:"POSTGRES_PORT" env-default:"5432"`
+	User            string        `yaml:"user" env:"POSTGRES_USER" env-default:"postgres"`
+	Password        string        `yaml:"password" env:"POSTGRES_PASSWORD" json:"-"`
+	PasswordFile    string        `yaml:"password_file" env:"POSTGRES_PASSWORD_FILE"`
+	DBName          string        `yaml:"dbname" env:"POSTGRES_DB" env-default:"psql"`
+	SSLMode         string        `yaml:"sslmode" env:"POSTGRES_SSLMODE" env-default:"disable"`
+	Schema          string        `yaml:"schema" env:"POSTGRES_SCHEMA"`
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"POSTGRES_MAX_OPEN_CONNS" env-default:"10"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"POSTGRES_MAX_IDLE_CONNS" env-default:"5"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"POSTGRES_CONN_MAX_LIFETIME" env-default:"30m"`
+
+	ConnectTimeout      time.Duration `yaml:"connect_timeout" env:"POSTGRES_CONNECT_TIMEOUT" env-default:"5s"`
+	ConnectAttempts     int           `yaml:"connect_attempts" env:"POSTGRES_CONNECT_ATTEMPTS" env-default:"5"`
+	ConnectBackoff      time.Duration `yaml:"connect_backoff" env:"POSTGRES_CONNECT_BACKOFF" env-default:"500ms"`
+	ConnectMaxBackoff   time.Duration `yaml:"connect_max_backoff" env:"POSTGRES_CONNECT_MAX_BACKOFF" env-default:"30s"`
+	HealthCheckInterval time.Duration `yaml:"health_check_interval" env:"POSTGRES_HEALTH_CHECK_INTERVAL" env-default:"10s"`
+}
+
 func MustLoad() *Config {
 	dir, _ := os.Getwd()
 	log.Println("dir", dir)
@@ -42,9 +180,65 @@ func MustLoadPath(configPath string) *Config {
 		panic("cannot read config: " + err.Error())
 	}
 
+	if cfg.Migrations.DevFixtures && cfg.Env != EnvLocal && cfg.Env != EnvDev {
+		panic("migrations dev_fixtures is allowed only in the local and dev environments")
+	}
+
+	switch cfg.Storage.Backend {
+	case BackendPostgres, BackendMemory, BackendFile:
+	default:
+		panic("unknown storage backend: " + cfg.Storage.Backend)
+	}
+
+	if cfg.Storage.Cache.Enabled && (cfg.Storage.Cache.Size <= 0 || cfg.Storage.Cache.TTL <= 0) {
+		panic("storage cache size and ttl must be positive")
+	}
+
+	switch cfg.Storage.Postgres.Driver {
+	case DriverPgx, DriverPq:
+	default:
+		panic("unknown postgres driver: " + cfg.Storage.Postgres.Driver)
+	}
+
+	if cfg.Storage.Postgres.HealthCheckInterval <= 0 || cfg.Storage.Postgres.ConnectBackoff <= 0 {
+		panic("postgres health_check_interval and connect_backoff must be positive")
+	}
+
+	if path := cfg.Auth.TokenSecretFile; path != "" {
+		secret, err := os.ReadFile(path)
+		if err != nil {
+			panic("cannot read auth token secret file: " + err.Error())
+		}
+		cfg.Auth.TokenSecret = strings.TrimRight(string(secret), "\r\n")
+	}
+
+	if path := cfg.Storage.Postgres.PasswordFile; path != "" {
+		password, err := os.ReadFile(path)
+		if err != nil {
+			panic("cannot read postgres password file: " + err.Error())
+		}
+		cfg.Storage.Postgres.Password = strings.TrimRight(string(password), "\r\n")
+	}
+
 	return &cfg
 }
 
+// CheckTokenSecret refuses a missing, short or sample token key. Anyone who
+// knows the key can sign tokens for any role. It is checked when the server
+// starts, the migrate command does not need the key.
+func CheckTokenSecret(secret string) error {
+	switch {
+	case secret == "":
+		return errors.New("set AUTH_TOKEN_SECRET or AUTH_TOKEN_SECRET_FILE")
+	case slices.ContainsFunc(placeholderMarkers, func(m string) bool { return strings.Contains(strings.ToLower(secret), m) }):
+		return errors.New("the key is a placeholder")
+	case len(secret) < MinTokenSecretLength:
+		return fmt.Errorf("the key must hold at least %d bytes", MinTokenSecretLength)
+	}
+
+	return nil
+}
+
 // fetchConfigPath fetches config path from command line flag or environment variable.
 // Priority: flag > env > default.
 // Default value is empty string.
@@ -0,0 +1,41 @@
+package backoff
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// Backoff computes exponentially growing delays between retries.
+type Backoff struct {
+	// Initial is the delay after the first failure, it doubles after every
+	// following one.
+	Initial time.Duration
+	// Max caps the delay, a Max below Initial keeps it at Initial.
+	Max time.Duration
+}
+
+func New(initial time.Duration, maximum time.Duration) Backoff {
+	return Backoff{
+		Initial: initial,
+		Max:     maximum,
+	}
+}
+
+// Delay returns the delay after the given number of consecutive failures,
+// starting at 1. Up to a fifth of it is jitter, so replicas started together
+// do not retry in lockstep.
+func (b Backoff) Delay(failures int) time.Duration {
+	if b.Initial <= 0 || failures <= 0 {
+		return 0
+	}
+
+	delay := b.Initial
+	for i := 1; i < failures && delay < b.Max; i++ {
+		delay *= 2
+	}
+	if delay > b.Max {
+		delay = max(b.Max, b.Initial)
+	}
+
+	return delay - rand.N(delay/5+1)
+}
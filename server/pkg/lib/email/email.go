@@ -0,0 +1,38 @@
+package email
+
+import "strings"
+
+// Normalizer brings email addresses to the canonical form used for lookups and uniqueness.
+type Normalizer struct {
+	// FoldPlusAddress drops the "+tag" part of the local part, so that
+	// "john+news@example.com" and "john@example.com" are the same address.
+	FoldPlusAddress bool
+}
+
+func New(foldPlusAddress bool) *Normalizer {
+	return &Normalizer{
+		FoldPlusAddress: foldPlusAddress,
+	}
+}
+
+// Normalize trims and lowercases the address and optionally folds plus addressing.
+func (n *Normalizer) Normalize(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if !n.FoldPlusAddress {
+		return email
+	}
+
+	// Addresses without exactly one "@" are left alone rather than folded
+	// into another user's address.
+	at := strings.Index(email, "@")
+	if at < 0 || strings.Count(email, "@") > 1 {
+		return email
+	}
+
+	local, domain := email[:at], email[at:]
+	if plus := strings.Index(local, "+"); plus > 0 {
+		local = local[:plus]
+	}
+
+	return local + domain
+}
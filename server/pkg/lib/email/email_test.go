@@ -0,0 +1,38 @@
+package email_test
+
+import (
+	"testing"
+
+	"server/pkg/lib/email"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name  string
+		email string
+		fold  string
+		keep  string
+	}{
+		{name: "canonical", email: "john@example.com", fold: "john@example.com", keep: "john@example.com"},
+		{name: "trim and lowercase", email: "  John.Doe@Example.COM\t", fold: "john.doe@example.com", keep: "john.doe@example.com"},
+		{name: "plus tag", email: "John+News@example.com", fold: "john@example.com", keep: "john+news@example.com"},
+		{name: "several plus tags", email: "john+a+b@example.com", fold: "john@example.com", keep: "john+a+b@example.com"},
+		{name: "plus in the domain", email: "john@ex+ample.com", fold: "john@ex+ample.com", keep: "john@ex+ample.com"},
+		{name: "leading plus", email: "+tag@x.com", fold: "+tag@x.com", keep: "+tag@x.com"},
+		{name: "no at", email: " John+News.example.com ", fold: "john+news.example.com", keep: "john+news.example.com"},
+		{name: "several at", email: "John+a@b@x.com", fold: "john+a@b@x.com", keep: "john+a@b@x.com"},
+		{name: "empty", email: "   ", fold: "", keep: ""},
+	}
+
+	folding, keeping := email.New(true), email.New(false)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := folding.Normalize(tt.email); got != tt.fold {
+				t.Errorf("Normalize(%q) with folding = %q, want %q", tt.email, got, tt.fold)
+			}
+			if got := keeping.Normalize(tt.email); got != tt.keep {
+				t.Errorf("Normalize(%q) without folding = %q, want %q", tt.email, got, tt.keep)
+			}
+		})
+	}
+}
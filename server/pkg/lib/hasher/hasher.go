@@ -0,0 +1,122 @@
+package hasher
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const prefix = "$argon2id$"
+
+var ErrInvalidHash = errors.New("invalid password hash")
+
+type Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// Argon2Hasher hashes passwords with argon2id and encodes them in the
+// PHC string format: $argon2id$v=19$m=...,t=...,p=...$salt$key.
+type Argon2Hasher struct {
+	params Params
+}
+
+func New(params Params) *Argon2Hasher {
+	return &Argon2Hasher{
+		params: params,
+	}
+}
+
+func (h *Argon2Hasher) Hash(password string) (string, error) {
+	const op = "hasher.Hash"
+
+	salt := make([]byte, h.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		prefix,
+		argon2.Version,
+		h.params.Memory,
+		h.params.Iterations,
+		h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify compares password with the stored value. Values that are not argon2id
+// hashes are treated as legacy plaintext passwords. needsRehash is true when the
+// stored value is plaintext or was hashed with parameters different from the
+// current ones.
+func (h *Argon2Hasher) Verify(password string, stored string) (ok bool, needsRehash bool, err error) {
+	const op = "hasher.Verify"
+
+	if !IsHash(stored) {
+		ok = subtle.ConstantTimeCompare([]byte(password), []byte(stored)) == 1
+		return ok, true, nil
+	}
+
+	params, salt, key, err := decode(stored)
+	if err != nil {
+		return false, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return false, false, nil
+	}
+
+	return true, params != h.params, nil
+}
+
+// IsHash reports whether value looks like an argon2id hash produced by Hash.
+func IsHash(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+func decode(encoded string) (Params, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+	if version != argon2.Version {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	var params Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
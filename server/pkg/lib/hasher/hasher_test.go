@@ -0,0 +1,105 @@
+package hasher_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"server/pkg/lib/hasher"
+)
+
+// params are cheap parameters, the tests do not need a strong hash.
+var params = hasher.Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestHashRoundTrip(t *testing.T) {
+	h := hasher.New(params)
+
+	hash, err := h.Hash("correct horse")
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	if !hasher.IsHash(hash) || !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("Hash() = %q, want a PHC argon2id string with the params", hash)
+	}
+
+	other, err := h.Hash("correct horse")
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+	if other == hash {
+		t.Error("Hash() returned the same value twice, the salt is not random")
+	}
+
+	ok, needsRehash, err := h.Verify("correct horse", hash)
+	if err != nil || !ok || needsRehash {
+		t.Errorf("Verify() of the password = %v, %v, %v, want true, false, nil", ok, needsRehash, err)
+	}
+
+	ok, needsRehash, err = h.Verify("wrong horse", hash)
+	if err != nil || ok || needsRehash {
+		t.Errorf("Verify() of a wrong password = %v, %v, %v, want false, false, nil", ok, needsRehash, err)
+	}
+}
+
+func TestVerifyLegacyPlaintext(t *testing.T) {
+	h := hasher.New(params)
+
+	if hasher.IsHash("qwerty") {
+		t.Fatal("IsHash() of a plaintext password = true")
+	}
+
+	ok, needsRehash, err := h.Verify("qwerty", "qwerty")
+	if err != nil || !ok || !needsRehash {
+		t.Errorf("Verify() of a plaintext password = %v, %v, %v, want true, true, nil", ok, needsRehash, err)
+	}
+
+	ok, _, err = h.Verify("qwerty1", "qwerty")
+	if err != nil || ok {
+		t.Errorf("Verify() of a wrong plaintext password = %v, %v, want false, nil", ok, err)
+	}
+}
+
+func TestVerifyChangedParams(t *testing.T) {
+	hash, err := hasher.New(params).Hash("password")
+	if err != nil {
+		t.Fatalf("Hash() error = %v", err)
+	}
+
+	for name, changed := range map[string]hasher.Params{
+		"memory":      {Memory: 128, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+		"iterations":  {Memory: 64, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+		"parallelism": {Memory: 64, Iterations: 1, Parallelism: 2, SaltLength: 16, KeyLength: 32},
+		"salt length": {Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 32, KeyLength: 32},
+		"key length":  {Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 64},
+	} {
+		t.Run(name, func(t *testing.T) {
+			// The stored parameters verify the password, the new ones are
+			// only used for the rehash.
+			ok, needsRehash, err := hasher.New(changed).Verify("password", hash)
+			if err != nil || !ok || !needsRehash {
+				t.Errorf("Verify() = %v, %v, %v, want true, true, nil", ok, needsRehash, err)
+			}
+		})
+	}
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	h := hasher.New(params)
+
+	for name, stored := range map[string]string{
+		"missing parts":   "$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA",
+		"extra parts":     "$argon2id$v=19$m=64,t=1,p=1$c2FsdA$a2V5$more",
+		"bad version":     "$argon2id$v=x$m=64,t=1,p=1$c2FsdA$a2V5",
+		"other version":   "$argon2id$v=16$m=64,t=1,p=1$c2FsdA$a2V5",
+		"bad params":      "$argon2id$v=19$m=64;t=1;p=1$c2FsdA$a2V5",
+		"bad salt base64": "$argon2id$v=19$m=64,t=1,p=1$!!!$a2V5",
+		"bad key base64":  "$argon2id$v=19$m=64,t=1,p=1$c2FsdA$!!!",
+	} {
+		t.Run(name, func(t *testing.T) {
+			ok, needsRehash, err := h.Verify("password", stored)
+			if !errors.Is(err, hasher.ErrInvalidHash) || ok || needsRehash {
+				t.Errorf("Verify() = %v, %v, %v, want false, false, %v", ok, needsRehash, err, hasher.ErrInvalidHash)
+			}
+		})
+	}
+}
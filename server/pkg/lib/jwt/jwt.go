@@ -0,0 +1,69 @@
+package jwt
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+type Claims struct {
+	UserId uuid.UUID
+	Email  string
+	Role   string
+}
+
+type tokenClaims struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// NewToken creates a HS256 signed access token for the user.
+func NewToken(uid uuid.UUID, email string, role string, secret string, ttl time.Duration) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, tokenClaims{
+		Email: email,
+		Role:  role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   uid.String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	})
+
+	signed, err := token.SignedString([]byte(secret))
+	if err != nil {
+		return "", fmt.Errorf("jwt.NewToken: %w", err)
+	}
+
+	return signed, nil
+}
+
+// ParseToken validates signature and expiration of the token and returns its claims.
+func ParseToken(tokenString string, secret string) (Claims, error) {
+	const op = "jwt.ParseToken"
+
+	var claims tokenClaims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return Claims{}, fmt.Errorf("%s: %w: %v", op, ErrInvalidToken, err)
+	}
+
+	uid, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%s: %w: %v", op, ErrInvalidToken, err)
+	}
+
+	return Claims{
+		UserId: uid,
+		Email:  claims.Email,
+		Role:   claims.Role,
+	}, nil
+}
@@ -0,0 +1,93 @@
+package jwt_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"server/pkg/lib/jwt"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const secret = "0123456789abcdef0123456789abcdef"
+
+func TestParseToken(t *testing.T) {
+	uid := uuid.New()
+
+	token, err := jwt.NewToken(uid, "user@example.com", "admin", secret, time.Minute)
+	if err != nil {
+		t.Fatalf("NewToken() error = %v", err)
+	}
+
+	claims, err := jwt.ParseToken(token, secret)
+	if err != nil {
+		t.Fatalf("ParseToken() error = %v", err)
+	}
+
+	want := jwt.Claims{UserId: uid, Email: "user@example.com", Role: "admin"}
+	if claims != want {
+		t.Errorf("ParseToken() = %+v, want %+v", claims, want)
+	}
+}
+
+func TestParseTokenInvalid(t *testing.T) {
+	uid := uuid.New()
+	now := time.Now()
+	valid := gojwt.RegisteredClaims{
+		Subject:   uid.String(),
+		ExpiresAt: gojwt.NewNumericDate(now.Add(time.Minute)),
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() error = %v", err)
+	}
+
+	sign := func(method gojwt.SigningMethod, claims gojwt.Claims, key interface{}) string {
+		t.Helper()
+		token, err := gojwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatalf("SignedString() error = %v", err)
+		}
+		return token
+	}
+
+	expired, err := jwt.NewToken(uid, "user@example.com", "user", secret, -time.Minute)
+	if err != nil {
+		t.Fatalf("NewToken() error = %v", err)
+	}
+	otherSecret, err := jwt.NewToken(uid, "user@example.com", "user", "another secret of a valid length!", time.Minute)
+	if err != nil {
+		t.Fatalf("NewToken() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "expired", token: expired},
+		{name: "other secret", token: otherSecret},
+		{name: "none algorithm", token: sign(gojwt.SigningMethodNone, valid, gojwt.UnsafeAllowNoneSignatureType)},
+		{name: "RS256 algorithm", token: sign(gojwt.SigningMethodRS256, valid, rsaKey)},
+		{name: "HS512 algorithm", token: sign(gojwt.SigningMethodHS512, valid, []byte(secret))},
+		{name: "no expiration", token: sign(gojwt.SigningMethodHS256, gojwt.RegisteredClaims{Subject: uid.String()}, []byte(secret))},
+		{name: "subject is not an id", token: sign(gojwt.SigningMethodHS256, gojwt.RegisteredClaims{
+			Subject:   "admin",
+			ExpiresAt: gojwt.NewNumericDate(now.Add(time.Minute)),
+		}, []byte(secret))},
+		{name: "malformed", token: "not.a.token"},
+		{name: "empty", token: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := jwt.ParseToken(tt.token, secret); !errors.Is(err, jwt.ErrInvalidToken) {
+				t.Errorf("ParseToken() error = %v, want %v", err, jwt.ErrInvalidToken)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package pagetoken
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+var ErrInvalidToken = errors.New("invalid page token")
+
+// Encode serializes the cursor into an opaque URL-safe token.
+func Encode(cursor any) (string, error) {
+	b, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Decode restores a cursor produced by Encode.
+func Decode(token string, cursor any) error {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return ErrInvalidToken
+	}
+
+	if err := json.Unmarshal(b, cursor); err != nil {
+		return ErrInvalidToken
+	}
+
+	return nil
+}